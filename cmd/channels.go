@@ -95,7 +95,12 @@ func listChannels() error {
 
 		for _, channel := range channels {
 			channelType := "Channel"
-			if channel.Broadcast {
+			switch {
+			case channel.Gigagroup:
+				channelType = "Gigagroup"
+			case channel.Megagroup:
+				channelType = "Megagroup"
+			case channel.Broadcast:
 				channelType = "Broadcast"
 			}
 
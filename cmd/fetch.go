@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"log"
+	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/momaek/tgchannel/internal/auth"
 	"github.com/momaek/tgchannel/internal/database"
@@ -13,11 +17,23 @@ import (
 )
 
 var (
-	fetchChannelID   int64
-	fetchChannelName string
-	fetchLimit       int
+	fetchChannelIDs   []int64
+	fetchChannelNames []string
+	fetchFile         string
+	fetchAll          bool
+	fetchWorkers      int
+	fetchLimit        int
+	fetchFull         bool
+	fetchSince        string
+	fetchUntil        string
+	fetchComments     bool
+	fetchJoin         bool
+	fetchParticipants bool
 )
 
+// defaultFetchLimit 未指定时间范围和 --limit 时默认抓取的消息数量
+const defaultFetchLimit = 100
+
 // fetchCmd represents the fetch command
 var fetchCmd = &cobra.Command{
 	Use:   "fetch",
@@ -25,13 +41,36 @@ var fetchCmd = &cobra.Command{
 	Long: `抓取指定 Channel 的历史消息。
 
 可以通过 Channel ID 或用户名指定频道，推荐使用 Channel ID。
+私有频道可以在 --name 中使用邀请链接 (t.me/+hash 或 t.me/joinchat/hash)，
+已加入的频道直接抓取，尚未加入时需要同时指定 --join 通过邀请链接加入；
+频道的 access hash 会保存到数据库，之后可以直接使用 --id 抓取。
+--id 和 --name 可以重复指定或用逗号分隔，--file 从文件读取频道列表
+（每行一个 ID、@用户名或邀请链接，# 开头为注释），--all 抓取所有活跃订阅的频道。
+多个频道由 --workers 个 worker 并发抓取，所有 worker 共享
+scraper.requests_per_minute 的请求预算，单个频道失败不影响其他频道。
 可以指定抓取的消息数量，默认抓取最新的 100 条消息。
+默认为增量抓取，只抓取比数据库中最新消息更新的消息，并从旧到新抓取，
+新消息超过 --limit 时剩下的消息会在下次运行时继续抓取；
+使用 --full 可以忽略已保存的消息，完整遍历并刷新已有记录。
+使用 --since / --until 可以抓取指定时间范围内的消息（开始时间包含、结束时间不包含），
+时间格式为 2006-01-02 或 RFC3339，指定时间范围时 --limit 默认不限制。
+使用 --comments 同时抓取帖子在讨论组中的评论（配置 scraper.comments 开启时总是抓取）。
+超级群组按同样的方式抓取，消息会记录发送者和回复关系，成员加入/退出的服务消息记录为成员变动；
+使用 --participants 在抓取完成后记录群组的成员快照。
 消息会被保存到数据库中供后续分析使用。
 
 示例:
   tgchannel fetch --id 1234567890
   tgchannel fetch --name @channel_name
-  tgchannel fetch --id 1234567890 --limit 500`,
+  tgchannel fetch --name https://t.me/+AbCdEfGhIjKlMnOp --join
+  tgchannel fetch --id 1234567890 --limit 500
+  tgchannel fetch --id 1234567890 --limit 500 --full
+  tgchannel fetch --id 1234567890 --since 2024-03-01 --until 2024-04-01
+  tgchannel fetch --id 1234567890 --limit 50 --full --comments
+  tgchannel fetch --name @group_name --participants
+  tgchannel fetch --id 1234567890,2345678901 --name @channel_name
+  tgchannel fetch --file channels.txt --workers 8 --since 2024-01-01
+  tgchannel fetch --all`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := fetch(); err != nil {
 			log.Fatalf("抓取失败: %v", err)
@@ -43,18 +82,47 @@ func init() {
 	rootCmd.AddCommand(fetchCmd)
 
 	// 添加标志
-	fetchCmd.Flags().Int64VarP(&fetchChannelID, "id", "i", 0, "Channel ID (推荐使用)")
-	fetchCmd.Flags().StringVarP(&fetchChannelName, "name", "n", "", "Channel 用户名 (例如: @channel_name)")
-	fetchCmd.Flags().IntVarP(&fetchLimit, "limit", "l", 100, "抓取消息数量")
+	fetchCmd.Flags().Int64SliceVarP(&fetchChannelIDs, "id", "i", nil, "Channel ID (推荐使用)，可重复指定或用逗号分隔")
+	fetchCmd.Flags().StringSliceVarP(&fetchChannelNames, "name", "n", nil, "Channel 用户名 (例如: @channel_name) 或邀请链接，可重复指定或用逗号分隔")
+	fetchCmd.Flags().StringVarP(&fetchFile, "file", "f", "", "频道列表文件，每行一个 ID、@用户名或邀请链接")
+	fetchCmd.Flags().BoolVar(&fetchAll, "all", false, "抓取所有活跃订阅的频道")
+	fetchCmd.Flags().IntVarP(&fetchWorkers, "workers", "w", 0, "同时抓取的频道数量 (默认使用 scraper.fetch_workers)")
+	fetchCmd.Flags().IntVarP(&fetchLimit, "limit", "l", 0, "抓取消息数量 (默认 100，指定时间范围时不限制)")
+	fetchCmd.Flags().BoolVar(&fetchFull, "full", false, "完整遍历历史消息，而不是只抓取新消息")
+	fetchCmd.Flags().StringVar(&fetchSince, "since", "", "开始时间，包含 (例如: 2024-03-01)")
+	fetchCmd.Flags().StringVar(&fetchUntil, "until", "", "结束时间，不包含 (例如: 2024-04-01)")
+	fetchCmd.Flags().BoolVar(&fetchComments, "comments", false, "同时抓取帖子在讨论组中的评论")
+	fetchCmd.Flags().BoolVar(&fetchJoin, "join", false, "通过邀请链接加入尚未加入的私有频道")
+	fetchCmd.Flags().BoolVar(&fetchParticipants, "participants", false, "抓取完成后记录群组的成员快照")
 
-	// 至少需要指定 ID 或用户名之一
-	fetchCmd.MarkFlagsMutuallyExclusive("id", "name")
+	// --all 已经包含所有订阅的频道
+	fetchCmd.MarkFlagsMutuallyExclusive("all", "id")
+	fetchCmd.MarkFlagsMutuallyExclusive("all", "name")
+	fetchCmd.MarkFlagsMutuallyExclusive("all", "file")
 }
 
 func fetch() error {
 	// 检查参数
-	if fetchChannelID == 0 && fetchChannelName == "" {
-		return fmt.Errorf("请指定 Channel ID (--id) 或用户名 (--name)")
+	if len(fetchChannelIDs) == 0 && len(fetchChannelNames) == 0 && fetchFile == "" && !fetchAll {
+		return fmt.Errorf("请指定 Channel ID (--id)、用户名 (--name)、频道列表文件 (--file) 或 --all")
+	}
+
+	// 解析时间范围
+	since, err := parseTimeFlag(fetchSince)
+	if err != nil {
+		return fmt.Errorf("无效的开始时间: %w", err)
+	}
+	until, err := parseTimeFlag(fetchUntil)
+	if err != nil {
+		return fmt.Errorf("无效的结束时间: %w", err)
+	}
+	if !since.IsZero() && !until.IsZero() && !since.Before(until) {
+		return fmt.Errorf("开始时间必须早于结束时间")
+	}
+
+	limit := fetchLimit
+	if limit <= 0 && since.IsZero() && until.IsZero() {
+		limit = defaultFetchLimit
 	}
 
 	// 初始化数据库
@@ -64,6 +132,14 @@ func fetch() error {
 	}
 	defer db.Close()
 
+	targets, err := fetchTargets(db)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("没有需要抓取的频道")
+	}
+
 	// 解析 API ID
 	apiID, err := strconv.Atoi(config.Telegram.APIID)
 	if err != nil {
@@ -78,23 +154,35 @@ func fetch() error {
 	ctx := context.Background()
 	err = client.Run(ctx, func(ctx context.Context) error {
 		// 创建爬虫实例
-		scraperClient := scraper.NewScraper(db, client.API(), &config.Scraper)
+		scraperClient := scraper.NewScraper(db, client, &config.Scraper)
+		opts := scraper.FetchOptions{
+			Limit:        limit,
+			Full:         fetchFull,
+			Since:        since,
+			Until:        until,
+			Comments:     fetchComments,
+			Join:         fetchJoin,
+			Participants: fetchParticipants,
+		}
 
 		// 抓取历史消息
-		if fetchChannelID != 0 {
-			log.Printf("开始抓取频道 ID %d 的历史消息，限制 %d 条...", fetchChannelID, fetchLimit)
-			if err := scraperClient.FetchChannelHistoryByID(ctx, fetchChannelID, fetchLimit); err != nil {
-				return fmt.Errorf("抓取历史消息失败: %w", err)
-			}
-			log.Printf("频道 ID %d 的历史消息抓取完成", fetchChannelID)
-		} else {
-			log.Printf("开始抓取频道 %s 的历史消息，限制 %d 条...", fetchChannelName, fetchLimit)
-			if err := scraperClient.FetchChannelHistory(ctx, fetchChannelName, fetchLimit); err != nil {
-				return fmt.Errorf("抓取历史消息失败: %w", err)
-			}
-			log.Printf("频道 %s 的历史消息抓取完成", fetchChannelName)
+		if len(targets) > 1 {
+			log.Printf("开始抓取 %d 个频道的历史消息...", len(targets))
 		}
+		results := scraperClient.FetchChannels(ctx, targets, opts, fetchWorkers)
 
+		var failed []string
+		for _, result := range results {
+			if result.Err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", result.Target, result.Err))
+			}
+		}
+		if len(targets) > 1 {
+			log.Printf("抓取结束: 成功 %d 个频道，失败 %d 个", len(results)-len(failed), len(failed))
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("抓取历史消息失败:\n  %s", strings.Join(failed, "\n  "))
+		}
 		return nil
 	})
 
@@ -104,3 +192,83 @@ func fetch() error {
 
 	return nil
 }
+
+// fetchTargets 汇总命令行、频道列表文件和订阅中指定的频道，按出现顺序去重
+func fetchTargets(db *database.Database) ([]scraper.ChannelTarget, error) {
+	var targets []scraper.ChannelTarget
+	seen := make(map[string]bool)
+	add := func(target scraper.ChannelTarget) {
+		key := target.String()
+		if target.InviteLink == "" {
+			// 用户名不区分大小写，邀请链接的 hash 区分大小写
+			key = strings.ToLower(strings.TrimPrefix(key, "@"))
+		}
+		if !seen[key] {
+			seen[key] = true
+			targets = append(targets, target)
+		}
+	}
+
+	if fetchAll {
+		channels, err := db.GetActiveSubscribedChannels()
+		if err != nil {
+			return nil, fmt.Errorf("获取订阅的频道失败: %w", err)
+		}
+		for _, channel := range channels {
+			add(scraper.ChannelTarget{TelegramID: channel.TelegramID})
+		}
+	}
+
+	for _, id := range fetchChannelIDs {
+		add(scraper.ChannelTarget{TelegramID: id})
+	}
+	for _, name := range fetchChannelNames {
+		add(parseChannelTarget(name))
+	}
+
+	if fetchFile != "" {
+		file, err := os.Open(fetchFile)
+		if err != nil {
+			return nil, fmt.Errorf("打开频道列表文件失败: %w", err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			add(parseChannelTarget(line))
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("读取频道列表文件失败: %w", err)
+		}
+	}
+	return targets, nil
+}
+
+// parseChannelTarget 将数字解析为 Channel ID，邀请链接作为私有频道，其他内容作为用户名
+func parseChannelTarget(value string) scraper.ChannelTarget {
+	if id, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return scraper.ChannelTarget{TelegramID: id}
+	}
+	if _, ok := scraper.InviteHash(value); ok {
+		return scraper.ChannelTarget{InviteLink: value}
+	}
+	return scraper.ChannelTarget{Username: value}
+}
+
+// parseTimeFlag 解析命令行中的时间参数，支持日期 (按本地时区) 和 RFC3339 格式
+func parseTimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/momaek/tgchannel/internal/database"
+	"github.com/momaek/tgchannel/internal/models"
+	"github.com/spf13/cobra"
+)
+
+var (
+	forwardsChannelID   int64
+	forwardsChannelName string
+	forwardsLimit       int
+)
+
+// forwardsCmd represents the forwards command
+var forwardsCmd = &cobra.Command{
+	Use:   "forwards",
+	Short: "查看频道转发内容的来源",
+	Long: `统计频道中转发消息的来源，按转发次数从多到少排列。
+
+统计基于数据库中已抓取的消息，来源可以是频道、用户或隐藏了账号的用户。
+
+示例:
+  tgchannel forwards --id 1234567890
+  tgchannel forwards --name @channel_name --limit 50`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := listForwardSources(); err != nil {
+			log.Fatalf("查看转发来源失败: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(forwardsCmd)
+
+	// 添加标志
+	forwardsCmd.Flags().Int64VarP(&forwardsChannelID, "id", "i", 0, "Channel ID")
+	forwardsCmd.Flags().StringVarP(&forwardsChannelName, "name", "n", "", "Channel 用户名")
+	forwardsCmd.Flags().IntVarP(&forwardsLimit, "limit", "l", 20, "显示来源数量")
+}
+
+func listForwardSources() error {
+	if forwardsChannelID == 0 && forwardsChannelName == "" {
+		return fmt.Errorf("请指定 Channel ID 或用户名")
+	}
+
+	// 初始化数据库
+	db, err := database.NewDatabase(config.Database.Path)
+	if err != nil {
+		return fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	defer db.Close()
+
+	var channel *models.Channel
+	if forwardsChannelID != 0 {
+		channel, err = db.GetChannelByTelegramID(forwardsChannelID)
+	} else {
+		channel, err = db.GetChannelByUsername(forwardsChannelName)
+	}
+	if err != nil {
+		return fmt.Errorf("获取频道失败: %w", err)
+	}
+
+	sources, err := db.GetForwardSources(channel.ID, forwardsLimit)
+	if err != nil {
+		return fmt.Errorf("获取转发来源失败: %w", err)
+	}
+
+	if len(sources) == 0 {
+		fmt.Printf("频道 %s 中没有转发的消息\n", channel.Title)
+		return nil
+	}
+
+	fmt.Printf("频道 %s 的转发来源:\n", channel.Title)
+	fmt.Println("=" + strings.Repeat("=", 90))
+	fmt.Printf("%-8s %-16s %-30s %-20s %-8s %-12s\n", "类型", "ID", "名称", "用户名", "次数", "最近转发")
+	fmt.Println("-" + strings.Repeat("-", 90))
+
+	for _, source := range sources {
+		username := ""
+		if source.Username != "" {
+			username = "@" + source.Username
+		}
+		fmt.Printf("%-8s %-16d %-30s %-20s %-8d %-12s\n",
+			source.FromType,
+			source.FromID,
+			truncateString(source.Name, 28),
+			username,
+			source.Count,
+			source.LastForwarded.Format("2006-01-02"))
+	}
+
+	fmt.Println("=" + strings.Repeat("=", 90))
+	return nil
+}
+
+// describeForward 格式化消息的转发来源
+func describeForward(db *database.Database, fwd *models.ForwardHeader) string {
+	name := fwd.FromName
+	if fwd.FromType == models.ForwardFromChannel {
+		if ch, err := db.GetChannelByTelegramID(fwd.FromID); err == nil {
+			name = ch.Title
+			if ch.Username != "" {
+				name += " (@" + ch.Username + ")"
+			}
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("%s %d", fwd.FromType, fwd.FromID)
+	}
+
+	desc := name
+	if fwd.MessageID != 0 {
+		desc += fmt.Sprintf(" 消息 %d", fwd.MessageID)
+	}
+	if fwd.PostAuthor != "" {
+		desc += "，作者 " + fwd.PostAuthor
+	}
+	desc += "，原发布于 " + fwd.Date.Format("2006-01-02 15:04:05")
+	if fwd.Imported {
+		desc += "（导入）"
+	}
+	return desc
+}
@@ -63,7 +63,7 @@ func list() error {
 	// 显示订阅的频道列表
 	fmt.Printf("用户 %s 订阅的 Channel 列表:\n", listUserUsername)
 	fmt.Println("=" + strings.Repeat("=", 80))
-	fmt.Printf("%-20s %-30s %-15s %-10s\n", "用户名", "标题", "成员数量", "状态")
+	fmt.Printf("%-20s %-30s %-15s %-10s %-10s\n", "用户名", "标题", "成员数量", "类型", "状态")
 	fmt.Println("-" + strings.Repeat("-", 80))
 
 	for _, channel := range channels {
@@ -71,10 +71,15 @@ func list() error {
 		if !channel.IsActive {
 			status = "非活跃"
 		}
-		fmt.Printf("%-20s %-30s %-15d %-10s\n",
+		kind := "频道"
+		if channel.IsGroup() {
+			kind = "群组"
+		}
+		fmt.Printf("%-20s %-30s %-15d %-10s %-10s\n",
 			"@"+channel.Username,
 			truncateString(channel.Title, 28),
 			channel.MemberCount,
+			kind,
 			status)
 	}
 
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/momaek/tgchannel/internal/database"
+	"github.com/momaek/tgchannel/internal/format"
 	"github.com/momaek/tgchannel/internal/models"
 	"github.com/spf13/cobra"
 )
@@ -15,6 +16,13 @@ var (
 	messagesChannelName string
 	messagesLimit       int
 	messagesOffset      int
+	messagesFormat      string
+	messagesHashtag     string
+	messagesHistory     bool
+	messagesDeleted     bool
+	messagesComments    bool
+	messagesSort        string
+	messagesQuery       string
 )
 
 // messagesCmd represents the messages command
@@ -24,13 +32,32 @@ var messagesCmd = &cobra.Command{
 	Long: `查看数据库中抓取的消息。
 
 可以通过 Channel ID 或用户名筛选特定频道的消息。
-支持分页查看，默认显示最新的 10 条消息。
+支持分页查看，默认显示最新的 10 条消息，相册中的多条消息合并为一条显示。
+使用 --format 以 Markdown 或 HTML 还原消息的格式和链接，
+使用 --hashtag 只显示包含指定话题标签的消息。
+使用 --history 只显示被编辑过的消息，并列出每条消息的历史版本。
+使用 --deleted 只显示已被频道删除的消息（本地保留了删除前的内容）。
+使用 --comments 显示每条帖子已抓取的讨论组评论。
+使用 --sort 按浏览、转发、评论或回应数排序，找出互动最多的帖子。
+使用 --query 只显示 search-remote 中被该关键词命中的消息。
 
 示例:
   tgchannel messages --id 1234567890
   tgchannel messages --name @channel_name
-  tgchannel messages --id 1234567890 --limit 20 --offset 10`,
+  tgchannel messages --id 1234567890 --limit 20 --offset 10
+  tgchannel messages --name @channel_name --format markdown
+  tgchannel messages --hashtag golang
+  tgchannel messages --name @channel_name --history
+  tgchannel messages --name @channel_name --deleted
+  tgchannel messages --name @channel_name --sort reactions
+  tgchannel messages --name @channel_name --query golang`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if err := validateMessageFormat(messagesFormat); err != nil {
+			log.Fatalf("参数错误: %v", err)
+		}
+		if err := validateMessageSort(messagesSort); err != nil {
+			log.Fatalf("参数错误: %v", err)
+		}
 		if err := listMessages(); err != nil {
 			log.Fatalf("查看消息失败: %v", err)
 		}
@@ -45,6 +72,49 @@ func init() {
 	messagesCmd.Flags().StringVarP(&messagesChannelName, "name", "n", "", "Channel 用户名")
 	messagesCmd.Flags().IntVarP(&messagesLimit, "limit", "l", 10, "显示消息数量")
 	messagesCmd.Flags().IntVarP(&messagesOffset, "offset", "o", 0, "偏移量")
+	messagesCmd.Flags().StringVarP(&messagesFormat, "format", "f", "text", "消息内容格式 (text, markdown, html)")
+	messagesCmd.Flags().StringVar(&messagesHashtag, "hashtag", "", "只显示包含该话题标签的消息")
+	messagesCmd.Flags().BoolVar(&messagesHistory, "history", false, "只显示被编辑过的消息及其历史版本")
+	messagesCmd.Flags().BoolVar(&messagesDeleted, "deleted", false, "只显示已被频道删除的消息")
+	messagesCmd.Flags().BoolVar(&messagesComments, "comments", false, "显示帖子的评论")
+	messagesCmd.Flags().StringVar(&messagesQuery, "query", "", "只显示被该服务器端搜索关键词命中的消息")
+	messagesCmd.Flags().StringVar(&messagesSort, "sort", "date", "排序字段 ("+strings.Join(database.MessageOrders, ", ")+")")
+}
+
+// validateMessageSort 校验排序字段
+func validateMessageSort(sort string) error {
+	for _, order := range database.MessageOrders {
+		if sort == order {
+			return nil
+		}
+	}
+	return fmt.Errorf("不支持的排序字段 %q，可选值: %s", sort, strings.Join(database.MessageOrders, ", "))
+}
+
+// validateMessageFormat 校验消息内容格式
+func validateMessageFormat(f string) error {
+	switch f {
+	case "text", "markdown", "html":
+		return nil
+	}
+	return fmt.Errorf("不支持的格式 %q，可选值: text, markdown, html", f)
+}
+
+// renderMessageText 按指定格式渲染消息内容
+func renderMessageText(db *database.Database, msg *models.Message) string {
+	if messagesFormat == "text" {
+		return msg.Text
+	}
+
+	entities, err := db.GetMessageEntities(msg.ID)
+	if err != nil {
+		log.Printf("获取消息 %d 的格式实体失败: %v", msg.TelegramID, err)
+		return msg.Text
+	}
+	if messagesFormat == "html" {
+		return format.HTML(msg.Text, entities)
+	}
+	return format.Markdown(msg.Text, entities)
 }
 
 func listMessages() error {
@@ -55,45 +125,55 @@ func listMessages() error {
 	}
 	defer db.Close()
 
-	// 获取消息
-	var messages []*models.Message
+	// 获取消息，相册按一条帖子显示
+	var albums []*models.Album
 	var channel *models.Channel
 
 	if messagesChannelID != 0 {
-		// 通过 Channel ID 获取消息
+		// 通过 Channel ID 获取频道
 		channel, err = db.GetChannelByTelegramID(messagesChannelID)
 		if err != nil {
 			return fmt.Errorf("获取频道失败: %w", err)
 		}
-		messages, err = db.GetChannelMessages(channel.ID, messagesLimit, messagesOffset)
 	} else if messagesChannelName != "" {
-		// 通过用户名获取消息
+		// 通过用户名获取频道
 		channel, err = db.GetChannelByUsername(messagesChannelName)
 		if err != nil {
 			return fmt.Errorf("获取频道失败: %w", err)
 		}
-		messages, err = db.GetChannelMessages(channel.ID, messagesLimit, messagesOffset)
-	} else {
-		// 获取所有消息
-		messages, err = db.GetAllMessages(messagesLimit, messagesOffset)
 	}
 
+	filter := database.MessageFilter{
+		Hashtag: messagesHashtag,
+		Edited:  messagesHistory,
+		Deleted: messagesDeleted,
+		Query:   messagesQuery,
+		OrderBy: messagesSort,
+		Limit:   messagesLimit,
+		Offset:  messagesOffset,
+	}
+	if channel != nil {
+		filter.ChannelID = channel.ID
+	}
+	albums, err = db.FindAlbums(filter)
+
 	if err != nil {
 		return fmt.Errorf("获取消息失败: %w", err)
 	}
 
-	if len(messages) == 0 {
+	if len(albums) == 0 {
 		fmt.Println("没有找到消息")
 		return nil
 	}
 
 	// 显示消息
-	fmt.Printf("找到 %d 条消息:\n", len(messages))
+	fmt.Printf("找到 %d 条消息:\n", len(albums))
 	fmt.Println("=" + strings.Repeat("=", 100))
-	fmt.Printf("%-8s %-12s %-20s %-15s %-20s\n", "ID", "Telegram ID", "频道", "发送时间", "消息长度")
+	fmt.Printf("%-8s %-12s %-20s %-15s %-10s %-10s\n", "ID", "Telegram ID", "频道", "发送时间", "消息长度", "相册")
 	fmt.Println("-" + strings.Repeat("-", 100))
 
-	for _, msg := range messages {
+	for _, album := range albums {
+		msg := album.Caption()
 		channelTitle := "未知频道"
 		if channel != nil {
 			channelTitle = channel.Title
@@ -109,12 +189,18 @@ func listMessages() error {
 			textLength = 50
 		}
 
-		fmt.Printf("%-8d %-12d %-20s %-15s %-20d\n",
+		albumSize := "-"
+		if len(album.Messages) > 1 {
+			albumSize = fmt.Sprintf("%d 项", len(album.Messages))
+		}
+
+		fmt.Printf("%-8d %-12d %-20s %-15s %-10d %-10s\n",
 			msg.ID,
 			msg.TelegramID,
 			truncateString(channelTitle, 18),
 			msg.Date.Format("01-02 15:04"),
-			textLength)
+			textLength,
+			albumSize)
 	}
 
 	fmt.Println("=" + strings.Repeat("=", 100))
@@ -123,7 +209,9 @@ func listMessages() error {
 	fmt.Println("\n详细消息内容:")
 	fmt.Println("=" + strings.Repeat("=", 100))
 
-	for i, msg := range messages {
+	for i, album := range albums {
+		msg := album.Caption()
+
 		// 获取频道标题
 		channelTitle := "未知频道"
 		if channel != nil {
@@ -138,22 +226,226 @@ func listMessages() error {
 		fmt.Printf("\n[%d] 消息 ID: %d (Telegram ID: %d)\n", i+1, msg.ID, msg.TelegramID)
 		fmt.Printf("频道: %s\n", channelTitle)
 		fmt.Printf("时间: %s\n", msg.Date.Format("2006-01-02 15:04:05"))
-		fmt.Printf("内容:\n%s\n", msg.Text)
+		if sender := describeSender(msg); sender != "" {
+			fmt.Printf("发送者: %s\n", sender)
+		}
+		fmt.Printf("内容:\n%s\n", renderMessageText(db, msg))
 
-		if msg.MediaType != "" {
+		if msg.ReplyToID != 0 {
+			printReplyChain(db, msg)
+		}
+		if msg.Forward != nil {
+			fmt.Printf("转发自: %s\n", describeForward(db, msg.Forward))
+		}
+		if len(album.Messages) > 1 {
+			printAlbumItems(db, album)
+		} else if msg.MediaType != "" {
 			fmt.Printf("媒体类型: %s\n", msg.MediaType)
 		}
 		if msg.MediaURL != "" {
 			fmt.Printf("媒体链接: %s\n", msg.MediaURL)
 		}
+		if msg.MediaType == "poll" {
+			printMessagePoll(db, msg)
+		}
 		if msg.Views > 0 {
 			fmt.Printf("浏览: %d\n", msg.Views)
 		}
 		if msg.Forwards > 0 {
 			fmt.Printf("转发: %d\n", msg.Forwards)
 		}
+		if msg.Replies > 0 {
+			fmt.Printf("评论: %d\n", msg.Replies)
+		}
+		if msg.Reactions > 0 {
+			printMessageReactions(db, msg)
+		}
+		if msg.EditDate != nil {
+			fmt.Printf("最后编辑: %s\n", msg.EditDate.Format("2006-01-02 15:04:05"))
+		}
+		if msg.DeletedAt != nil {
+			fmt.Printf("已删除: %s (发现时间)\n", msg.DeletedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		if messagesHistory {
+			printMessageVersions(db, msg)
+		}
+		if messagesComments {
+			printMessageComments(db, msg)
+		}
 		fmt.Println("-" + strings.Repeat("-", 50))
 	}
 
 	return nil
 }
+
+// printMessageVersions 显示消息的历史版本
+func printMessageVersions(db *database.Database, msg *models.Message) {
+	versions, err := db.GetMessageVersions(msg.ID)
+	if err != nil {
+		log.Printf("获取消息 %d 的历史版本失败: %v", msg.TelegramID, err)
+		return
+	}
+
+	fmt.Printf("历史版本 (%d 个):\n", len(versions))
+	for _, version := range versions {
+		fmt.Printf("  [v%d] %s", version.Version, version.EditDate.Format("2006-01-02 15:04:05"))
+		if version.MediaType != "" {
+			fmt.Printf(" (媒体: %s)", version.MediaType)
+		}
+		fmt.Printf("\n  %s\n", strings.ReplaceAll(version.Text, "\n", "\n  "))
+	}
+}
+
+// printMessageComments 显示帖子已保存的评论
+func printMessageComments(db *database.Database, msg *models.Message) {
+	comments, err := db.GetMessageComments(msg.ID)
+	if err != nil {
+		log.Printf("获取消息 %d 的评论失败: %v", msg.TelegramID, err)
+		return
+	}
+	if len(comments) == 0 {
+		return
+	}
+
+	fmt.Printf("评论 (已抓取 %d 条):\n", len(comments))
+	for _, comment := range comments {
+		author := comment.AuthorName
+		if author == "" {
+			author = fmt.Sprintf("ID %d", comment.AuthorID)
+		}
+		fmt.Printf("  [%d] %s %s", comment.TelegramID, comment.Date.Format("01-02 15:04"), author)
+		if comment.ReplyToID != 0 {
+			fmt.Printf(" 回复 [%d]", comment.ReplyToID)
+		}
+		fmt.Printf(": %s\n", strings.ReplaceAll(comment.Text, "\n", " "))
+	}
+}
+
+// printAlbumItems 显示相册中的每个媒体项及已下载的文件
+func printAlbumItems(db *database.Database, album *models.Album) {
+	fmt.Printf("相册 (%d 项):\n", len(album.Messages))
+	for i, item := range album.Messages {
+		fmt.Printf("  %d. Telegram ID %d: %s\n", i+1, item.TelegramID, item.MediaType)
+
+		files, err := db.GetMessageMedia(item.ID)
+		if err != nil {
+			log.Printf("获取消息 %d 的媒体文件失败: %v", item.TelegramID, err)
+			continue
+		}
+		for _, file := range files {
+			fmt.Printf("     %s\n", file.LocalPath)
+		}
+	}
+}
+
+// printMessagePoll 显示消息中的投票及每个选项的票数
+func printMessagePoll(db *database.Database, msg *models.Message) {
+	poll, err := db.GetMessagePoll(msg.ID)
+	if err != nil {
+		return
+	}
+
+	kind := "投票"
+	if poll.Quiz {
+		kind = "测验"
+	}
+	var flags []string
+	if poll.MultipleChoice {
+		flags = append(flags, "多选")
+	}
+	if poll.PublicVoters {
+		flags = append(flags, "公开投票人")
+	}
+	if poll.Closed {
+		flags = append(flags, "已结束")
+	} else if poll.CloseDate != nil {
+		flags = append(flags, "截止 "+poll.CloseDate.Format("2006-01-02 15:04:05"))
+	}
+	if len(flags) > 0 {
+		kind += " (" + strings.Join(flags, ", ") + ")"
+	}
+
+	fmt.Printf("%s: %s\n", kind, poll.Question)
+	for i, answer := range poll.Answers {
+		mark := ""
+		if answer.Correct {
+			mark = " ✓"
+		}
+		percent := 0.0
+		if poll.TotalVoters > 0 {
+			percent = float64(answer.Voters) * 100 / float64(poll.TotalVoters)
+		}
+		fmt.Printf("  %d. %s: %d 票 (%.1f%%)%s\n", i+1, answer.Text, answer.Voters, percent, mark)
+	}
+	fmt.Printf("  共 %d 人参与\n", poll.TotalVoters)
+	if poll.Solution != "" {
+		fmt.Printf("  解析: %s\n", poll.Solution)
+	}
+}
+
+// printMessageReactions 显示消息最近一次记录的回应
+func printMessageReactions(db *database.Database, msg *models.Message) {
+	snapshot, err := db.GetLatestReactionSnapshot(msg.ID)
+	if err != nil || snapshot == nil {
+		fmt.Printf("回应: %d\n", msg.Reactions)
+		return
+	}
+
+	parts := make([]string, 0, len(snapshot.Reactions))
+	for _, reaction := range snapshot.Reactions {
+		emoji := reaction.Emoji
+		if reaction.CustomEmojiID != 0 {
+			emoji = fmt.Sprintf("[自定义表情 %d]", reaction.CustomEmojiID)
+		}
+		parts = append(parts, fmt.Sprintf("%s %d", emoji, reaction.Count))
+	}
+	fmt.Printf("回应: %d (%s)\n", snapshot.Total, strings.Join(parts, ", "))
+}
+
+// describeSender 描述消息的发送者和作者签名，频道自身发布且未签名时为空
+func describeSender(msg *models.Message) string {
+	var parts []string
+	if msg.SenderType != "" {
+		name := msg.SenderName
+		if name == "" {
+			name = fmt.Sprintf("ID %d", msg.SenderID)
+		}
+		if msg.SenderType == models.SenderChannel {
+			name += " (频道)"
+		}
+		parts = append(parts, name)
+	}
+	if msg.PostAuthor != "" {
+		parts = append(parts, "署名 "+msg.PostAuthor)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// replyChainDepth 显示回复链时向上追溯的最大层数
+const replyChainDepth = 3
+
+// printReplyChain 显示消息回复的上级消息
+func printReplyChain(db *database.Database, msg *models.Message) {
+	fmt.Printf("回复: [%d]", msg.ReplyToID)
+	if msg.ThreadID != 0 && msg.ThreadID != msg.ReplyToID {
+		fmt.Printf(" (回复串 [%d])", msg.ThreadID)
+	}
+	fmt.Println()
+
+	chain, err := db.GetReplyChain(msg.ChannelID, msg.TelegramID, replyChainDepth)
+	if err != nil {
+		log.Printf("获取消息 %d 的回复链失败: %v", msg.TelegramID, err)
+		return
+	}
+	for i, parent := range chain {
+		sender := describeSender(parent)
+		if sender == "" {
+			sender = "频道"
+		}
+		text := []rune(strings.ReplaceAll(parent.Text, "\n", " "))
+		if len(text) > 60 {
+			text = append(text[:60], '…')
+		}
+		fmt.Printf("%s↳ [%d] %s: %s\n", strings.Repeat("  ", i+1), parent.TelegramID, sender, string(text))
+	}
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/momaek/tgchannel/internal/auth"
+	"github.com/momaek/tgchannel/internal/database"
+	"github.com/momaek/tgchannel/internal/models"
+	"github.com/momaek/tgchannel/internal/scraper"
+	"github.com/spf13/cobra"
+)
+
+var (
+	globalQuery  string
+	globalSince  string
+	globalUntil  string
+	globalFilter string
+	globalLimit  int
+	globalSave   bool
+	globalList   bool
+	globalRemove int64
+)
+
+// searchGlobalCmd represents the search-global command
+var searchGlobalCmd = &cobra.Command{
+	Use:   "search-global",
+	Short: "在所有公开频道中搜索帖子并保存结果",
+	Long: `通过 Telegram 的全局搜索 (messages.searchGlobal) 查找所有公开频道中匹配关键词的帖子，
+翻页获取所有结果并保存到数据库。群组和私聊中的结果会被跳过。
+结果中之前没有保存过的频道会自动加入 channels 表，之后可以直接使用 fetch --id 抓取。
+
+使用 --since / --until 限定时间范围（开始时间包含、结束时间不包含），
+使用 --filter 只搜索某类消息，可选值: ` + strings.Join(scraper.SearchFilters, ", ") + `。
+保存的消息会记录命中它的关键词，之后可以使用 messages --query 查看。
+
+使用 --save 保存搜索，serve 会按 scraper.saved_search_interval 定期重新执行，
+每次只查找上次执行之后发布的帖子。首次执行只查找 --since 之后的帖子（默认为
+saved_search_interval 之前），最多保存 --limit 条，该范围会记录在保存的搜索中。
+--list 列出保存的搜索，--remove 停用保存的搜索。
+
+示例:
+  tgchannel search-global --query "golang"
+  tgchannel search-global --query "golang" --since 2024-03-01 --limit 200
+  tgchannel search-global --query "golang" --save
+  tgchannel search-global --query "golang" --save --since 2024-03-01 --limit 500
+  tgchannel search-global --list
+  tgchannel search-global --remove 1`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := searchGlobal(); err != nil {
+			log.Fatalf("搜索失败: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(searchGlobalCmd)
+
+	// 添加标志
+	searchGlobalCmd.Flags().StringVarP(&globalQuery, "query", "q", "", "搜索关键词")
+	searchGlobalCmd.Flags().StringVar(&globalSince, "since", "", "开始时间，包含 (例如: 2024-03-01)")
+	searchGlobalCmd.Flags().StringVar(&globalUntil, "until", "", "结束时间，不包含 (例如: 2024-04-01)")
+	searchGlobalCmd.Flags().StringVar(&globalFilter, "filter", "", "只搜索某类消息 (例如: photo、video、document、url)")
+	searchGlobalCmd.Flags().IntVarP(&globalLimit, "limit", "l", 0, "最多保存的消息数量 (默认不限制)")
+	searchGlobalCmd.Flags().BoolVar(&globalSave, "save", false, "保存搜索，由 serve 定期重新执行")
+	searchGlobalCmd.Flags().BoolVar(&globalList, "list", false, "列出保存的搜索")
+	searchGlobalCmd.Flags().Int64Var(&globalRemove, "remove", 0, "停用指定 ID 的保存的搜索")
+
+	searchGlobalCmd.MarkFlagsMutuallyExclusive("query", "list", "remove")
+	// 保存的搜索由 serve 按执行时间增量搜索，--since / --limit 只限定首次执行，不支持结束时间
+	searchGlobalCmd.MarkFlagsMutuallyExclusive("save", "until")
+}
+
+func searchGlobal() error {
+	// 检查参数
+	if globalQuery == "" && !globalList && globalRemove == 0 {
+		return fmt.Errorf("请指定搜索关键词 (--query)、--list 或 --remove")
+	}
+	if globalSave && globalQuery == "" {
+		return fmt.Errorf("--save 需要同时指定搜索关键词 (--query)")
+	}
+	if err := validateSearchFilter(globalFilter); err != nil {
+		return err
+	}
+
+	// 解析时间范围
+	since, err := parseTimeFlag(globalSince)
+	if err != nil {
+		return fmt.Errorf("无效的开始时间: %w", err)
+	}
+	until, err := parseTimeFlag(globalUntil)
+	if err != nil {
+		return fmt.Errorf("无效的结束时间: %w", err)
+	}
+	if !since.IsZero() && !until.IsZero() && !since.Before(until) {
+		return fmt.Errorf("开始时间必须早于结束时间")
+	}
+
+	// 初始化数据库
+	db, err := database.NewDatabase(config.Database.Path)
+	if err != nil {
+		return fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	defer db.Close()
+
+	if globalList {
+		return listSavedSearches(db)
+	}
+	if globalRemove != 0 {
+		if err := db.DeactivateSavedSearch(globalRemove); err != nil {
+			return fmt.Errorf("停用保存的搜索失败: %w", err)
+		}
+		log.Printf("已停用保存的搜索 %d", globalRemove)
+		return nil
+	}
+
+	// 解析 API ID
+	apiID, err := strconv.Atoi(config.Telegram.APIID)
+	if err != nil {
+		return fmt.Errorf("无效的 API ID: %w", err)
+	}
+
+	// 创建认证客户端
+	authClient := auth.NewAuth(apiID, config.Telegram.APIHash, config.Telegram.SessionFile)
+	client := authClient.GetClient()
+
+	// 连接到 Telegram
+	ctx := context.Background()
+	err = client.Run(ctx, func(ctx context.Context) error {
+		scraperClient := scraper.NewScraper(db, client, &config.Scraper)
+
+		var saved int
+		if globalSave {
+			search := &models.SavedSearch{Query: globalQuery, Filter: globalFilter, FirstRunLimit: globalLimit}
+			if !since.IsZero() {
+				search.FirstRunSince = &since
+			}
+			if err := scraperClient.SaveSearch(search); err != nil {
+				return err
+			}
+			log.Printf("已保存搜索 %d: \"%s\"，serve 会定期重新执行", search.ID, search.Query)
+			saved, err = scraperClient.RunSavedSearch(ctx, search)
+		} else {
+			saved, err = scraperClient.SearchGlobal(ctx, scraper.SearchOptions{
+				Query:  globalQuery,
+				Filter: globalFilter,
+				Since:  since,
+				Until:  until,
+				Limit:  globalLimit,
+			})
+		}
+		if err != nil {
+			return err
+		}
+		if saved > 0 {
+			log.Printf("使用 tgchannel messages --query %q 查看搜索结果", globalQuery)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("搜索失败: %w", err)
+	}
+
+	return nil
+}
+
+// listSavedSearches 输出所有启用的保存的搜索
+func listSavedSearches(db *database.Database) error {
+	searches, err := db.GetSavedSearches()
+	if err != nil {
+		return fmt.Errorf("获取保存的搜索失败: %w", err)
+	}
+	if len(searches) == 0 {
+		fmt.Println("没有保存的搜索，使用 search-global --query 关键词 --save 保存")
+		return nil
+	}
+
+	fmt.Printf("共有 %d 个保存的搜索:\n", len(searches))
+	fmt.Println("=" + strings.Repeat("=", 80))
+	fmt.Printf("%-6s %-30s %-12s %-20s %-20s\n", "ID", "关键词", "过滤", "首次执行开始时间", "上次执行")
+	fmt.Println("-" + strings.Repeat("-", 80))
+	for _, search := range searches {
+		filter, firstSince, lastRun := "-", "-", "尚未执行"
+		if search.Filter != "" {
+			filter = search.Filter
+		}
+		if search.FirstRunSince != nil {
+			firstSince = search.FirstRunSince.Local().Format("2006-01-02 15:04:05")
+		}
+		if search.LastRunAt != nil {
+			lastRun = search.LastRunAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-6d %-30s %-12s %-20s %-20s\n", search.ID, truncateString(search.Query, 28), filter, firstSince, lastRun)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/momaek/tgchannel/internal/auth"
+	"github.com/momaek/tgchannel/internal/database"
+	"github.com/momaek/tgchannel/internal/scraper"
+	"github.com/spf13/cobra"
+)
+
+var (
+	searchChannel string
+	searchQuery   string
+	searchSince   string
+	searchUntil   string
+	searchFilter  string
+	searchLimit   int
+	searchJoin    bool
+)
+
+// searchRemoteCmd represents the search-remote command
+var searchRemoteCmd = &cobra.Command{
+	Use:   "search-remote",
+	Short: "在频道内进行服务器端搜索并保存结果",
+	Long: `通过 Telegram 的频道内搜索 (messages.search) 查找匹配关键词的消息，
+翻页获取所有结果并保存到数据库，适合只需要大频道中少量相关消息的场景。
+
+--channel 可以是 Channel ID、@用户名或邀请链接，尚未加入的私有频道需要同时指定 --join。
+使用 --since / --until 限定时间范围（开始时间包含、结束时间不包含），
+使用 --filter 只搜索某类消息，可选值: ` + strings.Join(scraper.SearchFilters, ", ") + `。
+保存的消息会记录命中它的关键词，之后可以使用 messages --query 查看。
+
+示例:
+  tgchannel search-remote --channel @channel_name --query "golang"
+  tgchannel search-remote --channel 1234567890 --query "发布" --since 2024-03-01 --until 2024-04-01
+  tgchannel search-remote --channel @channel_name --query "教程" --filter video --limit 50`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := searchRemote(); err != nil {
+			log.Fatalf("搜索失败: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(searchRemoteCmd)
+
+	// 添加标志
+	searchRemoteCmd.Flags().StringVarP(&searchChannel, "channel", "c", "", "Channel ID、用户名 (例如: @channel_name) 或邀请链接")
+	searchRemoteCmd.Flags().StringVarP(&searchQuery, "query", "q", "", "搜索关键词")
+	searchRemoteCmd.Flags().StringVar(&searchSince, "since", "", "开始时间，包含 (例如: 2024-03-01)")
+	searchRemoteCmd.Flags().StringVar(&searchUntil, "until", "", "结束时间，不包含 (例如: 2024-04-01)")
+	searchRemoteCmd.Flags().StringVar(&searchFilter, "filter", "", "只搜索某类消息 (例如: photo、video、document、url)")
+	searchRemoteCmd.Flags().IntVarP(&searchLimit, "limit", "l", 0, "最多保存的消息数量 (默认不限制)")
+	searchRemoteCmd.Flags().BoolVar(&searchJoin, "join", false, "通过邀请链接加入尚未加入的私有频道")
+	searchRemoteCmd.MarkFlagRequired("channel")
+	searchRemoteCmd.MarkFlagRequired("query")
+}
+
+func searchRemote() error {
+	if err := validateSearchFilter(searchFilter); err != nil {
+		return err
+	}
+
+	// 解析时间范围
+	since, err := parseTimeFlag(searchSince)
+	if err != nil {
+		return fmt.Errorf("无效的开始时间: %w", err)
+	}
+	until, err := parseTimeFlag(searchUntil)
+	if err != nil {
+		return fmt.Errorf("无效的结束时间: %w", err)
+	}
+	if !since.IsZero() && !until.IsZero() && !since.Before(until) {
+		return fmt.Errorf("开始时间必须早于结束时间")
+	}
+
+	// 初始化数据库
+	db, err := database.NewDatabase(config.Database.Path)
+	if err != nil {
+		return fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	defer db.Close()
+
+	// 解析 API ID
+	apiID, err := strconv.Atoi(config.Telegram.APIID)
+	if err != nil {
+		return fmt.Errorf("无效的 API ID: %w", err)
+	}
+
+	// 创建认证客户端
+	authClient := auth.NewAuth(apiID, config.Telegram.APIHash, config.Telegram.SessionFile)
+	client := authClient.GetClient()
+
+	// 连接到 Telegram
+	ctx := context.Background()
+	err = client.Run(ctx, func(ctx context.Context) error {
+		scraperClient := scraper.NewScraper(db, client, &config.Scraper)
+
+		channel, err := scraperClient.ChannelInfo(ctx, parseChannelTarget(searchChannel), searchJoin)
+		if err != nil {
+			return fmt.Errorf("获取频道信息失败: %w", err)
+		}
+
+		saved, err := scraperClient.SearchChannel(ctx, channel, scraper.SearchOptions{
+			Query:  searchQuery,
+			Filter: searchFilter,
+			Since:  since,
+			Until:  until,
+			Limit:  searchLimit,
+		})
+		if err != nil {
+			return err
+		}
+		if saved > 0 {
+			log.Printf("使用 tgchannel messages --id %d --query %q 查看搜索结果", channel.TelegramID, searchQuery)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("搜索失败: %w", err)
+	}
+
+	return nil
+}
+
+// validateSearchFilter 校验搜索的过滤类型，为空表示不过滤
+func validateSearchFilter(filter string) error {
+	if filter == "" {
+		return nil
+	}
+	for _, name := range scraper.SearchFilters {
+		if filter == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("不支持的过滤类型 %q，可选值: %s", filter, strings.Join(scraper.SearchFilters, ", "))
+}
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"syscall"
 
+	"github.com/gotd/td/tg"
 	"github.com/momaek/tgchannel/internal/auth"
 	"github.com/momaek/tgchannel/internal/database"
 	"github.com/momaek/tgchannel/internal/scraper"
@@ -21,8 +22,9 @@ var serveCmd = &cobra.Command{
 	Short: "启动监听服务",
 	Long: `启动监听服务，持续监控订阅的 Channel 更新。
 
-服务会定期检查订阅的 Channel 是否有新消息，
-并自动保存到数据库中。`,
+服务通过 Telegram 推送的更新实时接收新消息、编辑和删除，
+并自动保存到数据库中；长时间没有推送的 Channel 会定期轮询作为兜底。
+search-global --save 保存的全局搜索会按 scraper.saved_search_interval 定期重新执行。`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := serve(); err != nil {
 			log.Fatalf("服务启动失败: %v", err)
@@ -48,9 +50,10 @@ func serve() error {
 		return fmt.Errorf("无效的 API ID: %w", err)
 	}
 
-	// 创建认证客户端
+	// 创建认证客户端，注册更新分发器以接收频道推送
+	dispatcher := tg.NewUpdateDispatcher()
 	authClient := auth.NewAuth(apiID, config.Telegram.APIHash, config.Telegram.SessionFile)
-	client := authClient.GetClient()
+	client := authClient.GetClientWithUpdates(dispatcher)
 
 	// 创建上下文，支持优雅关闭
 	ctx, cancel := context.WithCancel(context.Background())
@@ -69,7 +72,8 @@ func serve() error {
 	// 连接到 Telegram
 	err = client.Run(ctx, func(ctx context.Context) error {
 		// 创建爬虫实例
-		scraperClient := scraper.NewScraper(db, client.API(), &config.Scraper)
+		scraperClient := scraper.NewScraper(db, client, &config.Scraper)
+		scraperClient.RegisterUpdateHandlers(dispatcher)
 
 		log.Println("启动监听服务...")
 		log.Println("按 Ctrl+C 停止服务")
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/momaek/tgchannel/internal/database"
+	"github.com/momaek/tgchannel/internal/models"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsChannelID   int64
+	statsChannelName string
+	statsDays        int
+)
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "查看频道的增长统计",
+	Long: `根据 serve 定期记录的统计快照，显示频道在指定天数内的成员数、在线人数、
+发帖频率和平均浏览数的变化，每天显示当天最后一次快照。
+群组还会显示指定天数内的成员加入/退出次数和最近一次成员快照 (fetch --participants) 中的管理员。
+
+示例:
+  tgchannel stats --id 1234567890
+  tgchannel stats --name @channel_name --days 90`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := showChannelStats(); err != nil {
+			log.Fatalf("查看统计失败: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+
+	// 添加标志
+	statsCmd.Flags().Int64VarP(&statsChannelID, "id", "i", 0, "Channel ID")
+	statsCmd.Flags().StringVarP(&statsChannelName, "name", "n", "", "Channel 用户名")
+	statsCmd.Flags().IntVarP(&statsDays, "days", "d", 30, "统计最近的天数")
+}
+
+func showChannelStats() error {
+	if statsChannelID == 0 && statsChannelName == "" {
+		return fmt.Errorf("请指定 Channel ID 或用户名")
+	}
+	if statsDays <= 0 {
+		return fmt.Errorf("天数必须大于 0")
+	}
+
+	// 初始化数据库
+	db, err := database.NewDatabase(config.Database.Path)
+	if err != nil {
+		return fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	defer db.Close()
+
+	var channel *models.Channel
+	if statsChannelID != 0 {
+		channel, err = db.GetChannelByTelegramID(statsChannelID)
+	} else {
+		channel, err = db.GetChannelByUsername(statsChannelName)
+	}
+	if err != nil {
+		return fmt.Errorf("获取频道失败: %w", err)
+	}
+
+	printChannelProfile(db, channel)
+	if channel.IsGroup() {
+		printGroupMembers(db, channel)
+	}
+
+	snapshots, err := db.GetChannelSnapshots(channel.ID, time.Now().AddDate(0, 0, -statsDays))
+	if err != nil {
+		return fmt.Errorf("获取统计快照失败: %w", err)
+	}
+	if len(snapshots) == 0 {
+		fmt.Printf("\n最近 %d 天没有统计快照，运行 serve 后会定期记录\n", statsDays)
+		return nil
+	}
+
+	fmt.Printf("\n最近 %d 天的统计:\n", statsDays)
+	fmt.Println("=" + strings.Repeat("=", 70))
+	fmt.Printf("%-12s %-12s %-10s %-10s %-12s %-12s\n", "日期", "成员", "变化", "在线", "每天帖子", "平均浏览")
+	fmt.Println("-" + strings.Repeat("-", 70))
+
+	var previous *models.ChannelSnapshot
+	for _, snapshot := range dailySnapshots(snapshots) {
+		change := ""
+		if previous != nil {
+			change = fmt.Sprintf("%+d", snapshot.MemberCount-previous.MemberCount)
+		}
+		fmt.Printf("%-12s %-12d %-10s %-10d %-12.1f %-12.0f\n",
+			snapshot.CapturedAt.Local().Format("2006-01-02"),
+			snapshot.MemberCount,
+			change,
+			snapshot.OnlineCount,
+			snapshot.PostsPerDay,
+			snapshot.AvgViews)
+		previous = snapshot
+	}
+	fmt.Println("=" + strings.Repeat("=", 70))
+
+	first, last := snapshots[0], snapshots[len(snapshots)-1]
+	growth := last.MemberCount - first.MemberCount
+	fmt.Printf("成员: %d -> %d (%+d", first.MemberCount, last.MemberCount, growth)
+	if first.MemberCount > 0 {
+		fmt.Printf(", %+.2f%%", float64(growth)*100/float64(first.MemberCount))
+	}
+	fmt.Println(")")
+	if days := last.CapturedAt.Sub(first.CapturedAt).Hours() / 24; days >= 1 {
+		fmt.Printf("平均每天增长: %+.1f\n", float64(growth)/days)
+	}
+	fmt.Printf("平均浏览: %.0f -> %.0f\n", first.AvgViews, last.AvgViews)
+	return nil
+}
+
+// printChannelProfile 显示频道的基本信息和完整信息
+func printChannelProfile(db *database.Database, channel *models.Channel) {
+	fmt.Printf("频道: %s", channel.Title)
+	if channel.Username != "" {
+		fmt.Printf(" (@%s)", channel.Username)
+	}
+	fmt.Printf("\n成员: %d\n", channel.MemberCount)
+
+	if channel.ProfileUpdatedAt == nil {
+		return
+	}
+	if channel.Description != "" {
+		fmt.Printf("简介: %s\n", channel.Description)
+	}
+	if channel.TelegramCreatedAt != nil {
+		fmt.Printf("创建时间: %s\n", channel.TelegramCreatedAt.Local().Format("2006-01-02"))
+	}
+	if channel.LinkedChatID != 0 {
+		linked := fmt.Sprintf("%d", channel.LinkedChatID)
+		if chat, err := db.GetChannelByTelegramID(channel.LinkedChatID); err == nil {
+			linked = fmt.Sprintf("%s (%d)", chat.Title, chat.TelegramID)
+		}
+		fmt.Printf("讨论组: %s\n", linked)
+	}
+	if channel.PinnedMessageID != 0 {
+		fmt.Printf("置顶消息: %d\n", channel.PinnedMessageID)
+	}
+	if channel.SlowModeSeconds > 0 {
+		fmt.Printf("慢速模式: %d 秒\n", channel.SlowModeSeconds)
+	}
+	fmt.Printf("信息更新于: %s\n", channel.ProfileUpdatedAt.Local().Format("2006-01-02 15:04:05"))
+}
+
+// printGroupMembers 显示群组最近的成员变动和最近一次成员快照
+func printGroupMembers(db *database.Database, channel *models.Channel) {
+	counts, err := db.CountMemberEvents(channel.ID, time.Now().AddDate(0, 0, -statsDays))
+	if err != nil {
+		log.Printf("统计成员变动失败: %v", err)
+	} else {
+		fmt.Printf("\n最近 %d 天成员变动: 加入 %d，被拉入 %d，退出 %d，被移出 %d\n", statsDays,
+			counts[models.MemberJoined], counts[models.MemberAdded],
+			counts[models.MemberLeft], counts[models.MemberRemoved])
+	}
+
+	snapshot, err := db.GetLatestParticipantSnapshot(channel.ID)
+	if err != nil {
+		log.Printf("获取成员快照失败: %v", err)
+		return
+	}
+	if snapshot == nil {
+		fmt.Println("还没有成员快照，可使用 fetch --participants 记录")
+		return
+	}
+
+	roles := make(map[string]int)
+	var admins []string
+	for _, p := range snapshot.Participants {
+		roles[p.Role]++
+		if p.Role != models.RoleCreator && p.Role != models.RoleAdmin {
+			continue
+		}
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprintf("ID %d", p.UserID)
+		}
+		if p.Rank != "" {
+			name += " (" + p.Rank + ")"
+		}
+		if p.Role == models.RoleCreator {
+			name += " [创建者]"
+		}
+		admins = append(admins, name)
+	}
+	fmt.Printf("成员快照 (%s): 共 %d 人，获取到 %d 人，管理员 %d 人，受限 %d 人\n",
+		snapshot.CapturedAt.Local().Format("2006-01-02 15:04"), snapshot.Total, len(snapshot.Participants),
+		roles[models.RoleCreator]+roles[models.RoleAdmin], roles[models.RoleBanned])
+	if len(admins) > 0 {
+		fmt.Printf("管理员: %s\n", strings.Join(admins, ", "))
+	}
+}
+
+// dailySnapshots 每天只保留最后一次快照
+func dailySnapshots(snapshots []*models.ChannelSnapshot) []*models.ChannelSnapshot {
+	var result []*models.ChannelSnapshot
+	for _, snapshot := range snapshots {
+		day := snapshot.CapturedAt.Local().Format("2006-01-02")
+		if n := len(result); n > 0 && result[n-1].CapturedAt.Local().Format("2006-01-02") == day {
+			result[n-1] = snapshot
+			continue
+		}
+		result = append(result, snapshot)
+	}
+	return result
+}
@@ -16,6 +16,7 @@ import (
 var (
 	channelUsername string
 	userUsername    string
+	subscribeJoin   bool
 )
 
 // subscribeCmd represents the subscribe command
@@ -24,6 +25,9 @@ var subscribeCmd = &cobra.Command{
 	Short: "订阅 Telegram Channel",
 	Long: `订阅指定的 Telegram Channel。
 
+--channel 可以是频道用户名，也可以是私有频道的邀请链接 (t.me/+hash 或 t.me/joinchat/hash)，
+尚未加入的私有频道需要同时指定 --join 通过邀请链接加入。
+
 订阅后，系统会自动抓取该 Channel 的历史消息，
 并在有新消息时自动保存到数据库。`,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -37,8 +41,9 @@ func init() {
 	rootCmd.AddCommand(subscribeCmd)
 
 	// 添加标志
-	subscribeCmd.Flags().StringVarP(&channelUsername, "channel", "c", "", "Channel 用户名 (例如: @channel_name)")
+	subscribeCmd.Flags().StringVarP(&channelUsername, "channel", "c", "", "Channel 用户名 (例如: @channel_name) 或邀请链接")
 	subscribeCmd.Flags().StringVarP(&userUsername, "user", "u", "", "用户用户名")
+	subscribeCmd.Flags().BoolVar(&subscribeJoin, "join", false, "通过邀请链接加入尚未加入的私有频道")
 	subscribeCmd.MarkFlagRequired("channel")
 	subscribeCmd.MarkFlagRequired("user")
 }
@@ -78,10 +83,15 @@ func subscribe() error {
 	ctx := context.Background()
 	err = client.Run(ctx, func(ctx context.Context) error {
 		// 创建爬虫实例
-		scraperClient := scraper.NewScraper(db, client.API(), &config.Scraper)
-
-		// 获取频道信息
-		channel, err := scraperClient.FetchChannelInfo(ctx, channelUsername)
+		scraperClient := scraper.NewScraper(db, client, &config.Scraper)
+
+		// 获取频道信息，邀请链接指向的私有频道会保存 access hash
+		var channel *models.Channel
+		if _, ok := scraper.InviteHash(channelUsername); ok {
+			channel, err = scraperClient.FetchChannelInfoByInvite(ctx, channelUsername, subscribeJoin)
+		} else {
+			channel, err = scraperClient.FetchChannelInfo(ctx, channelUsername)
+		}
 		if err != nil {
 			return fmt.Errorf("获取频道信息失败: %w", err)
 		}
@@ -97,7 +107,11 @@ func subscribe() error {
 			return fmt.Errorf("创建订阅失败: %w", err)
 		}
 
-		log.Printf("成功订阅频道: %s (@%s)", channel.Title, channel.Username)
+		if channel.Username != "" {
+			log.Printf("成功订阅频道: %s (@%s)", channel.Title, channel.Username)
+		} else {
+			log.Printf("成功订阅频道: %s (ID: %d)", channel.Title, channel.TelegramID)
+		}
 		return nil
 	})
 
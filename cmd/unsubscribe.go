@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/momaek/tgchannel/internal/database"
+	"github.com/momaek/tgchannel/internal/models"
+	"github.com/momaek/tgchannel/internal/scraper"
+	"github.com/spf13/cobra"
+)
+
+var (
+	unsubscribeChannel string
+	unsubscribeUser    string
+)
+
+// unsubscribeCmd represents the unsubscribe command
+var unsubscribeCmd = &cobra.Command{
+	Use:   "unsubscribe",
+	Short: "取消订阅 Telegram Channel",
+	Long: `取消指定用户对 Channel 的订阅。
+
+--channel 与 subscribe 相同，可以是 Channel ID、@用户名或订阅时使用的邀请链接，
+只在本地数据库中查找频道，不需要连接 Telegram。
+
+订阅记录和已抓取的消息会保留，正在运行的 serve 会在下次刷新订阅时停止监听该 Channel。`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := unsubscribe(); err != nil {
+			log.Fatalf("取消订阅失败: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(unsubscribeCmd)
+
+	// 添加标志
+	unsubscribeCmd.Flags().StringVarP(&unsubscribeChannel, "channel", "c", "", "Channel ID、用户名 (例如: @channel_name) 或邀请链接")
+	unsubscribeCmd.Flags().StringVarP(&unsubscribeUser, "user", "u", "", "用户用户名")
+	unsubscribeCmd.MarkFlagRequired("channel")
+	unsubscribeCmd.MarkFlagRequired("user")
+}
+
+func unsubscribe() error {
+	// 初始化数据库
+	db, err := database.NewDatabase(config.Database.Path)
+	if err != nil {
+		return fmt.Errorf("初始化数据库失败: %w", err)
+	}
+	defer db.Close()
+
+	user, err := db.GetUserByUsername(unsubscribeUser)
+	if err != nil {
+		return fmt.Errorf("用户不存在: %w", err)
+	}
+
+	channel, err := storedChannel(db, parseChannelTarget(unsubscribeChannel))
+	if err != nil {
+		return err
+	}
+
+	if err := db.DeactivateSubscription(user.ID, channel.ID); err != nil {
+		return fmt.Errorf("取消订阅失败: %w", err)
+	}
+
+	if channel.Username != "" {
+		log.Printf("已取消订阅频道: %s (@%s)", channel.Title, channel.Username)
+	} else {
+		log.Printf("已取消订阅频道: %s (ID: %d)", channel.Title, channel.TelegramID)
+	}
+	return nil
+}
+
+// storedChannel 在数据库中查找 Channel ID、用户名或邀请链接对应的频道
+func storedChannel(db *database.Database, target scraper.ChannelTarget) (*models.Channel, error) {
+	if target.TelegramID != 0 {
+		channel, err := db.GetChannelByTelegramID(target.TelegramID)
+		if err != nil {
+			return nil, fmt.Errorf("频道不存在: %w", err)
+		}
+		return channel, nil
+	}
+	if target.InviteLink != "" {
+		hash, _ := scraper.InviteHash(target.InviteLink)
+		channel, err := db.GetChannelByInviteHash(hash)
+		if err != nil {
+			return nil, fmt.Errorf("未找到邀请链接对应的频道，可以改用 Channel ID: %w", err)
+		}
+		return channel, nil
+	}
+	channel, err := db.GetChannelByUsername(target.Username)
+	if err != nil {
+		return nil, fmt.Errorf("频道不存在: %w", err)
+	}
+	return channel, nil
+}
@@ -101,3 +101,11 @@ func (a *Auth) GetClient() *telegram.Client {
 		SessionStorage: &session.FileStorage{Path: a.sessionFile},
 	})
 }
+
+// GetClientWithUpdates 获取注册了更新处理器的 Telegram 客户端
+func (a *Auth) GetClientWithUpdates(handler telegram.UpdateHandler) *telegram.Client {
+	return telegram.NewClient(a.apiID, a.apiHash, telegram.Options{
+		SessionStorage: &session.FileStorage{Path: a.sessionFile},
+		UpdateHandler:  handler,
+	})
+}
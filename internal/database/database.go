@@ -2,8 +2,10 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -16,7 +18,8 @@ type Database struct {
 
 // NewDatabase 创建新的数据库连接
 func NewDatabase(dbPath string) (*Database, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	// serve 的各个频道和并发抓取的 worker 会同时写入，遇到锁时等待而不是立即失败
+	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=10000")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -46,6 +49,7 @@ func (d *Database) InitTables() error {
 		`CREATE TABLE IF NOT EXISTS channels (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			telegram_id INTEGER UNIQUE,
+			access_hash INTEGER DEFAULT 0,
 			username TEXT UNIQUE,
 			title TEXT,
 			description TEXT,
@@ -77,12 +81,214 @@ func (d *Database) InitTables() error {
 			views INTEGER DEFAULT 0,
 			forwards INTEGER DEFAULT 0,
 			replies INTEGER DEFAULT 0,
+			reactions INTEGER DEFAULT 0,
+			grouped_id INTEGER DEFAULT 0,
 			date DATETIME,
+			edit_date DATETIME,
+			deleted_at DATETIME,
+			fwd_from_type TEXT,
+			fwd_from_id INTEGER,
+			fwd_from_name TEXT,
+			fwd_message_id INTEGER,
+			fwd_date DATETIME,
+			fwd_post_author TEXT,
+			fwd_imported BOOLEAN,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (channel_id) REFERENCES channels (id),
 			UNIQUE(telegram_id, channel_id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS reaction_snapshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER,
+			total INTEGER DEFAULT 0,
+			captured_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (message_id) REFERENCES messages (id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_reaction_snapshots_message ON reaction_snapshots (message_id)`,
+		`CREATE TABLE IF NOT EXISTS reaction_counts (
+			snapshot_id INTEGER,
+			emoji TEXT,
+			custom_emoji_id INTEGER DEFAULT 0,
+			count INTEGER DEFAULT 0,
+			FOREIGN KEY (snapshot_id) REFERENCES reaction_snapshots (id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_reaction_counts_snapshot ON reaction_counts (snapshot_id)`,
+		`CREATE TABLE IF NOT EXISTS channel_snapshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			channel_id INTEGER,
+			member_count INTEGER DEFAULT 0,
+			online_count INTEGER DEFAULT 0,
+			posts_per_day REAL DEFAULT 0,
+			avg_views REAL DEFAULT 0,
+			captured_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (channel_id) REFERENCES channels (id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_channel_snapshots_channel ON channel_snapshots (channel_id, captured_at)`,
+		`CREATE TABLE IF NOT EXISTS polls (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER UNIQUE,
+			telegram_id INTEGER,
+			question TEXT,
+			quiz BOOLEAN DEFAULT 0,
+			multiple_choice BOOLEAN DEFAULT 0,
+			public_voters BOOLEAN DEFAULT 0,
+			closed BOOLEAN DEFAULT 0,
+			close_date DATETIME,
+			total_voters INTEGER DEFAULT 0,
+			solution TEXT,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (message_id) REFERENCES messages (id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_polls_telegram ON polls (telegram_id)`,
+		`CREATE TABLE IF NOT EXISTS poll_answers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			poll_id INTEGER,
+			position INTEGER,
+			option TEXT,
+			text TEXT,
+			voters INTEGER DEFAULT 0,
+			correct BOOLEAN DEFAULT 0,
+			FOREIGN KEY (poll_id) REFERENCES polls (id),
+			UNIQUE(poll_id, option)
+		)`,
+		`CREATE TABLE IF NOT EXISTS message_versions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER,
+			version INTEGER,
+			text TEXT,
+			media_type TEXT,
+			media_url TEXT,
+			edit_date DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (message_id) REFERENCES messages (id),
+			UNIQUE(message_id, version)
+		)`,
+		`CREATE TABLE IF NOT EXISTS comments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER,
+			chat_id INTEGER,
+			telegram_id INTEGER,
+			author_id INTEGER DEFAULT 0,
+			author_name TEXT,
+			text TEXT,
+			reply_to_id INTEGER DEFAULT 0,
+			date DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (message_id) REFERENCES messages (id),
+			UNIQUE(chat_id, telegram_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_message ON comments (message_id)`,
+		`CREATE TABLE IF NOT EXISTS member_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			channel_id INTEGER,
+			message_id INTEGER,
+			user_id INTEGER,
+			actor_id INTEGER DEFAULT 0,
+			action TEXT,
+			date DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (channel_id) REFERENCES channels (id),
+			UNIQUE(channel_id, message_id, user_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_member_events_channel ON member_events (channel_id, date)`,
+		`CREATE TABLE IF NOT EXISTS participant_snapshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			channel_id INTEGER,
+			total INTEGER DEFAULT 0,
+			captured_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (channel_id) REFERENCES channels (id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_participant_snapshots_channel ON participant_snapshots (channel_id, captured_at)`,
+		`CREATE TABLE IF NOT EXISTS participants (
+			snapshot_id INTEGER,
+			user_id INTEGER,
+			role TEXT,
+			rank TEXT,
+			inviter_id INTEGER DEFAULT 0,
+			joined_at DATETIME,
+			FOREIGN KEY (snapshot_id) REFERENCES participant_snapshots (id),
+			UNIQUE(snapshot_id, user_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS senders (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			peer_type TEXT,
+			telegram_id INTEGER,
+			name TEXT,
+			username TEXT,
+			first_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(peer_type, telegram_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS message_entities (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER,
+			type TEXT,
+			offset INTEGER,
+			length INTEGER,
+			text TEXT,
+			url TEXT,
+			user_id INTEGER DEFAULT 0,
+			language TEXT,
+			custom_emoji_id INTEGER DEFAULT 0,
+			FOREIGN KEY (message_id) REFERENCES messages (id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_entities_message ON message_entities (message_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_entities_type_text ON message_entities (type, text)`,
+		`CREATE TABLE IF NOT EXISTS media (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER,
+			media_type TEXT,
+			file_id INTEGER,
+			file_name TEXT,
+			mime_type TEXT,
+			size INTEGER DEFAULT 0,
+			width INTEGER DEFAULT 0,
+			height INTEGER DEFAULT 0,
+			sha256 TEXT,
+			local_path TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (message_id) REFERENCES messages (id),
+			UNIQUE(message_id, file_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_media_file ON media (media_type, file_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_media_sha256 ON media (sha256)`,
+		`CREATE TABLE IF NOT EXISTS search_hits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER,
+			query TEXT,
+			first_found_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			last_found_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (message_id) REFERENCES messages (id),
+			UNIQUE(message_id, query)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_search_hits_query ON search_hits (query)`,
+		`CREATE TABLE IF NOT EXISTS saved_searches (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			query TEXT,
+			filter TEXT DEFAULT '',
+			is_active BOOLEAN DEFAULT 1,
+			first_run_since DATETIME,
+			first_run_limit INTEGER DEFAULT 0,
+			last_run_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(query, filter)
+		)`,
+		`CREATE TABLE IF NOT EXISTS request_waits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			method TEXT,
+			reason TEXT,
+			error TEXT,
+			wait_seconds INTEGER DEFAULT 0,
+			attempt INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS channel_states (
+			channel_id INTEGER PRIMARY KEY,
+			pts INTEGER DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (channel_id) REFERENCES channels (id)
+		)`,
 	}
 
 	for _, query := range queries {
@@ -91,10 +297,101 @@ func (d *Database) InitTables() error {
 		}
 	}
 
+	if err := d.migrate(); err != nil {
+		return fmt.Errorf("failed to migrate tables: %w", err)
+	}
+
 	log.Println("数据库表初始化完成")
 	return nil
 }
 
+// migrate 为旧版本数据库补齐新增的列
+func (d *Database) migrate() error {
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"channels", "access_hash", "INTEGER DEFAULT 0"},
+		{"channels", "linked_chat_id", "INTEGER DEFAULT 0"},
+		{"channels", "pinned_message_id", "INTEGER DEFAULT 0"},
+		{"channels", "slow_mode_seconds", "INTEGER DEFAULT 0"},
+		{"channels", "telegram_created_at", "DATETIME"},
+		{"channels", "profile_updated_at", "DATETIME"},
+		{"channels", "kind", "TEXT"},
+		{"channels", "invite_hash", "TEXT"},
+		{"messages", "edit_date", "DATETIME"},
+		{"messages", "deleted_at", "DATETIME"},
+		{"messages", "fwd_from_type", "TEXT"},
+		{"messages", "fwd_from_id", "INTEGER"},
+		{"messages", "fwd_from_name", "TEXT"},
+		{"messages", "fwd_message_id", "INTEGER"},
+		{"messages", "fwd_date", "DATETIME"},
+		{"messages", "fwd_post_author", "TEXT"},
+		{"messages", "fwd_imported", "BOOLEAN"},
+		{"messages", "grouped_id", "INTEGER DEFAULT 0"},
+		{"messages", "reactions", "INTEGER DEFAULT 0"},
+		{"messages", "sender_type", "TEXT"},
+		{"messages", "post_author", "TEXT"},
+		{"messages", "reply_to_id", "INTEGER DEFAULT 0"},
+		{"messages", "thread_id", "INTEGER DEFAULT 0"},
+	}
+
+	for _, c := range columns {
+		if err := d.addColumnIfNotExists(c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	// 依赖新增列的索引需要在补齐列之后创建
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_messages_fwd_from ON messages (channel_id, fwd_from_type, fwd_from_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_grouped ON messages (channel_id, grouped_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_reply ON messages (channel_id, reply_to_id)`,
+	}
+	for _, query := range indexes {
+		if _, err := d.db.Exec(query); err != nil {
+			return fmt.Errorf("failed to create index: %w", err)
+		}
+	}
+	return nil
+}
+
+// addColumnIfNotExists 当表中不存在指定列时添加该列
+func (d *Database) addColumnIfNotExists(table, column, definition string) error {
+	rows, err := d.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to query table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return fmt.Errorf("failed to scan table info: %w", err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read table info: %w", err)
+	}
+
+	query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)
+	if _, err := d.db.Exec(query); err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
 // CreateUser 创建用户
 func (d *Database) CreateUser(user *models.User) error {
 	query := `INSERT INTO users (username, phone) VALUES (?, ?)`
@@ -128,11 +425,48 @@ func (d *Database) GetUserByUsername(username string) (*models.User, error) {
 	return user, nil
 }
 
+// channelColumns channels 表的查询列，与 scanChannel 的字段顺序保持一致
+const channelColumns = `id, telegram_id, access_hash, COALESCE(username, ''), title, COALESCE(description, ''),
+			  member_count, is_active, created_at, updated_at, linked_chat_id, pinned_message_id,
+			  slow_mode_seconds, telegram_created_at, profile_updated_at, COALESCE(kind, '')`
+
+// rowScanner 兼容 *sql.Row 和 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanChannel 扫描一行频道数据
+func scanChannel(row rowScanner) (*models.Channel, error) {
+	channel := &models.Channel{}
+	var telegramCreatedAt, profileUpdatedAt sql.NullTime
+	err := row.Scan(
+		&channel.ID, &channel.TelegramID, &channel.AccessHash, &channel.Username,
+		&channel.Title, &channel.Description, &channel.MemberCount, &channel.IsActive,
+		&channel.CreatedAt, &channel.UpdatedAt, &channel.LinkedChatID, &channel.PinnedMessageID,
+		&channel.SlowModeSeconds, &telegramCreatedAt, &profileUpdatedAt, &channel.Kind,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if telegramCreatedAt.Valid {
+		channel.TelegramCreatedAt = &telegramCreatedAt.Time
+	}
+	if profileUpdatedAt.Valid {
+		channel.ProfileUpdatedAt = &profileUpdatedAt.Time
+	}
+	return channel, nil
+}
+
+// nullString 将空字符串转换为 NULL，避免多个无用户名的频道触发 UNIQUE 约束
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
 // CreateChannel 创建频道
 func (d *Database) CreateChannel(channel *models.Channel) error {
-	query := `INSERT INTO channels (telegram_id, username, title, description, member_count) 
-			  VALUES (?, ?, ?, ?, ?)`
-	result, err := d.db.Exec(query, channel.TelegramID, channel.Username,
+	query := `INSERT INTO channels (telegram_id, access_hash, username, title, description, member_count) 
+			  VALUES (?, ?, ?, ?, ?, ?)`
+	result, err := d.db.Exec(query, channel.TelegramID, channel.AccessHash, nullString(channel.Username),
 		channel.Title, channel.Description, channel.MemberCount)
 	if err != nil {
 		return fmt.Errorf("failed to create channel: %w", err)
@@ -150,16 +484,96 @@ func (d *Database) CreateChannel(channel *models.Channel) error {
 	return nil
 }
 
+// SaveChannel 创建或更新频道，按 telegram_id 去重，并刷新 access hash 和最近一次看到的用户名
+//
+// is_active 只在创建时写入，已存在的频道保留原来的状态。
+func (d *Database) SaveChannel(channel *models.Channel) error {
+	// 用户名可能已经被其他频道占用（频道改名后被别人注册），先释放旧记录上的用户名
+	if channel.Username != "" {
+		_, err := d.db.Exec(`UPDATE channels SET username = NULL, updated_at = CURRENT_TIMESTAMP 
+			  WHERE username = ? AND telegram_id != ?`, channel.Username, channel.TelegramID)
+		if err != nil {
+			return fmt.Errorf("failed to release channel username: %w", err)
+		}
+	}
+
+	query := `INSERT INTO channels (telegram_id, access_hash, username, title, description, member_count, kind, is_active) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			  ON CONFLICT(telegram_id) DO UPDATE SET
+			  access_hash = CASE WHEN excluded.access_hash != 0 THEN excluded.access_hash ELSE channels.access_hash END,
+			  username = excluded.username,
+			  title = excluded.title,
+			  kind = CASE WHEN excluded.kind != '' THEN excluded.kind ELSE channels.kind END,
+			  description = CASE WHEN excluded.description != '' THEN excluded.description ELSE channels.description END,
+			  member_count = CASE WHEN excluded.member_count > 0 THEN excluded.member_count ELSE channels.member_count END,
+			  updated_at = CURRENT_TIMESTAMP`
+	_, err := d.db.Exec(query, channel.TelegramID, channel.AccessHash, nullString(channel.Username),
+		channel.Title, channel.Description, channel.MemberCount, channel.Kind, channel.IsActive)
+	if err != nil {
+		return fmt.Errorf("failed to save channel: %w", err)
+	}
+
+	saved, err := d.GetChannelByTelegramID(channel.TelegramID)
+	if err != nil {
+		return err
+	}
+	*channel = *saved
+
+	return nil
+}
+
+// ActivateChannel 将频道标记为活跃，用于用户明确获取或订阅的频道
+func (d *Database) ActivateChannel(telegramID int64) error {
+	_, err := d.db.Exec(`UPDATE channels SET is_active = 1, updated_at = CURRENT_TIMESTAMP 
+			  WHERE telegram_id = ? AND is_active = 0`, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to activate channel: %w", err)
+	}
+	return nil
+}
+
+// UpdateChannelProfile 保存从完整频道信息中获取的简介、成员数、关联讨论组、置顶消息、慢速模式和创建时间
+func (d *Database) UpdateChannelProfile(channel *models.Channel) error {
+	now := time.Now()
+	query := `UPDATE channels SET description = ?, 
+			  member_count = CASE WHEN ? > 0 THEN ? ELSE member_count END, 
+			  linked_chat_id = ?, pinned_message_id = ?, slow_mode_seconds = ?, 
+			  telegram_created_at = COALESCE(?, telegram_created_at), profile_updated_at = ?, 
+			  updated_at = CURRENT_TIMESTAMP 
+			  WHERE id = ?`
+	_, err := d.db.Exec(query, channel.Description, channel.MemberCount, channel.MemberCount,
+		channel.LinkedChatID, channel.PinnedMessageID, channel.SlowModeSeconds,
+		channel.TelegramCreatedAt, now, channel.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update channel profile: %w", err)
+	}
+	channel.ProfileUpdatedAt = &now
+	return nil
+}
+
 // GetChannelByUsername 根据用户名获取频道
 func (d *Database) GetChannelByUsername(username string) (*models.Channel, error) {
-	query := `SELECT id, telegram_id, username, title, description, member_count, 
-			  is_active, created_at, updated_at FROM channels WHERE username = ?`
-	channel := &models.Channel{}
-	err := d.db.QueryRow(query, username).Scan(
-		&channel.ID, &channel.TelegramID, &channel.Username, &channel.Title,
-		&channel.Description, &channel.MemberCount, &channel.IsActive,
-		&channel.CreatedAt, &channel.UpdatedAt,
-	)
+	query := `SELECT ` + channelColumns + ` FROM channels WHERE username = ? COLLATE NOCASE`
+	channel, err := scanChannel(d.db.QueryRow(query, strings.TrimPrefix(username, "@")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+	return channel, nil
+}
+
+// SetChannelInviteHash 记录加入私有频道时使用的邀请链接 hash
+func (d *Database) SetChannelInviteHash(telegramID int64, hash string) error {
+	_, err := d.db.Exec(`UPDATE channels SET invite_hash = ? WHERE telegram_id = ?`, hash, telegramID)
+	if err != nil {
+		return fmt.Errorf("failed to set channel invite hash: %w", err)
+	}
+	return nil
+}
+
+// GetChannelByInviteHash 根据邀请链接 hash 获取频道，hash 区分大小写
+func (d *Database) GetChannelByInviteHash(hash string) (*models.Channel, error) {
+	query := `SELECT ` + channelColumns + ` FROM channels WHERE invite_hash = ?`
+	channel, err := scanChannel(d.db.QueryRow(query, hash))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get channel: %w", err)
 	}
@@ -168,47 +582,61 @@ func (d *Database) GetChannelByUsername(username string) (*models.Channel, error
 
 // GetChannelByTelegramID 根据 Telegram ID 获取频道
 func (d *Database) GetChannelByTelegramID(telegramID int64) (*models.Channel, error) {
-	query := `SELECT id, telegram_id, username, title, description, member_count, 
-			  is_active, created_at, updated_at FROM channels WHERE telegram_id = ?`
-	channel := &models.Channel{}
-	err := d.db.QueryRow(query, telegramID).Scan(
-		&channel.ID, &channel.TelegramID, &channel.Username, &channel.Title,
-		&channel.Description, &channel.MemberCount, &channel.IsActive,
-		&channel.CreatedAt, &channel.UpdatedAt,
-	)
+	query := `SELECT ` + channelColumns + ` FROM channels WHERE telegram_id = ?`
+	channel, err := scanChannel(d.db.QueryRow(query, telegramID))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get channel: %w", err)
 	}
 	return channel, nil
 }
 
-// CreateSubscription 创建订阅
+// CreateSubscription 创建订阅，已取消的订阅会被重新激活
 func (d *Database) CreateSubscription(subscription *models.Subscription) error {
-	query := `INSERT INTO subscriptions (user_id, channel_id) VALUES (?, ?)`
-	result, err := d.db.Exec(query, subscription.UserID, subscription.ChannelID)
-	if err != nil {
+	query := `INSERT INTO subscriptions (user_id, channel_id) VALUES (?, ?)
+			  ON CONFLICT(user_id, channel_id) DO UPDATE SET
+			  is_active = 1,
+			  updated_at = CURRENT_TIMESTAMP`
+	if _, err := d.db.Exec(query, subscription.UserID, subscription.ChannelID); err != nil {
 		return fmt.Errorf("failed to create subscription: %w", err)
 	}
 
-	id, err := result.LastInsertId()
+	err := d.db.QueryRow(`SELECT id, created_at FROM subscriptions WHERE user_id = ? AND channel_id = ?`,
+		subscription.UserID, subscription.ChannelID).Scan(&subscription.ID, &subscription.CreatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to get last insert id: %w", err)
+		return fmt.Errorf("failed to get subscription id: %w", err)
 	}
 
-	subscription.ID = id
-	subscription.CreatedAt = time.Now()
+	subscription.IsActive = true
 	subscription.UpdatedAt = time.Now()
 
 	return nil
 }
 
+// DeactivateSubscription 取消订阅，保留订阅记录
+func (d *Database) DeactivateSubscription(userID, channelID int64) error {
+	query := `UPDATE subscriptions SET is_active = 0, updated_at = CURRENT_TIMESTAMP 
+			  WHERE user_id = ? AND channel_id = ? AND is_active = 1`
+	result, err := d.db.Exec(query, userID, channelID)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate subscription: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("subscription not found")
+	}
+
+	return nil
+}
+
 // GetUserSubscriptions 获取用户订阅的频道
 func (d *Database) GetUserSubscriptions(userID int64) ([]*models.Channel, error) {
-	query := `SELECT c.id, c.telegram_id, c.username, c.title, c.description, 
-			  c.member_count, c.is_active, c.created_at, c.updated_at 
-			  FROM channels c 
-			  JOIN subscriptions s ON c.id = s.channel_id 
-			  WHERE s.user_id = ? AND s.is_active = 1`
+	query := `SELECT ` + channelColumns + ` 
+			  FROM channels 
+			  WHERE id IN (SELECT channel_id FROM subscriptions WHERE user_id = ? AND is_active = 1)`
 
 	rows, err := d.db.Query(query, userID)
 	if err != nil {
@@ -218,12 +646,33 @@ func (d *Database) GetUserSubscriptions(userID int64) ([]*models.Channel, error)
 
 	var channels []*models.Channel
 	for rows.Next() {
-		channel := &models.Channel{}
-		err := rows.Scan(
-			&channel.ID, &channel.TelegramID, &channel.Username, &channel.Title,
-			&channel.Description, &channel.MemberCount, &channel.IsActive,
-			&channel.CreatedAt, &channel.UpdatedAt,
-		)
+		channel, err := scanChannel(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan channel: %w", err)
+		}
+		channels = append(channels, channel)
+	}
+
+	return channels, nil
+}
+
+// GetActiveSubscribedChannels 获取至少有一个活跃订阅的所有频道
+func (d *Database) GetActiveSubscribedChannels() ([]*models.Channel, error) {
+	query := `SELECT ` + channelColumns + ` 
+			  FROM channels 
+			  WHERE is_active = 1 
+			  AND id IN (SELECT channel_id FROM subscriptions WHERE is_active = 1)
+			  ORDER BY id`
+
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subscribed channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channels []*models.Channel
+	for rows.Next() {
+		channel, err := scanChannel(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan channel: %w", err)
 		}
@@ -233,14 +682,29 @@ func (d *Database) GetUserSubscriptions(userID int64) ([]*models.Channel, error)
 	return channels, nil
 }
 
+// messageInsert 插入消息的语句，参数由 messageValues 生成
+const messageInsert = `INSERT INTO messages (telegram_id, channel_id, sender_type, sender_id, sender_name, 
+			  post_author, text, media_type, media_url, views, forwards, replies, reactions, grouped_id, 
+			  reply_to_id, thread_id, date, edit_date, fwd_from_type, fwd_from_id, fwd_from_name, 
+			  fwd_message_id, fwd_date, fwd_post_author, fwd_imported) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// messageValues 返回 messageInsert 的参数，不是转发的消息 fwd_* 列为 NULL
+func messageValues(message *models.Message) []any {
+	values := []any{message.TelegramID, message.ChannelID, message.SenderType,
+		message.SenderID, message.SenderName, message.PostAuthor, message.Text, message.MediaType,
+		message.MediaURL, message.Views, message.Forwards, message.Replies, message.Reactions,
+		message.GroupedID, message.ReplyToID, message.ThreadID, message.Date, message.EditDate}
+	if fwd := message.Forward; fwd != nil {
+		return append(values, fwd.FromType, fwd.FromID, fwd.FromName, fwd.MessageID, fwd.Date,
+			fwd.PostAuthor, fwd.Imported)
+	}
+	return append(values, nil, nil, nil, nil, nil, nil, nil)
+}
+
 // CreateMessage 创建消息
 func (d *Database) CreateMessage(message *models.Message) error {
-	query := `INSERT INTO messages (telegram_id, channel_id, sender_id, sender_name, 
-			  text, media_type, media_url, views, forwards, replies, date) 
-			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	result, err := d.db.Exec(query, message.TelegramID, message.ChannelID,
-		message.SenderID, message.SenderName, message.Text, message.MediaType,
-		message.MediaURL, message.Views, message.Forwards, message.Replies, message.Date)
+	result, err := d.db.Exec(messageInsert, messageValues(message)...)
 	if err != nil {
 		return fmt.Errorf("failed to create message: %w", err)
 	}
@@ -257,49 +721,161 @@ func (d *Database) CreateMessage(message *models.Message) error {
 	return nil
 }
 
-// GetChannelMessages 获取频道的消息
-func (d *Database) GetChannelMessages(channelID int64, limit, offset int) ([]*models.Message, error) {
-	query := `SELECT id, telegram_id, channel_id, sender_id, sender_name, 
-			  text, media_type, media_url, views, forwards, replies, date, 
-			  created_at, updated_at 
-			  FROM messages 
-			  WHERE channel_id = ? 
-			  ORDER BY date DESC 
-			  LIMIT ? OFFSET ?`
+// UpsertMessage 创建或更新消息，消息已存在时（如被编辑）覆盖其内容
+//
+// 发送者名称保留第一次保存时的值，发送者之后改名不会影响已保存的消息。
+func (d *Database) UpsertMessage(message *models.Message) error {
+	query := messageInsert + `
+			  ON CONFLICT(telegram_id, channel_id) DO UPDATE SET
+			  sender_type = excluded.sender_type,
+			  sender_id = excluded.sender_id,
+			  sender_name = COALESCE(NULLIF(messages.sender_name, ''), excluded.sender_name),
+			  post_author = excluded.post_author,
+			  text = excluded.text,
+			  media_type = excluded.media_type,
+			  media_url = excluded.media_url,
+			  views = excluded.views,
+			  forwards = excluded.forwards,
+			  replies = excluded.replies,
+			  reactions = excluded.reactions,
+			  grouped_id = excluded.grouped_id,
+			  reply_to_id = excluded.reply_to_id,
+			  thread_id = excluded.thread_id,
+			  edit_date = COALESCE(excluded.edit_date, messages.edit_date),
+			  deleted_at = NULL,
+			  fwd_from_type = excluded.fwd_from_type,
+			  fwd_from_id = excluded.fwd_from_id,
+			  fwd_from_name = excluded.fwd_from_name,
+			  fwd_message_id = excluded.fwd_message_id,
+			  fwd_date = excluded.fwd_date,
+			  fwd_post_author = excluded.fwd_post_author,
+			  fwd_imported = excluded.fwd_imported,
+			  updated_at = CURRENT_TIMESTAMP`
+	if _, err := d.db.Exec(query, messageValues(message)...); err != nil {
+		return fmt.Errorf("failed to upsert message: %w", err)
+	}
 
-	rows, err := d.db.Query(query, channelID, limit, offset)
+	err := d.db.QueryRow(`SELECT id, created_at FROM messages WHERE telegram_id = ? AND channel_id = ?`,
+		message.TelegramID, message.ChannelID).Scan(&message.ID, &message.CreatedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query messages: %w", err)
+		return fmt.Errorf("failed to get message id: %w", err)
+	}
+	message.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// MarkMessagesDeleted 将频道中的指定消息标记为已删除，保留消息内容
+//
+// 返回本次新标记的消息数量，已标记过的消息不会更新删除时间。
+func (d *Database) MarkMessagesDeleted(channelID int64, telegramIDs []int64) (int64, error) {
+	if len(telegramIDs) == 0 {
+		return 0, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(telegramIDs)), ", ")
+	args := make([]any, 0, len(telegramIDs)+1)
+	args = append(args, channelID)
+	for _, id := range telegramIDs {
+		args = append(args, id)
+	}
+
+	query := `UPDATE messages SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP 
+			  WHERE channel_id = ? AND deleted_at IS NULL AND telegram_id IN (` + placeholders + `)`
+	result, err := d.db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark messages deleted: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return affected, nil
+}
+
+// GetRecentMessageIDs 获取频道中最新的 limit 条未删除消息的 Telegram ID，按 ID 倒序排列
+func (d *Database) GetRecentMessageIDs(channelID int64, limit int) ([]int64, error) {
+	rows, err := d.db.Query(`SELECT telegram_id FROM messages 
+			  WHERE channel_id = ? AND deleted_at IS NULL 
+			  ORDER BY telegram_id DESC LIMIT ?`, channelID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message ids: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []*models.Message
+	var ids []int64
 	for rows.Next() {
-		message := &models.Message{}
-		err := rows.Scan(
-			&message.ID, &message.TelegramID, &message.ChannelID, &message.SenderID,
-			&message.SenderName, &message.Text, &message.MediaType, &message.MediaURL,
-			&message.Views, &message.Forwards, &message.Replies, &message.Date,
-			&message.CreatedAt, &message.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan message id: %w", err)
 		}
-		messages = append(messages, message)
+		ids = append(ids, id)
 	}
+	return ids, nil
+}
 
-	return messages, nil
+// GetLastMessageID 获取频道中已保存的最大消息 ID，没有消息时返回 0
+func (d *Database) GetLastMessageID(channelID int64) (int64, error) {
+	var lastID int64
+	err := d.db.QueryRow(`SELECT COALESCE(MAX(telegram_id), 0) FROM messages WHERE channel_id = ?`,
+		channelID).Scan(&lastID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last message id: %w", err)
+	}
+	return lastID, nil
 }
 
-// GetAllMessages 获取所有消息
-func (d *Database) GetAllMessages(limit, offset int) ([]*models.Message, error) {
-	query := `SELECT id, telegram_id, channel_id, sender_id, sender_name, text, media_type, media_url, 
-			  views, forwards, replies, date, created_at, updated_at 
-			  FROM messages 
-			  ORDER BY date DESC 
-			  LIMIT ? OFFSET ?`
+// messageColumns messages 表的查询列，与 scanMessage 的字段顺序保持一致
+const messageColumns = `id, telegram_id, channel_id, COALESCE(sender_type, ''), sender_id, 
+			  COALESCE(sender_name, ''), COALESCE(post_author, ''), text, media_type, media_url, 
+			  views, forwards, replies, reactions, grouped_id, COALESCE(reply_to_id, 0), 
+			  COALESCE(thread_id, 0), date, edit_date, deleted_at, fwd_from_type, fwd_from_id, 
+			  fwd_from_name, fwd_message_id, fwd_date, fwd_post_author, fwd_imported, created_at, updated_at`
+
+// scanMessage 扫描一行消息数据
+func scanMessage(row rowScanner) (*models.Message, error) {
+	message := &models.Message{}
+	var (
+		editDate, deletedAt, fwdDate sql.NullTime
+		fwdType, fwdName, fwdAuthor  sql.NullString
+		fwdFromID, fwdMessageID      sql.NullInt64
+		fwdImported                  sql.NullBool
+	)
+	err := row.Scan(
+		&message.ID, &message.TelegramID, &message.ChannelID, &message.SenderType, &message.SenderID,
+		&message.SenderName, &message.PostAuthor, &message.Text, &message.MediaType, &message.MediaURL,
+		&message.Views, &message.Forwards, &message.Replies, &message.Reactions, &message.GroupedID,
+		&message.ReplyToID, &message.ThreadID, &message.Date, &editDate,
+		&deletedAt, &fwdType, &fwdFromID, &fwdName, &fwdMessageID,
+		&fwdDate, &fwdAuthor, &fwdImported, &message.CreatedAt, &message.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if fwdDate.Valid {
+		message.Forward = &models.ForwardHeader{
+			FromType:   fwdType.String,
+			FromID:     fwdFromID.Int64,
+			FromName:   fwdName.String,
+			MessageID:  fwdMessageID.Int64,
+			Date:       fwdDate.Time,
+			PostAuthor: fwdAuthor.String,
+			Imported:   fwdImported.Bool,
+		}
+	}
+	if editDate.Valid {
+		message.EditDate = &editDate.Time
+	}
+	if deletedAt.Valid {
+		message.DeletedAt = &deletedAt.Time
+	}
+	return message, nil
+}
 
-	rows, err := d.db.Query(query, limit, offset)
+// queryMessages 执行查询并扫描消息列表
+func (d *Database) queryMessages(query string, args ...any) ([]*models.Message, error) {
+	rows, err := d.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages: %w", err)
 	}
@@ -307,35 +883,1177 @@ func (d *Database) GetAllMessages(limit, offset int) ([]*models.Message, error)
 
 	var messages []*models.Message
 	for rows.Next() {
-		msg := &models.Message{}
-		err := rows.Scan(
-			&msg.ID, &msg.TelegramID, &msg.ChannelID, &msg.SenderID, &msg.SenderName,
-			&msg.Text, &msg.MediaType, &msg.MediaURL, &msg.Views, &msg.Forwards,
-			&msg.Replies, &msg.Date, &msg.CreatedAt, &msg.UpdatedAt,
-		)
+		message, err := scanMessage(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
 		}
-		messages = append(messages, msg)
+		messages = append(messages, message)
 	}
 
 	return messages, nil
 }
 
-// GetChannelByID 根据 ID 获取频道
-func (d *Database) GetChannelByID(channelID int64) (*models.Channel, error) {
-	query := `SELECT id, telegram_id, username, title, description, member_count, 
-			  is_active, created_at, updated_at FROM channels WHERE id = ?`
-	channel := &models.Channel{}
-	err := d.db.QueryRow(query, channelID).Scan(
-		&channel.ID, &channel.TelegramID, &channel.Username, &channel.Title,
-		&channel.Description, &channel.MemberCount, &channel.IsActive,
-		&channel.CreatedAt, &channel.UpdatedAt,
+// MessageFilter 消息查询条件，零值字段表示不限制
+type MessageFilter struct {
+	ChannelID int64  // 频道的数据库 ID
+	Hashtag   string // 话题标签，可省略开头的 #
+	Edited    bool   // 只查询记录过历史版本的消息
+	Deleted   bool   // 只查询已被频道删除的消息
+	Query     string // 只查询被该服务器端搜索关键词命中过的消息
+	OrderBy   string // 排序字段，见 MessageOrders，默认按发布时间
+	Limit     int
+	Offset    int
+}
+
+// MessageOrders 支持的排序字段，均为倒序
+var MessageOrders = []string{"date", "views", "forwards", "replies", "reactions"}
+
+// orderColumn 返回排序使用的列，不支持的字段按发布时间排序
+func (f MessageFilter) orderColumn() string {
+	for _, order := range MessageOrders {
+		if f.OrderBy == order {
+			return order
+		}
+	}
+	return "date"
+}
+
+// where 生成查询条件和参数
+func (f MessageFilter) where() (string, []any) {
+	var (
+		conditions []string
+		args       []any
 	)
+	if f.ChannelID != 0 {
+		conditions = append(conditions, `channel_id = ?`)
+		args = append(args, f.ChannelID)
+	}
+	if f.Hashtag != "" {
+		conditions = append(conditions, `id IN (SELECT message_id FROM message_entities 
+			  WHERE type = ? AND text = ? COLLATE NOCASE)`)
+		args = append(args, models.EntityHashtag, "#"+strings.TrimPrefix(f.Hashtag, "#"))
+	}
+	if f.Edited {
+		conditions = append(conditions, `id IN (SELECT message_id FROM message_versions)`)
+	}
+	if f.Deleted {
+		conditions = append(conditions, `deleted_at IS NOT NULL`)
+	}
+	if f.Query != "" {
+		conditions = append(conditions, `id IN (SELECT message_id FROM search_hits WHERE query = ?)`)
+		args = append(args, f.Query)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return ` WHERE ` + strings.Join(conditions, ` AND `), args
+}
+
+// FindMessages 按条件查询消息，默认按发布时间倒序排列
+func (d *Database) FindMessages(filter MessageFilter) ([]*models.Message, error) {
+	where, args := filter.where()
+	query := `SELECT ` + messageColumns + ` FROM messages` + where +
+		` ORDER BY ` + filter.orderColumn() + ` DESC, date DESC LIMIT ? OFFSET ?`
+	args = append(args, filter.Limit, filter.Offset)
+
+	return d.queryMessages(query, args...)
+}
+
+// FindAlbums 按条件查询帖子，同一相册的消息合并为一个 Album，默认按发布时间倒序排列
+//
+// Limit 和 Offset 以帖子为单位；相册中任意一条消息满足条件时返回整个相册。
+func (d *Database) FindAlbums(filter MessageFilter) ([]*models.Album, error) {
+	where, args := filter.where()
+	query := `SELECT channel_id, grouped_id, MIN(id) 
+			  FROM messages` + where + ` 
+			  GROUP BY channel_id, CASE WHEN grouped_id = 0 THEN -id ELSE grouped_id END 
+			  ORDER BY MAX(` + filter.orderColumn() + `) DESC, MAX(date) DESC, MAX(id) DESC 
+			  LIMIT ? OFFSET ?`
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := d.db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get channel: %w", err)
+		return nil, fmt.Errorf("failed to query albums: %w", err)
 	}
-	return channel, nil
+
+	type albumKey struct {
+		channelID, groupedID, messageID int64
+	}
+	var keys []albumKey
+	for rows.Next() {
+		var key albumKey
+		if err := rows.Scan(&key.channelID, &key.groupedID, &key.messageID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan album: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+
+	albums := make([]*models.Album, 0, len(keys))
+	for _, key := range keys {
+		var messages []*models.Message
+		if key.groupedID == 0 {
+			messages, err = d.queryMessages(`SELECT `+messageColumns+` FROM messages WHERE id = ?`, key.messageID)
+		} else {
+			messages, err = d.GetAlbumMessages(key.channelID, key.groupedID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(messages) == 0 {
+			continue
+		}
+		albums = append(albums, &models.Album{GroupedID: key.groupedID, Messages: messages})
+	}
+
+	return albums, nil
+}
+
+// GetAlbumMessages 获取相册中的全部消息，按消息 ID 升序排列
+func (d *Database) GetAlbumMessages(channelID, groupedID int64) ([]*models.Message, error) {
+	query := `SELECT ` + messageColumns + ` 
+			  FROM messages 
+			  WHERE channel_id = ? AND grouped_id = ? 
+			  ORDER BY telegram_id`
+	return d.queryMessages(query, channelID, groupedID)
+}
+
+// GetChannelMessages 获取频道的消息
+func (d *Database) GetChannelMessages(channelID int64, limit, offset int) ([]*models.Message, error) {
+	return d.FindMessages(MessageFilter{ChannelID: channelID, Limit: limit, Offset: offset})
+}
+
+// GetAllMessages 获取所有消息
+func (d *Database) GetAllMessages(limit, offset int) ([]*models.Message, error) {
+	return d.FindMessages(MessageFilter{Limit: limit, Offset: offset})
+}
+
+// GetMessagesByHashtag 获取包含指定话题标签的消息，channelID 为 0 时查询所有频道
+func (d *Database) GetMessagesByHashtag(hashtag string, channelID int64, limit, offset int) ([]*models.Message, error) {
+	return d.FindMessages(MessageFilter{ChannelID: channelID, Hashtag: hashtag, Limit: limit, Offset: offset})
+}
+
+// GetMessageByTelegramID 根据 Telegram 消息 ID 获取频道中的消息
+func (d *Database) GetMessageByTelegramID(channelID, telegramID int64) (*models.Message, error) {
+	query := `SELECT ` + messageColumns + ` FROM messages WHERE channel_id = ? AND telegram_id = ?`
+	message, err := scanMessage(d.db.QueryRow(query, channelID, telegramID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return message, nil
+}
+
+// GetReplyChain 获取消息所在回复链中的上级消息，从直接回复的消息开始向上，最多 depth 条
+//
+// 回复的消息没有保存时链条在此中断。
+func (d *Database) GetReplyChain(channelID, telegramID int64, depth int) ([]*models.Message, error) {
+	var chain []*models.Message
+	seen := map[int64]bool{telegramID: true}
+	current, err := d.GetMessageByTelegramID(channelID, telegramID)
+	if err != nil {
+		return nil, err
+	}
+	for len(chain) < depth && current.ReplyToID != 0 && !seen[current.ReplyToID] {
+		seen[current.ReplyToID] = true
+		parent, err := d.GetMessageByTelegramID(channelID, current.ReplyToID)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, parent)
+		current = parent
+	}
+	return chain, nil
+}
+
+// GetForwardSources 统计频道转发内容的来源，按转发次数倒序排列
+//
+// 来源频道的标题和用户名来自 channels 表，抓取时返回的来源频道会自动保存。
+func (d *Database) GetForwardSources(channelID int64, limit int) ([]*models.ForwardSource, error) {
+	query := `SELECT m.fwd_from_type, COALESCE(m.fwd_from_id, 0), COALESCE(m.fwd_from_name, ''), 
+			  COALESCE(c.title, ''), COALESCE(c.username, ''), 
+			  COUNT(*), MAX(CAST(strftime('%s', m.date) AS INTEGER)) 
+			  FROM messages m 
+			  LEFT JOIN channels c ON m.fwd_from_type = ? AND c.telegram_id = m.fwd_from_id 
+			  WHERE m.channel_id = ? AND m.fwd_date IS NOT NULL 
+			  GROUP BY m.fwd_from_type, m.fwd_from_id, m.fwd_from_name 
+			  ORDER BY COUNT(*) DESC 
+			  LIMIT ?`
+
+	rows, err := d.db.Query(query, models.ForwardFromChannel, channelID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query forward sources: %w", err)
+	}
+	defer rows.Close()
+
+	var sources []*models.ForwardSource
+	for rows.Next() {
+		source := &models.ForwardSource{}
+		var (
+			fromName string
+			last     int64
+		)
+		err := rows.Scan(&source.FromType, &source.FromID, &fromName, &source.Name,
+			&source.Username, &source.Count, &last)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan forward source: %w", err)
+		}
+		if source.Name == "" {
+			source.Name = fromName
+		}
+		source.LastForwarded = time.Unix(last, 0)
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+// GetChannelByID 根据 ID 获取频道
+func (d *Database) GetChannelByID(channelID int64) (*models.Channel, error) {
+	query := `SELECT ` + channelColumns + ` FROM channels WHERE id = ?`
+	channel, err := scanChannel(d.db.QueryRow(query, channelID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+	return channel, nil
+}
+
+// GetChannelState 获取频道的更新状态，没有记录时返回 pts 为 0 的状态
+func (d *Database) GetChannelState(channelID int64) (*models.ChannelState, error) {
+	state := &models.ChannelState{ChannelID: channelID}
+	err := d.db.QueryRow(`SELECT pts, updated_at FROM channel_states WHERE channel_id = ?`,
+		channelID).Scan(&state.Pts, &state.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel state: %w", err)
+	}
+	return state, nil
+}
+
+// SaveChannelState 保存频道的更新状态
+func (d *Database) SaveChannelState(state *models.ChannelState) error {
+	query := `INSERT INTO channel_states (channel_id, pts) VALUES (?, ?)
+			  ON CONFLICT(channel_id) DO UPDATE SET
+			  pts = excluded.pts,
+			  updated_at = CURRENT_TIMESTAMP`
+	if _, err := d.db.Exec(query, state.ChannelID, state.Pts); err != nil {
+		return fmt.Errorf("failed to save channel state: %w", err)
+	}
+	state.UpdatedAt = time.Now()
+	return nil
+}
+
+// ReplaceMessageEntities 替换消息的全部格式实体
+func (d *Database) ReplaceMessageEntities(messageID int64, entities []*models.MessageEntity) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM message_entities WHERE message_id = ?`, messageID); err != nil {
+		return fmt.Errorf("failed to delete message entities: %w", err)
+	}
+
+	query := `INSERT INTO message_entities (message_id, type, offset, length, text, url, 
+			  user_id, language, custom_emoji_id) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, entity := range entities {
+		entity.MessageID = messageID
+		result, err := tx.Exec(query, entity.MessageID, entity.Type, entity.Offset, entity.Length,
+			entity.Text, entity.URL, entity.UserID, entity.Language, entity.CustomEmojiID)
+		if err != nil {
+			return fmt.Errorf("failed to create message entity: %w", err)
+		}
+		if entity.ID, err = result.LastInsertId(); err != nil {
+			return fmt.Errorf("failed to get last insert id: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit message entities: %w", err)
+	}
+	return nil
+}
+
+// GetMessageEntities 获取消息的格式实体，按出现位置排序
+func (d *Database) GetMessageEntities(messageID int64) ([]*models.MessageEntity, error) {
+	query := `SELECT id, message_id, type, offset, length, text, url, user_id, language, custom_emoji_id 
+			  FROM message_entities 
+			  WHERE message_id = ? 
+			  ORDER BY offset, length DESC`
+
+	rows, err := d.db.Query(query, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message entities: %w", err)
+	}
+	defer rows.Close()
+
+	var entities []*models.MessageEntity
+	for rows.Next() {
+		entity := &models.MessageEntity{}
+		err := rows.Scan(
+			&entity.ID, &entity.MessageID, &entity.Type, &entity.Offset, &entity.Length,
+			&entity.Text, &entity.URL, &entity.UserID, &entity.Language, &entity.CustomEmojiID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message entity: %w", err)
+		}
+		entities = append(entities, entity)
+	}
+
+	return entities, nil
+}
+
+// SaveMessageVersion 记录消息的当前内容为一个新版本
+//
+// 内容与最新版本相同时不做任何修改并返回 false。editDate 为该版本生效的时间。
+func (d *Database) SaveMessageVersion(message *models.Message, editDate time.Time) (bool, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		version                   int
+		text, mediaType, mediaURL string
+	)
+	err = tx.QueryRow(`SELECT version, text, media_type, media_url FROM message_versions 
+			  WHERE message_id = ? ORDER BY version DESC LIMIT 1`, message.ID).
+		Scan(&version, &text, &mediaType, &mediaURL)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return false, fmt.Errorf("failed to get latest message version: %w", err)
+	case text == message.Text && mediaType == message.MediaType && mediaURL == message.MediaURL:
+		return false, nil
+	}
+
+	query := `INSERT INTO message_versions (message_id, version, text, media_type, media_url, edit_date) 
+			  VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := tx.Exec(query, message.ID, version+1, message.Text, message.MediaType,
+		message.MediaURL, editDate); err != nil {
+		return false, fmt.Errorf("failed to create message version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit message version: %w", err)
+	}
+	return true, nil
+}
+
+// GetMessageVersions 获取消息的全部历史版本，按版本号升序排列
+func (d *Database) GetMessageVersions(messageID int64) ([]*models.MessageVersion, error) {
+	query := `SELECT id, message_id, version, text, media_type, media_url, edit_date, created_at 
+			  FROM message_versions 
+			  WHERE message_id = ? 
+			  ORDER BY version`
+
+	rows, err := d.db.Query(query, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []*models.MessageVersion
+	for rows.Next() {
+		version := &models.MessageVersion{}
+		err := rows.Scan(
+			&version.ID, &version.MessageID, &version.Version, &version.Text,
+			&version.MediaType, &version.MediaURL, &version.EditDate, &version.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message version: %w", err)
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// UpdateMessageReplies 更新消息的评论数
+func (d *Database) UpdateMessageReplies(messageID int64, replies int32) error {
+	_, err := d.db.Exec(`UPDATE messages SET replies = ?, updated_at = CURRENT_TIMESTAMP 
+			  WHERE id = ? AND replies != ?`, replies, messageID, replies)
+	if err != nil {
+		return fmt.Errorf("failed to update message replies: %w", err)
+	}
+	return nil
+}
+
+// SaveComment 保存评论，评论已存在时（如被编辑）更新其内容
+func (d *Database) SaveComment(comment *models.Comment) error {
+	query := `INSERT INTO comments (message_id, chat_id, telegram_id, author_id, author_name, 
+			  text, reply_to_id, date) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			  ON CONFLICT(chat_id, telegram_id) DO UPDATE SET
+			  author_name = excluded.author_name,
+			  text = excluded.text`
+	_, err := d.db.Exec(query, comment.MessageID, comment.ChatID, comment.TelegramID,
+		comment.AuthorID, comment.AuthorName, comment.Text, comment.ReplyToID, comment.Date)
+	if err != nil {
+		return fmt.Errorf("failed to save comment: %w", err)
+	}
+
+	err = d.db.QueryRow(`SELECT id, created_at FROM comments WHERE chat_id = ? AND telegram_id = ?`,
+		comment.ChatID, comment.TelegramID).Scan(&comment.ID, &comment.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to get comment id: %w", err)
+	}
+	return nil
+}
+
+// GetLastCommentID 获取帖子已保存的最大评论 ID，没有评论时返回 0
+func (d *Database) GetLastCommentID(messageID int64) (int64, error) {
+	var lastID int64
+	err := d.db.QueryRow(`SELECT COALESCE(MAX(telegram_id), 0) FROM comments WHERE message_id = ?`,
+		messageID).Scan(&lastID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last comment id: %w", err)
+	}
+	return lastID, nil
+}
+
+// GetMessageComments 获取帖子的评论，按发布时间升序排列
+func (d *Database) GetMessageComments(messageID int64) ([]*models.Comment, error) {
+	query := `SELECT id, message_id, chat_id, telegram_id, author_id, author_name, text, 
+			  reply_to_id, date, created_at 
+			  FROM comments 
+			  WHERE message_id = ? 
+			  ORDER BY date, telegram_id`
+
+	rows, err := d.db.Query(query, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query comments: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		comment := &models.Comment{}
+		err := rows.Scan(
+			&comment.ID, &comment.MessageID, &comment.ChatID, &comment.TelegramID,
+			&comment.AuthorID, &comment.AuthorName, &comment.Text, &comment.ReplyToID,
+			&comment.Date, &comment.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, nil
+}
+
+// SaveSender 保存发送者，已存在时更新名称和最近出现时间
+//
+// 新名称为空时保留原来的名称。
+func (d *Database) SaveSender(sender *models.Sender) error {
+	query := `INSERT INTO senders (peer_type, telegram_id, name, username) 
+			  VALUES (?, ?, ?, ?)
+			  ON CONFLICT(peer_type, telegram_id) DO UPDATE SET
+			  name = COALESCE(NULLIF(excluded.name, ''), senders.name),
+			  username = excluded.username,
+			  last_seen = CURRENT_TIMESTAMP`
+	_, err := d.db.Exec(query, sender.PeerType, sender.TelegramID, sender.Name, sender.Username)
+	if err != nil {
+		return fmt.Errorf("failed to save sender: %w", err)
+	}
+
+	err = d.db.QueryRow(`SELECT id, name, first_seen, last_seen FROM senders 
+			  WHERE peer_type = ? AND telegram_id = ?`, sender.PeerType, sender.TelegramID).
+		Scan(&sender.ID, &sender.Name, &sender.FirstSeen, &sender.LastSeen)
+	if err != nil {
+		return fmt.Errorf("failed to get sender id: %w", err)
+	}
+	return nil
+}
+
+// GetSender 根据类型和 Telegram ID 获取发送者
+func (d *Database) GetSender(peerType string, telegramID int64) (*models.Sender, error) {
+	sender := &models.Sender{}
+	err := d.db.QueryRow(`SELECT id, peer_type, telegram_id, name, COALESCE(username, ''), 
+			  first_seen, last_seen 
+			  FROM senders WHERE peer_type = ? AND telegram_id = ?`, peerType, telegramID).Scan(
+		&sender.ID, &sender.PeerType, &sender.TelegramID, &sender.Name, &sender.Username,
+		&sender.FirstSeen, &sender.LastSeen,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sender: %w", err)
+	}
+	return sender, nil
+}
+
+// SaveReactionSnapshot 记录消息当前的回应统计并更新消息的回应总数
+//
+// 与最近一次快照相同时不记录新快照并返回 false。
+func (d *Database) SaveReactionSnapshot(messageID int64, reactions []*models.Reaction) (bool, error) {
+	total := 0
+	for _, reaction := range reactions {
+		total += reaction.Count
+	}
+
+	latest, err := d.GetLatestReactionSnapshot(messageID)
+	if err != nil {
+		return false, err
+	}
+	if latest != nil && sameReactions(latest.Reactions, reactions) {
+		return false, nil
+	}
+	// 没有快照时也没有回应，无需记录
+	if latest == nil && len(reactions) == 0 {
+		return false, nil
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO reaction_snapshots (message_id, total) VALUES (?, ?)`, messageID, total)
+	if err != nil {
+		return false, fmt.Errorf("failed to create reaction snapshot: %w", err)
+	}
+	snapshotID, err := result.LastInsertId()
+	if err != nil {
+		return false, fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	for _, reaction := range reactions {
+		_, err := tx.Exec(`INSERT INTO reaction_counts (snapshot_id, emoji, custom_emoji_id, count) 
+			  VALUES (?, ?, ?, ?)`, snapshotID, reaction.Emoji, reaction.CustomEmojiID, reaction.Count)
+		if err != nil {
+			return false, fmt.Errorf("failed to create reaction count: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE messages SET reactions = ? WHERE id = ?`, total, messageID); err != nil {
+		return false, fmt.Errorf("failed to update message reactions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit reaction snapshot: %w", err)
+	}
+	return true, nil
+}
+
+// GetLatestReactionSnapshot 获取消息最近一次的回应快照，没有快照时返回 nil
+func (d *Database) GetLatestReactionSnapshot(messageID int64) (*models.ReactionSnapshot, error) {
+	snapshots, err := d.queryReactionSnapshots(`SELECT id, message_id, total, captured_at 
+			  FROM reaction_snapshots 
+			  WHERE message_id = ? 
+			  ORDER BY id DESC LIMIT 1`, messageID)
+	if err != nil || len(snapshots) == 0 {
+		return nil, err
+	}
+	return snapshots[0], nil
+}
+
+// GetReactionSnapshots 获取消息的全部回应快照，按时间升序排列
+func (d *Database) GetReactionSnapshots(messageID int64) ([]*models.ReactionSnapshot, error) {
+	return d.queryReactionSnapshots(`SELECT id, message_id, total, captured_at 
+			  FROM reaction_snapshots 
+			  WHERE message_id = ? 
+			  ORDER BY id`, messageID)
+}
+
+// queryReactionSnapshots 执行查询并加载每个快照的回应数量
+func (d *Database) queryReactionSnapshots(query string, args ...any) ([]*models.ReactionSnapshot, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reaction snapshots: %w", err)
+	}
+
+	var snapshots []*models.ReactionSnapshot
+	for rows.Next() {
+		snapshot := &models.ReactionSnapshot{}
+		if err := rows.Scan(&snapshot.ID, &snapshot.MessageID, &snapshot.Total, &snapshot.CapturedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan reaction snapshot: %w", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	rows.Close()
+
+	for _, snapshot := range snapshots {
+		if snapshot.Reactions, err = d.getReactionCounts(snapshot.ID); err != nil {
+			return nil, err
+		}
+	}
+	return snapshots, nil
+}
+
+// getReactionCounts 获取快照中的回应数量，按数量倒序排列
+func (d *Database) getReactionCounts(snapshotID int64) ([]*models.Reaction, error) {
+	rows, err := d.db.Query(`SELECT emoji, custom_emoji_id, count FROM reaction_counts 
+			  WHERE snapshot_id = ? ORDER BY count DESC`, snapshotID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reaction counts: %w", err)
+	}
+	defer rows.Close()
+
+	var reactions []*models.Reaction
+	for rows.Next() {
+		reaction := &models.Reaction{}
+		if err := rows.Scan(&reaction.Emoji, &reaction.CustomEmojiID, &reaction.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction count: %w", err)
+		}
+		reactions = append(reactions, reaction)
+	}
+	return reactions, nil
+}
+
+// sameReactions 判断两组回应数量是否相同
+func sameReactions(a, b []*models.Reaction) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[models.Reaction]int, len(a))
+	for _, reaction := range a {
+		counts[models.Reaction{Emoji: reaction.Emoji, CustomEmojiID: reaction.CustomEmojiID}] = reaction.Count
+	}
+	for _, reaction := range b {
+		key := models.Reaction{Emoji: reaction.Emoji, CustomEmojiID: reaction.CustomEmojiID}
+		if count, ok := counts[key]; !ok || count != reaction.Count {
+			return false
+		}
+	}
+	return true
+}
+
+// GetChannelPostStats 统计频道最近 days 天平均每天的帖子数，以及最近 recent 条帖子的平均浏览数
+//
+// 相册按一条帖子计算，已删除的消息不参与统计。
+func (d *Database) GetChannelPostStats(channelID int64, days, recent int) (postsPerDay, avgViews float64, err error) {
+	since := time.Now().AddDate(0, 0, -days).Unix()
+	var posts int
+	err = d.db.QueryRow(`SELECT COUNT(DISTINCT CASE WHEN grouped_id != 0 THEN grouped_id ELSE -id END) 
+			  FROM messages 
+			  WHERE channel_id = ? AND deleted_at IS NULL AND CAST(strftime('%s', date) AS INTEGER) >= ?`,
+		channelID, since).Scan(&posts)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count channel posts: %w", err)
+	}
+	if days > 0 {
+		postsPerDay = float64(posts) / float64(days)
+	}
+
+	var avg sql.NullFloat64
+	err = d.db.QueryRow(`SELECT AVG(views) FROM (
+			  SELECT views FROM messages 
+			  WHERE channel_id = ? AND deleted_at IS NULL 
+			  ORDER BY telegram_id DESC LIMIT ?)`, channelID, recent).Scan(&avg)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to average channel views: %w", err)
+	}
+	return postsPerDay, avg.Float64, nil
+}
+
+// CreateChannelSnapshot 记录频道统计快照
+func (d *Database) CreateChannelSnapshot(snapshot *models.ChannelSnapshot) error {
+	result, err := d.db.Exec(`INSERT INTO channel_snapshots (channel_id, member_count, online_count, posts_per_day, avg_views) 
+			  VALUES (?, ?, ?, ?, ?)`, snapshot.ChannelID, snapshot.MemberCount, snapshot.OnlineCount,
+		snapshot.PostsPerDay, snapshot.AvgViews)
+	if err != nil {
+		return fmt.Errorf("failed to create channel snapshot: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	snapshot.ID = id
+	snapshot.CapturedAt = time.Now()
+	return nil
+}
+
+// GetChannelSnapshots 获取频道在 since 之后记录的统计快照，按时间升序排列
+func (d *Database) GetChannelSnapshots(channelID int64, since time.Time) ([]*models.ChannelSnapshot, error) {
+	rows, err := d.db.Query(`SELECT id, channel_id, member_count, online_count, posts_per_day, avg_views, captured_at 
+			  FROM channel_snapshots 
+			  WHERE channel_id = ? AND captured_at >= datetime(?, 'unixepoch') 
+			  ORDER BY captured_at, id`, channelID, since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query channel snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []*models.ChannelSnapshot
+	for rows.Next() {
+		snapshot := &models.ChannelSnapshot{}
+		err := rows.Scan(&snapshot.ID, &snapshot.ChannelID, &snapshot.MemberCount, &snapshot.OnlineCount,
+			&snapshot.PostsPerDay, &snapshot.AvgViews, &snapshot.CapturedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan channel snapshot: %w", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// SaveMemberEvent 保存群组成员变动，同一条服务消息中的同一成员只保存一次
+func (d *Database) SaveMemberEvent(event *models.MemberEvent) error {
+	query := `INSERT INTO member_events (channel_id, message_id, user_id, actor_id, action, date) 
+			  VALUES (?, ?, ?, ?, ?, ?)
+			  ON CONFLICT(channel_id, message_id, user_id) DO NOTHING`
+	_, err := d.db.Exec(query, event.ChannelID, event.MessageID, event.UserID, event.ActorID,
+		event.Action, event.Date)
+	if err != nil {
+		return fmt.Errorf("failed to save member event: %w", err)
+	}
+
+	err = d.db.QueryRow(`SELECT id, created_at FROM member_events 
+			  WHERE channel_id = ? AND message_id = ? AND user_id = ?`,
+		event.ChannelID, event.MessageID, event.UserID).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to get member event id: %w", err)
+	}
+	return nil
+}
+
+// CountMemberEvents 统计群组在 since 之后各类成员变动的次数
+func (d *Database) CountMemberEvents(channelID int64, since time.Time) (map[string]int, error) {
+	rows, err := d.db.Query(`SELECT action, COUNT(*) FROM member_events 
+			  WHERE channel_id = ? AND CAST(strftime('%s', date) AS INTEGER) >= ? 
+			  GROUP BY action`, channelID, since.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to count member events: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var (
+			action string
+			count  int
+		)
+		if err := rows.Scan(&action, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan member event count: %w", err)
+		}
+		counts[action] = count
+	}
+	return counts, nil
+}
+
+// CreateParticipantSnapshot 保存一次群组成员列表快照
+func (d *Database) CreateParticipantSnapshot(snapshot *models.ParticipantSnapshot) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO participant_snapshots (channel_id, total) VALUES (?, ?)`,
+		snapshot.ChannelID, snapshot.Total)
+	if err != nil {
+		return fmt.Errorf("failed to create participant snapshot: %w", err)
+	}
+	if snapshot.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	query := `INSERT INTO participants (snapshot_id, user_id, role, rank, inviter_id, joined_at) 
+			  VALUES (?, ?, ?, ?, ?, ?)
+			  ON CONFLICT(snapshot_id, user_id) DO NOTHING`
+	for _, participant := range snapshot.Participants {
+		participant.SnapshotID = snapshot.ID
+		_, err := tx.Exec(query, participant.SnapshotID, participant.UserID, participant.Role,
+			participant.Rank, participant.InviterID, participant.JoinedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create participant: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit participant snapshot: %w", err)
+	}
+	snapshot.CapturedAt = time.Now()
+	return nil
+}
+
+// GetLatestParticipantSnapshot 获取群组最近一次成员快照及其成员，没有快照时返回 nil
+//
+// 成员名称来自 senders 表，管理员排在前面。
+func (d *Database) GetLatestParticipantSnapshot(channelID int64) (*models.ParticipantSnapshot, error) {
+	snapshot := &models.ParticipantSnapshot{}
+	err := d.db.QueryRow(`SELECT id, channel_id, total, captured_at FROM participant_snapshots 
+			  WHERE channel_id = ? ORDER BY captured_at DESC, id DESC LIMIT 1`, channelID).
+		Scan(&snapshot.ID, &snapshot.ChannelID, &snapshot.Total, &snapshot.CapturedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get participant snapshot: %w", err)
+	}
+
+	rows, err := d.db.Query(`SELECT p.snapshot_id, p.user_id, COALESCE(s.name, ''), p.role, 
+			  COALESCE(p.rank, ''), p.inviter_id, p.joined_at 
+			  FROM participants p 
+			  LEFT JOIN senders s ON s.peer_type = 'user' AND s.telegram_id = p.user_id 
+			  WHERE p.snapshot_id = ? 
+			  ORDER BY CASE p.role WHEN 'creator' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END, p.joined_at`,
+		snapshot.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query participants: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		participant := &models.Participant{}
+		var joinedAt sql.NullTime
+		err := rows.Scan(&participant.SnapshotID, &participant.UserID, &participant.Name,
+			&participant.Role, &participant.Rank, &participant.InviterID, &joinedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan participant: %w", err)
+		}
+		if joinedAt.Valid {
+			participant.JoinedAt = &joinedAt.Time
+		}
+		snapshot.Participants = append(snapshot.Participants, participant)
+	}
+	return snapshot, nil
+}
+
+// SavePoll 保存投票及其选项，已存在时更新题目、状态和票数
+//
+// 测验的正确答案一旦记录就不会被清除，因为部分结果（min）中不包含正确答案。
+func (d *Database) SavePoll(poll *models.Poll) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO polls (message_id, telegram_id, question, quiz, multiple_choice, 
+			  public_voters, closed, close_date, total_voters, solution) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			  ON CONFLICT(message_id) DO UPDATE SET
+			  telegram_id = excluded.telegram_id,
+			  question = excluded.question,
+			  quiz = excluded.quiz,
+			  multiple_choice = excluded.multiple_choice,
+			  public_voters = excluded.public_voters,
+			  closed = excluded.closed,
+			  close_date = excluded.close_date,
+			  total_voters = excluded.total_voters,
+			  solution = CASE WHEN excluded.solution != '' THEN excluded.solution ELSE polls.solution END,
+			  updated_at = CURRENT_TIMESTAMP`
+	_, err = tx.Exec(query, poll.MessageID, poll.TelegramID, poll.Question, poll.Quiz,
+		poll.MultipleChoice, poll.PublicVoters, poll.Closed, poll.CloseDate, poll.TotalVoters, poll.Solution)
+	if err != nil {
+		return fmt.Errorf("failed to save poll: %w", err)
+	}
+	if err := tx.QueryRow(`SELECT id FROM polls WHERE message_id = ?`, poll.MessageID).Scan(&poll.ID); err != nil {
+		return fmt.Errorf("failed to get poll id: %w", err)
+	}
+
+	query = `INSERT INTO poll_answers (poll_id, position, option, text, voters, correct) 
+			  VALUES (?, ?, ?, ?, ?, ?)
+			  ON CONFLICT(poll_id, option) DO UPDATE SET
+			  position = excluded.position,
+			  text = excluded.text,
+			  voters = excluded.voters,
+			  correct = excluded.correct OR poll_answers.correct`
+	for _, answer := range poll.Answers {
+		answer.PollID = poll.ID
+		_, err := tx.Exec(query, answer.PollID, answer.Position, answer.Option, answer.Text,
+			answer.Voters, answer.Correct)
+		if err != nil {
+			return fmt.Errorf("failed to save poll answer: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit poll: %w", err)
+	}
+	poll.UpdatedAt = time.Now()
+	return nil
+}
+
+// pollColumns polls 表的查询列，与 scanPoll 的字段顺序保持一致
+const pollColumns = `id, message_id, telegram_id, question, quiz, multiple_choice, public_voters, 
+			  closed, close_date, total_voters, solution, updated_at`
+
+// scanPoll 扫描一行投票数据
+func scanPoll(row rowScanner) (*models.Poll, error) {
+	poll := &models.Poll{}
+	var closeDate sql.NullTime
+	err := row.Scan(
+		&poll.ID, &poll.MessageID, &poll.TelegramID, &poll.Question, &poll.Quiz,
+		&poll.MultipleChoice, &poll.PublicVoters, &poll.Closed, &closeDate,
+		&poll.TotalVoters, &poll.Solution, &poll.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if closeDate.Valid {
+		poll.CloseDate = &closeDate.Time
+	}
+	return poll, nil
+}
+
+// GetMessagePoll 获取消息中的投票及其选项
+func (d *Database) GetMessagePoll(messageID int64) (*models.Poll, error) {
+	poll, err := scanPoll(d.db.QueryRow(`SELECT `+pollColumns+` FROM polls WHERE message_id = ?`, messageID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get poll: %w", err)
+	}
+	if poll.Answers, err = d.getPollAnswers(poll.ID); err != nil {
+		return nil, err
+	}
+	return poll, nil
+}
+
+// GetPollsByTelegramID 获取同一个 Telegram 投票对应的所有投票记录（包括转发的副本）
+func (d *Database) GetPollsByTelegramID(telegramID int64) ([]*models.Poll, error) {
+	rows, err := d.db.Query(`SELECT `+pollColumns+` FROM polls WHERE telegram_id = ?`, telegramID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query polls: %w", err)
+	}
+
+	var polls []*models.Poll
+	for rows.Next() {
+		poll, err := scanPoll(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan poll: %w", err)
+		}
+		polls = append(polls, poll)
+	}
+	rows.Close()
+
+	for _, poll := range polls {
+		if poll.Answers, err = d.getPollAnswers(poll.ID); err != nil {
+			return nil, err
+		}
+	}
+	return polls, nil
+}
+
+// getPollAnswers 获取投票的选项，按选项顺序排列
+func (d *Database) getPollAnswers(pollID int64) ([]*models.PollAnswer, error) {
+	rows, err := d.db.Query(`SELECT id, poll_id, position, option, text, voters, correct 
+			  FROM poll_answers WHERE poll_id = ? ORDER BY position`, pollID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query poll answers: %w", err)
+	}
+	defer rows.Close()
+
+	var answers []*models.PollAnswer
+	for rows.Next() {
+		answer := &models.PollAnswer{}
+		err := rows.Scan(&answer.ID, &answer.PollID, &answer.Position, &answer.Option,
+			&answer.Text, &answer.Voters, &answer.Correct)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan poll answer: %w", err)
+		}
+		answers = append(answers, answer)
+	}
+	return answers, nil
+}
+
+// mediaColumns media 表的查询列，与 scanMedia 的字段顺序保持一致
+const mediaColumns = `id, message_id, media_type, file_id, file_name, mime_type, size, 
+			  width, height, sha256, local_path, created_at`
+
+// scanMedia 扫描一行媒体数据
+func scanMedia(row rowScanner) (*models.Media, error) {
+	media := &models.Media{}
+	err := row.Scan(
+		&media.ID, &media.MessageID, &media.MediaType, &media.FileID, &media.FileName,
+		&media.MimeType, &media.Size, &media.Width, &media.Height, &media.SHA256,
+		&media.LocalPath, &media.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// SaveMedia 保存媒体记录，同一消息的同一文件只保存一次
+func (d *Database) SaveMedia(media *models.Media) error {
+	query := `INSERT INTO media (message_id, media_type, file_id, file_name, mime_type, 
+			  size, width, height, sha256, local_path) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			  ON CONFLICT(message_id, file_id) DO UPDATE SET
+			  sha256 = excluded.sha256,
+			  local_path = excluded.local_path`
+	_, err := d.db.Exec(query, media.MessageID, media.MediaType, media.FileID, media.FileName,
+		media.MimeType, media.Size, media.Width, media.Height, media.SHA256, media.LocalPath)
+	if err != nil {
+		return fmt.Errorf("failed to save media: %w", err)
+	}
+
+	err = d.db.QueryRow(`SELECT id, created_at FROM media WHERE message_id = ? AND file_id = ?`,
+		media.MessageID, media.FileID).Scan(&media.ID, &media.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to get media id: %w", err)
+	}
+
+	return nil
+}
+
+// GetMediaByFileID 根据 Telegram 文件 ID 查找已下载的媒体，用于跨频道去重
+func (d *Database) GetMediaByFileID(mediaType string, fileID int64) (*models.Media, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media 
+			  WHERE media_type = ? AND file_id = ? AND local_path != '' 
+			  ORDER BY id LIMIT 1`
+	media, err := scanMedia(d.db.QueryRow(query, mediaType, fileID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get media: %w", err)
+	}
+	return media, nil
+}
+
+// GetMessageMedia 获取消息的所有媒体
+func (d *Database) GetMessageMedia(messageID int64) ([]*models.Media, error) {
+	query := `SELECT ` + mediaColumns + ` FROM media WHERE message_id = ? ORDER BY id`
+
+	rows, err := d.db.Query(query, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query media: %w", err)
+	}
+	defer rows.Close()
+
+	var media []*models.Media
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan media: %w", err)
+		}
+		media = append(media, m)
+	}
+
+	return media, nil
+}
+
+// SaveSearchHit 记录消息被服务器端搜索命中，同一关键词再次命中时只更新时间
+func (d *Database) SaveSearchHit(messageID int64, query string) error {
+	_, err := d.db.Exec(`INSERT INTO search_hits (message_id, query) VALUES (?, ?)
+			  ON CONFLICT(message_id, query) DO UPDATE SET last_found_at = CURRENT_TIMESTAMP`,
+		messageID, query)
+	if err != nil {
+		return fmt.Errorf("failed to save search hit: %w", err)
+	}
+	return nil
+}
+
+// SaveSavedSearch 保存全局搜索，已存在的相同搜索更新首次执行的范围并重新启用
+//
+// 停用后重新启用的搜索会清空上次执行时间，下次执行重新按首次执行的范围搜索。
+func (d *Database) SaveSavedSearch(search *models.SavedSearch) error {
+	_, err := d.db.Exec(`INSERT INTO saved_searches (query, filter, first_run_since, first_run_limit) VALUES (?, ?, ?, ?)
+			  ON CONFLICT(query, filter) DO UPDATE SET 
+			  first_run_since = excluded.first_run_since,
+			  first_run_limit = excluded.first_run_limit,
+			  last_run_at = CASE WHEN is_active = 1 THEN last_run_at ELSE NULL END,
+			  is_active = 1`,
+		search.Query, search.Filter, search.FirstRunSince, search.FirstRunLimit)
+	if err != nil {
+		return fmt.Errorf("failed to save saved search: %w", err)
+	}
+
+	saved, err := scanSavedSearch(d.db.QueryRow(`SELECT `+savedSearchColumns+` FROM saved_searches 
+			  WHERE query = ? AND filter = ?`, search.Query, search.Filter))
+	if err != nil {
+		return fmt.Errorf("failed to get saved search: %w", err)
+	}
+	*search = *saved
+	return nil
+}
+
+// savedSearchColumns saved_searches 的查询列，与 scanSavedSearch 的顺序一致
+const savedSearchColumns = `id, query, filter, is_active, first_run_since, COALESCE(first_run_limit, 0), last_run_at, created_at`
+
+// scanSavedSearch 扫描一行保存的搜索
+func scanSavedSearch(row rowScanner) (*models.SavedSearch, error) {
+	search := &models.SavedSearch{}
+	var firstRunSince, lastRunAt sql.NullTime
+	err := row.Scan(&search.ID, &search.Query, &search.Filter, &search.IsActive,
+		&firstRunSince, &search.FirstRunLimit, &lastRunAt, &search.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if firstRunSince.Valid {
+		search.FirstRunSince = &firstRunSince.Time
+	}
+	if lastRunAt.Valid {
+		search.LastRunAt = &lastRunAt.Time
+	}
+	return search, nil
+}
+
+// GetSavedSearches 获取所有启用的全局搜索，按创建顺序排列
+func (d *Database) GetSavedSearches() ([]*models.SavedSearch, error) {
+	rows, err := d.db.Query(`SELECT ` + savedSearchColumns + ` FROM saved_searches 
+			  WHERE is_active = 1 ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved searches: %w", err)
+	}
+	defer rows.Close()
+
+	var searches []*models.SavedSearch
+	for rows.Next() {
+		search, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan saved search: %w", err)
+		}
+		searches = append(searches, search)
+	}
+	return searches, nil
+}
+
+// MarkSavedSearchRun 记录全局搜索的执行时间
+func (d *Database) MarkSavedSearchRun(id int64, at time.Time) error {
+	if _, err := d.db.Exec(`UPDATE saved_searches SET last_run_at = ? WHERE id = ?`, at, id); err != nil {
+		return fmt.Errorf("failed to mark saved search run: %w", err)
+	}
+	return nil
+}
+
+// DeactivateSavedSearch 停用保存的全局搜索，已保存的命中记录保留
+func (d *Database) DeactivateSavedSearch(id int64) error {
+	result, err := d.db.Exec(`UPDATE saved_searches SET is_active = 0 WHERE id = ? AND is_active = 1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate saved search: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("saved search not found")
+	}
+	return nil
+}
+
+// CreateRequestWait 记录一次请求重试前的等待
+func (d *Database) CreateRequestWait(wait *models.RequestWait) error {
+	query := `INSERT INTO request_waits (method, reason, error, wait_seconds, attempt) 
+			  VALUES (?, ?, ?, ?, ?)`
+	result, err := d.db.Exec(query, wait.Method, wait.Reason, wait.Error, wait.WaitSeconds, wait.Attempt)
+	if err != nil {
+		return fmt.Errorf("failed to create request wait: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+
+	wait.ID = id
+	wait.CreatedAt = time.Now()
+
+	return nil
 }
 
 // Close 关闭数据库连接
@@ -0,0 +1,287 @@
+// Package format 将消息文本和格式实体渲染为 Markdown 或 HTML
+package format
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// Slice 按 UTF-16 偏移截取文本，与 Telegram 实体的 offset/length 对应
+func Slice(text string, offset, length int) string {
+	units := utf16.Encode([]rune(text))
+	if offset < 0 || offset > len(units) {
+		return ""
+	}
+	end := offset + length
+	if end > len(units) {
+		end = len(units)
+	}
+	return string(utf16.Decode(units[offset:end]))
+}
+
+// Markdown 将消息渲染为 Markdown
+//
+// Markdown 没有下划线语法，下划线使用内联 HTML <u> 标记；引用块中的每一行以 "> " 开头。
+func Markdown(text string, entities []*models.MessageEntity) string {
+	return render(text, entities, markdownTags, func(s string, code, quote bool) string {
+		if !code {
+			s = markdownSpecial.Replace(s)
+		}
+		if quote {
+			s = strings.ReplaceAll(s, "\n", "\n> ")
+		}
+		return s
+	})
+}
+
+// HTML 将消息渲染为 HTML，代码块以外的换行转换为 <br>
+func HTML(text string, entities []*models.MessageEntity) string {
+	return render(text, entities, htmlTags, func(s string, code, quote bool) string {
+		if code {
+			return html.EscapeString(s)
+		}
+		return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>\n")
+	})
+}
+
+// escapeFunc 转义普通文本，code 表示文本位于代码或代码块中，quote 表示文本位于引用块中
+type escapeFunc func(s string, code, quote bool) string
+
+// tagFunc 返回实体的开始和结束标记，不需要标记的实体返回空字符串
+type tagFunc func(entity *models.MessageEntity, text string) (open, close string)
+
+// markdownTags Markdown 标记
+func markdownTags(entity *models.MessageEntity, text string) (string, string) {
+	switch entity.Type {
+	case models.EntityBold:
+		return "**", "**"
+	case models.EntityItalic:
+		return "_", "_"
+	case models.EntityUnderline:
+		return "<u>", "</u>"
+	case models.EntityStrike:
+		return "~~", "~~"
+	case models.EntitySpoiler:
+		return "||", "||"
+	case models.EntityCode:
+		fence := codeFence(text, 1)
+		// 内容以反引号开头或结尾时用空格隔开，渲染时两侧的空格会被去掉
+		if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+			return fence + " ", " " + fence
+		}
+		return fence, fence
+	case models.EntityPre:
+		fence := codeFence(text, 3)
+		return fence + entity.Language + "\n", "\n" + fence
+	case models.EntityBlockquote:
+		// Telegram 的引用块覆盖整行，结束后换行，避免下一行被并入引用块
+		return "> ", "\n"
+	case models.EntityTextURL:
+		if !allowedURL(entity.URL) {
+			return "", ""
+		}
+		return "[", "](" + markdownURL.Replace(entity.URL) + ")"
+	case models.EntityMentionName:
+		return "[", fmt.Sprintf("](tg://user?id=%d)", entity.UserID)
+	case models.EntityURL:
+		// 自动链接 <...> 中不处理反斜杠转义，链接文字转义后需使用 [文字](地址) 的形式
+		href := urlHref(text)
+		if !allowedURL(href) {
+			return "", ""
+		}
+		return "[", "](" + markdownURL.Replace(href) + ")"
+	}
+	return "", ""
+}
+
+// htmlTags HTML 标记
+func htmlTags(entity *models.MessageEntity, text string) (string, string) {
+	switch entity.Type {
+	case models.EntityBold:
+		return "<b>", "</b>"
+	case models.EntityItalic:
+		return "<i>", "</i>"
+	case models.EntityUnderline:
+		return "<u>", "</u>"
+	case models.EntityStrike:
+		return "<s>", "</s>"
+	case models.EntitySpoiler:
+		return `<span class="tg-spoiler">`, "</span>"
+	case models.EntityCode:
+		return "<code>", "</code>"
+	case models.EntityPre:
+		if entity.Language != "" {
+			return fmt.Sprintf(`<pre><code class="language-%s">`, html.EscapeString(entity.Language)), "</code></pre>"
+		}
+		return "<pre>", "</pre>"
+	case models.EntityBlockquote:
+		return "<blockquote>", "</blockquote>"
+	case models.EntityTextURL:
+		if !allowedURL(entity.URL) {
+			return "", ""
+		}
+		return fmt.Sprintf(`<a href="%s">`, html.EscapeString(entity.URL)), "</a>"
+	case models.EntityURL:
+		href := urlHref(text)
+		if !allowedURL(href) {
+			return "", ""
+		}
+		return fmt.Sprintf(`<a href="%s">`, html.EscapeString(href)), "</a>"
+	case models.EntityEmail:
+		return fmt.Sprintf(`<a href="mailto:%s">`, html.EscapeString(text)), "</a>"
+	case models.EntityMention:
+		return fmt.Sprintf(`<a href="https://t.me/%s">`, html.EscapeString(strings.TrimPrefix(text, "@"))), "</a>"
+	case models.EntityMentionName:
+		return fmt.Sprintf(`<a href="tg://user?id=%d">`, entity.UserID), "</a>"
+	}
+	return "", ""
+}
+
+// allowedSchemes 允许输出为链接的地址协议，其他协议（如 javascript:）的链接按普通文本输出
+var allowedSchemes = map[string]bool{"http": true, "https": true, "tg": true, "mailto": true}
+
+// allowedURL 判断地址是否可以输出为链接
+func allowedURL(rawURL string) bool {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	return err == nil && allowedSchemes[strings.ToLower(u.Scheme)]
+}
+
+// urlHref 返回 URL 实体的链接地址，没有协议时补全为 https
+func urlHref(text string) string {
+	if !strings.Contains(text, "://") {
+		return "https://" + text
+	}
+	return text
+}
+
+// codeFence 返回比内容中最长的连续反引号更长的代码标记，至少 minLength 个反引号
+func codeFence(text string, minLength int) string {
+	longest, run := 0, 0
+	for _, r := range text {
+		if r != '`' {
+			run = 0
+			continue
+		}
+		run++
+		longest = max(longest, run)
+	}
+	return strings.Repeat("`", max(minLength, longest+1))
+}
+
+// render 按实体的 UTF-16 区间插入标记
+//
+// 实体按开始位置升序、长度降序排列，保证外层实体先打开、后关闭。
+// 与外层实体交叉的实体在外层结束时关闭，剩余部分在外层关闭后重新打开。
+func render(text string, entities []*models.MessageEntity, tags tagFunc, escape escapeFunc) string {
+	units := utf16.Encode([]rune(text))
+
+	sorted := make([]span, 0, len(entities))
+	for _, entity := range entities {
+		if entity.Offset < 0 || entity.Length <= 0 || entity.Offset >= len(units) {
+			continue
+		}
+		end := min(entity.Offset+entity.Length, len(units))
+		sorted = append(sorted, span{entity: entity, text: string(utf16.Decode(units[entity.Offset:end])), start: entity.Offset, end: end})
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].before(sorted[j]) })
+
+	var (
+		b     strings.Builder
+		stack []marker
+		next  int // 下一个待打开的实体
+		pos   int
+	)
+
+	closeUntil := func(p int) {
+		for len(stack) > 0 && stack[len(stack)-1].end <= p {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			b.WriteString(top.close)
+		}
+	}
+
+	for pos <= len(units) {
+		closeUntil(pos)
+		for next < len(sorted) && sorted[next].start == pos {
+			current := sorted[next]
+			next++
+			end := current.end
+			// 与外层实体交叉时截断到外层的结束位置，保证标记正确嵌套，剩余部分稍后重新打开
+			if len(stack) > 0 && end > stack[len(stack)-1].end {
+				end = stack[len(stack)-1].end
+				rest := span{entity: current.entity, text: current.text, start: end, end: current.end}
+				i := next + sort.Search(len(sorted)-next, func(i int) bool { return rest.before(sorted[next+i]) })
+				sorted = append(sorted[:i], append([]span{rest}, sorted[i:]...)...)
+			}
+			open, close := tags(current.entity, current.text)
+			b.WriteString(open)
+			stack = append(stack, marker{entity: current.entity, close: close, end: end})
+		}
+		if pos == len(units) {
+			break
+		}
+
+		// 输出到下一个边界之前的文本
+		boundary := len(units)
+		if next < len(sorted) && sorted[next].start < boundary {
+			boundary = sorted[next].start
+		}
+		if len(stack) > 0 && stack[len(stack)-1].end < boundary {
+			boundary = stack[len(stack)-1].end
+		}
+		b.WriteString(escape(string(utf16.Decode(units[pos:boundary])), inside(stack, models.EntityCode, models.EntityPre), inside(stack, models.EntityBlockquote)))
+		pos = boundary
+	}
+	closeUntil(len(units) + 1)
+
+	return b.String()
+}
+
+// span 待打开的实体区间，交叉实体截断后的剩余部分沿用原实体及其完整文本
+type span struct {
+	entity     *models.MessageEntity
+	text       string
+	start, end int
+}
+
+// before 按开始位置升序、长度降序排列
+func (s span) before(other span) bool {
+	if s.start != other.start {
+		return s.start < other.start
+	}
+	return s.end-s.start > other.end-other.start
+}
+
+// marker 已打开、尚未关闭的实体
+type marker struct {
+	entity *models.MessageEntity
+	close  string
+	end    int
+}
+
+// inside 当前位置是否在指定类型的实体中
+func inside(stack []marker, types ...string) bool {
+	for _, m := range stack {
+		for _, t := range types {
+			if m.entity.Type == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markdownSpecial 需要转义的 Markdown 字符
+var markdownSpecial = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`,
+	"~", `\~`, "|", `\|`, "<", `\<`, ">", `\>`,
+)
+
+// markdownURL 需要转义的 Markdown 链接地址字符，避免括号和空格提前结束链接
+var markdownURL = strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, " ", "%20")
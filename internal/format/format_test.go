@@ -0,0 +1,181 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+func entity(typ string, offset, length int) *models.MessageEntity {
+	return &models.MessageEntity{Type: typ, Offset: offset, Length: length}
+}
+
+func TestSlice(t *testing.T) {
+	tests := []struct {
+		text           string
+		offset, length int
+		want           string
+	}{
+		{"hello world", 6, 5, "world"},
+		{"👍 bold", 3, 4, "bold"}, // emoji 占两个 UTF-16 码元
+		{"中文 link", 3, 4, "link"},
+		{"👍👍", 2, 2, "👍"},
+		{"short", 3, 10, "rt"},
+		{"short", 6, 1, ""},
+	}
+	for _, tt := range tests {
+		if got := Slice(tt.text, tt.offset, tt.length); got != tt.want {
+			t.Errorf("Slice(%q, %d, %d) = %q, want %q", tt.text, tt.offset, tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	textURL := func(offset, length int, url string) *models.MessageEntity {
+		e := entity(models.EntityTextURL, offset, length)
+		e.URL = url
+		return e
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		entities []*models.MessageEntity
+		markdown string
+		html     string
+	}{
+		{
+			name:     "plain",
+			text:     "a_b <c>\nd",
+			markdown: "a\\_b \\<c\\>\nd",
+			html:     "a_b &lt;c&gt;<br>\nd",
+		},
+		{
+			name:     "emoji before entity",
+			text:     "👍 bold",
+			entities: []*models.MessageEntity{entity(models.EntityBold, 3, 4)},
+			markdown: "👍 **bold**",
+			html:     "👍 <b>bold</b>",
+		},
+		{
+			name:     "cjk and emoji before entity",
+			text:     "中文😀 斜体",
+			entities: []*models.MessageEntity{entity(models.EntityItalic, 5, 2)},
+			markdown: "中文😀 _斜体_",
+			html:     "中文😀 <i>斜体</i>",
+		},
+		{
+			name:     "nested",
+			text:     "hello world",
+			entities: []*models.MessageEntity{entity(models.EntityItalic, 6, 5), entity(models.EntityBold, 0, 11)},
+			markdown: "**hello _world_**",
+			html:     "<b>hello <i>world</i></b>",
+		},
+		{
+			name:     "same range",
+			text:     "both",
+			entities: []*models.MessageEntity{entity(models.EntityBold, 0, 4), entity(models.EntityItalic, 0, 4)},
+			markdown: "**_both_**",
+			html:     "<b><i>both</i></b>",
+		},
+		{
+			name:     "overlapping",
+			text:     "hello world",
+			entities: []*models.MessageEntity{entity(models.EntityBold, 0, 7), entity(models.EntityItalic, 6, 5)},
+			markdown: "**hello _w_**_orld_",
+			html:     "<b>hello <i>w</i></b><i>orld</i>",
+		},
+		{
+			name:     "text url",
+			text:     "中文 link",
+			entities: []*models.MessageEntity{textURL(3, 4, "https://example.com/a_(b) c")},
+			markdown: "中文 [link](https://example.com/a_\\(b\\)%20c)",
+			html:     `中文 <a href="https://example.com/a_(b) c">link</a>`,
+		},
+		{
+			name:     "text url overlapping bold",
+			text:     "see docs now",
+			entities: []*models.MessageEntity{entity(models.EntityBold, 0, 6), textURL(4, 8, "https://example.com")},
+			markdown: "**see [do](https://example.com)**[cs now](https://example.com)",
+			html:     `<b>see <a href="https://example.com">do</a></b><a href="https://example.com">cs now</a>`,
+		},
+		{
+			name:     "code is not escaped",
+			text:     "run a_b",
+			entities: []*models.MessageEntity{entity(models.EntityCode, 4, 3)},
+			markdown: "run `a_b`",
+			html:     "run <code>a_b</code>",
+		},
+		{
+			name:     "url",
+			text:     "see https://a.com/x_y",
+			entities: []*models.MessageEntity{entity(models.EntityURL, 4, 17)},
+			markdown: "see [https://a.com/x\\_y](https://a.com/x_y)",
+			html:     `see <a href="https://a.com/x_y">https://a.com/x_y</a>`,
+		},
+		{
+			name:     "url without scheme",
+			text:     "t.me/a_b",
+			entities: []*models.MessageEntity{entity(models.EntityURL, 0, 8)},
+			markdown: "[t.me/a\\_b](https://t.me/a_b)",
+			html:     `<a href="https://t.me/a_b">t.me/a_b</a>`,
+		},
+		{
+			name:     "text url with unsafe scheme",
+			text:     "click me",
+			entities: []*models.MessageEntity{textURL(0, 5, "JavaScript:alert(1)"), entity(models.EntityBold, 6, 2)},
+			markdown: "click **me**",
+			html:     "click <b>me</b>",
+		},
+		{
+			name:     "text url with tg and mailto schemes",
+			text:     "user mail",
+			entities: []*models.MessageEntity{textURL(0, 4, "tg://resolve?domain=a"), textURL(5, 4, "mailto:a@b.c")},
+			markdown: "[user](tg://resolve?domain=a) [mail](mailto:a@b.c)",
+			html:     `<a href="tg://resolve?domain=a">user</a> <a href="mailto:a@b.c">mail</a>`,
+		},
+		{
+			name:     "code with backticks",
+			text:     "a`b and `c``",
+			entities: []*models.MessageEntity{entity(models.EntityCode, 0, 3), entity(models.EntityCode, 8, 4)},
+			markdown: "``a`b`` and ``` `c`` ```",
+			html:     "<code>a`b</code> and <code>`c``</code>",
+		},
+		{
+			name:     "pre with fence",
+			text:     "```\nx",
+			entities: []*models.MessageEntity{entity(models.EntityPre, 0, 5)},
+			markdown: "````\n```\nx\n````",
+			html:     "<pre>```\nx</pre>",
+		},
+		{
+			name:     "underline",
+			text:     "under",
+			entities: []*models.MessageEntity{entity(models.EntityUnderline, 0, 5)},
+			markdown: "<u>under</u>",
+			html:     "<u>under</u>",
+		},
+		{
+			name:     "blockquote",
+			text:     "line one\nline two\nafter",
+			entities: []*models.MessageEntity{entity(models.EntityBlockquote, 0, 17)},
+			markdown: "> line one\n> line two\n\nafter",
+			html:     "<blockquote>line one<br>\nline two</blockquote><br>\nafter",
+		},
+		{
+			name:     "invalid entities are skipped",
+			text:     "text",
+			entities: []*models.MessageEntity{entity(models.EntityBold, 10, 2), entity(models.EntityItalic, 1, 0)},
+			markdown: "text",
+			html:     "text",
+		},
+	}
+	for _, tt := range tests {
+		if got := Markdown(tt.text, tt.entities); got != tt.markdown {
+			t.Errorf("%s: Markdown = %q, want %q", tt.name, got, tt.markdown)
+		}
+		if got := HTML(tt.text, tt.entities); got != tt.html {
+			t.Errorf("%s: HTML = %q, want %q", tt.name, got, tt.html)
+		}
+	}
+}
@@ -17,13 +17,34 @@ type User struct {
 type Channel struct {
 	ID          int64     `json:"id" db:"id"`
 	TelegramID  int64     `json:"telegram_id" db:"telegram_id"`
+	AccessHash  int64     `json:"access_hash" db:"access_hash"`
 	Username    string    `json:"username" db:"username"`
 	Title       string    `json:"title" db:"title"`
 	Description string    `json:"description" db:"description"`
 	MemberCount int32     `json:"member_count" db:"member_count"`
+	Kind        string    `json:"kind,omitempty" db:"kind"` // 广播频道或超级群组，尚未获取时为空
 	IsActive    bool      `json:"is_active" db:"is_active"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+
+	// 以下字段来自 channels.getFullChannel，ProfileUpdatedAt 为空表示尚未获取
+	LinkedChatID      int64      `json:"linked_chat_id,omitempty" db:"linked_chat_id"` // 关联讨论组的 Telegram ID
+	PinnedMessageID   int64      `json:"pinned_message_id,omitempty" db:"pinned_message_id"`
+	SlowModeSeconds   int        `json:"slow_mode_seconds,omitempty" db:"slow_mode_seconds"`
+	TelegramCreatedAt *time.Time `json:"telegram_created_at,omitempty" db:"telegram_created_at"` // 频道在 Telegram 上的创建时间
+	ProfileUpdatedAt  *time.Time `json:"profile_updated_at,omitempty" db:"profile_updated_at"`
+}
+
+// 频道类型
+const (
+	ChannelBroadcast = "broadcast" // 广播频道，只有管理员可以发帖
+	ChannelMegagroup = "megagroup" // 超级群组，成员都可以发言
+	ChannelGigagroup = "gigagroup" // 广播群组，成员数超过超级群组上限后由超级群组转换而来
+)
+
+// IsGroup 是否为群组（超级群组或广播群组）
+func (c *Channel) IsGroup() bool {
+	return c.Kind == ChannelMegagroup || c.Kind == ChannelGigagroup
 }
 
 // Subscription 订阅模型
@@ -41,17 +62,332 @@ type Message struct {
 	ID         int64     `json:"id" db:"id"`
 	TelegramID int64     `json:"telegram_id" db:"telegram_id"`
 	ChannelID  int64     `json:"channel_id" db:"channel_id"`
+	SenderType string    `json:"sender_type,omitempty" db:"sender_type"` // 发送者类型，频道自身发布且未签名时为空
 	SenderID   int64     `json:"sender_id" db:"sender_id"`
-	SenderName string    `json:"sender_name" db:"sender_name"`
+	SenderName string    `json:"sender_name" db:"sender_name"`           // 第一次保存消息时发送者的名称
+	PostAuthor string    `json:"post_author,omitempty" db:"post_author"` // 开启签名的频道中帖子的作者签名
+	ReplyToID  int64     `json:"reply_to_id,omitempty" db:"reply_to_id"` // 回复的消息 ID，不是回复时为 0
+	ThreadID   int64     `json:"thread_id,omitempty" db:"thread_id"`     // 回复串的根消息 ID，直接回复根消息时为 0
 	Text       string    `json:"text" db:"text"`
 	MediaType  string    `json:"media_type" db:"media_type"`
 	MediaURL   string    `json:"media_url" db:"media_url"`
 	Views      int32     `json:"views" db:"views"`
 	Forwards   int32     `json:"forwards" db:"forwards"`
 	Replies    int32     `json:"replies" db:"replies"`
+	Reactions  int32     `json:"reactions" db:"reactions"`             // 所有回应的总数
+	GroupedID  int64     `json:"grouped_id,omitempty" db:"grouped_id"` // 相册 ID，同一相册的消息相同
+	Date       time.Time `json:"date" db:"date"`
+	// EditDate 最后一次编辑的时间，未编辑过时为 nil
+	EditDate *time.Time `json:"edit_date,omitempty" db:"edit_date"`
+	// DeletedAt 发现消息已被频道删除的时间，未删除时为 nil
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+
+	// Forward 转发来源，不是转发的消息为 nil
+	Forward  *ForwardHeader   `json:"forward,omitempty" db:"-"`
+	Entities []*MessageEntity `json:"entities,omitempty" db:"-"`
+}
+
+// 消息发送者类型
+const (
+	SenderUser    = "user"
+	SenderChannel = "channel" // 以频道身份发言，包括匿名管理员
+	SenderChat    = "chat"
+)
+
+// Sender 见过的消息发送者
+//
+// 保存发送者最近一次出现时的名称，用于响应中没有附带发送者信息时解析名称。
+type Sender struct {
+	ID         int64     `json:"id" db:"id"`
+	PeerType   string    `json:"peer_type" db:"peer_type"`
+	TelegramID int64     `json:"telegram_id" db:"telegram_id"`
+	Name       string    `json:"name" db:"name"`
+	Username   string    `json:"username,omitempty" db:"username"`
+	FirstSeen  time.Time `json:"first_seen" db:"first_seen"`
+	LastSeen   time.Time `json:"last_seen" db:"last_seen"`
+}
+
+// 群组成员变动类型
+const (
+	MemberJoined  = "join"   // 自己加入，包括通过邀请链接和加入申请
+	MemberAdded   = "add"    // 被其他成员拉入
+	MemberLeft    = "leave"  // 自己退出
+	MemberRemoved = "remove" // 被管理员移出
+)
+
+// MemberEvent 群组中一条服务消息记录的成员变动
+type MemberEvent struct {
+	ID        int64     `json:"id" db:"id"`
+	ChannelID int64     `json:"channel_id" db:"channel_id"`
+	MessageID int64     `json:"message_id" db:"message_id"` // 服务消息的 Telegram ID
+	UserID    int64     `json:"user_id" db:"user_id"`       // 加入或离开的成员
+	ActorID   int64     `json:"actor_id" db:"actor_id"`     // 拉人或移出成员的用户，通过邀请链接加入时为链接的创建者
+	Action    string    `json:"action" db:"action"`
+	Date      time.Time `json:"date" db:"date"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// 群组成员角色
+const (
+	RoleCreator = "creator"
+	RoleAdmin   = "admin"
+	RoleMember  = "member"
+	RoleBanned  = "banned" // 被限制或封禁的成员
+)
+
+// ParticipantSnapshot 某一时刻群组成员列表的快照
+type ParticipantSnapshot struct {
+	ID           int64          `json:"id" db:"id"`
+	ChannelID    int64          `json:"channel_id" db:"channel_id"`
+	Total        int            `json:"total" db:"total"` // 服务器返回的成员总数，可能多于能获取到的成员
+	CapturedAt   time.Time      `json:"captured_at" db:"captured_at"`
+	Participants []*Participant `json:"participants,omitempty" db:"-"`
+}
+
+// Participant 成员快照中的一个成员
+type Participant struct {
+	SnapshotID int64      `json:"snapshot_id" db:"snapshot_id"`
+	UserID     int64      `json:"user_id" db:"user_id"`
+	Name       string     `json:"name,omitempty" db:"-"` // 查询时从 senders 表关联
+	Role       string     `json:"role" db:"role"`
+	Rank       string     `json:"rank,omitempty" db:"rank"` // 管理员头衔
+	InviterID  int64      `json:"inviter_id,omitempty" db:"inviter_id"`
+	JoinedAt   *time.Time `json:"joined_at,omitempty" db:"joined_at"`
+}
+
+// Reaction 一种回应及其数量
+type Reaction struct {
+	Emoji         string `json:"emoji,omitempty" db:"emoji"`                     // 普通表情回应
+	CustomEmojiID int64  `json:"custom_emoji_id,omitempty" db:"custom_emoji_id"` // 自定义表情回应
+	Count         int    `json:"count" db:"count"`
+}
+
+// ReactionSnapshot 某一时刻消息的回应统计
+//
+// 每次抓取到消息时如果回应发生了变化就记录一个快照，用于观察回应随时间的变化。
+type ReactionSnapshot struct {
+	ID         int64       `json:"id" db:"id"`
+	MessageID  int64       `json:"message_id" db:"message_id"`
+	Total      int         `json:"total" db:"total"`
+	Reactions  []*Reaction `json:"reactions" db:"-"`
+	CapturedAt time.Time   `json:"captured_at" db:"captured_at"`
+}
+
+// ChannelSnapshot 某一时刻频道的成员和发帖统计
+//
+// serve 按 snapshot_interval 定期记录，用于观察频道随时间的增长。
+type ChannelSnapshot struct {
+	ID          int64     `json:"id" db:"id"`
+	ChannelID   int64     `json:"channel_id" db:"channel_id"`
+	MemberCount int32     `json:"member_count" db:"member_count"`
+	OnlineCount int32     `json:"online_count" db:"online_count"`
+	PostsPerDay float64   `json:"posts_per_day" db:"posts_per_day"` // 最近 7 天平均每天的帖子数，相册算一条
+	AvgViews    float64   `json:"avg_views" db:"avg_views"`         // 最近帖子的平均浏览数
+	CapturedAt  time.Time `json:"captured_at" db:"captured_at"`
+}
+
+// SavedSearch 保存的全局搜索
+//
+// serve 按 saved_search_interval 定期重新执行，只搜索上次执行之后发布的帖子。
+type SavedSearch struct {
+	ID            int64      `json:"id" db:"id"`
+	Query         string     `json:"query" db:"query"`
+	Filter        string     `json:"filter,omitempty" db:"filter"`
+	IsActive      bool       `json:"is_active" db:"is_active"`
+	FirstRunSince *time.Time `json:"first_run_since,omitempty" db:"first_run_since"` // 首次执行只查找此时间之后的帖子
+	FirstRunLimit int        `json:"first_run_limit,omitempty" db:"first_run_limit"` // 首次执行最多保存的消息数量，0 表示不限制
+	LastRunAt     *time.Time `json:"last_run_at,omitempty" db:"last_run_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Poll 消息中的投票或测验
+type Poll struct {
+	ID             int64      `json:"id" db:"id"`
+	MessageID      int64      `json:"message_id" db:"message_id"`
+	TelegramID     int64      `json:"telegram_id" db:"telegram_id"` // 投票 ID，转发的投票与原投票相同
+	Question       string     `json:"question" db:"question"`
+	Quiz           bool       `json:"quiz" db:"quiz"`
+	MultipleChoice bool       `json:"multiple_choice" db:"multiple_choice"`
+	PublicVoters   bool       `json:"public_voters" db:"public_voters"`
+	Closed         bool       `json:"closed" db:"closed"`
+	CloseDate      *time.Time `json:"close_date,omitempty" db:"close_date"` // 定时关闭的时间
+	TotalVoters    int        `json:"total_voters" db:"total_voters"`
+	Solution       string     `json:"solution,omitempty" db:"solution"` // 测验的解析
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+
+	Answers []*PollAnswer `json:"answers" db:"-"`
+}
+
+// PollAnswer 投票选项及其票数
+type PollAnswer struct {
+	ID       int64  `json:"id" db:"id"`
+	PollID   int64  `json:"poll_id" db:"poll_id"`
+	Position int    `json:"position" db:"position"`
+	Option   string `json:"option" db:"option"` // 选项标识的十六进制编码
+	Text     string `json:"text" db:"text"`
+	Voters   int    `json:"voters" db:"voters"`
+	Correct  bool   `json:"correct" db:"correct"` // 测验的正确答案，投票结束或已作答后才可见
+}
+
+// Album 一条逻辑上的帖子
+//
+// 相册在 Telegram 中是多条 grouped_id 相同的消息，每条消息带一个媒体，
+// 说明文字通常只在其中一条消息上。普通消息是只有一条消息的 Album。
+type Album struct {
+	GroupedID int64      `json:"grouped_id,omitempty"`
+	Messages  []*Message `json:"messages"` // 按消息 ID 升序排列
+}
+
+// Caption 返回携带说明文字的消息，没有说明文字时返回第一条消息
+func (a *Album) Caption() *Message {
+	for _, message := range a.Messages {
+		if message.Text != "" {
+			return message
+		}
+	}
+	return a.Messages[0]
+}
+
+// 转发来源类型
+const (
+	ForwardFromChannel = "channel"
+	ForwardFromUser    = "user"
+	ForwardFromChat    = "chat"
+	ForwardFromHidden  = "hidden" // 原作者隐藏了账号，只有显示名称
+)
+
+// ForwardHeader 转发消息的来源信息，保存在 messages 表的 fwd_* 列中
+type ForwardHeader struct {
+	FromType   string    `json:"from_type" db:"fwd_from_type"`
+	FromID     int64     `json:"from_id,omitempty" db:"fwd_from_id"`
+	FromName   string    `json:"from_name,omitempty" db:"fwd_from_name"`
+	MessageID  int64     `json:"message_id,omitempty" db:"fwd_message_id"` // 原频道中的消息 ID
+	Date       time.Time `json:"date" db:"fwd_date"`                       // 原消息的发布时间
+	PostAuthor string    `json:"post_author,omitempty" db:"fwd_post_author"`
+	Imported   bool      `json:"imported" db:"fwd_imported"` // 是否从其他应用导入
+}
+
+// ForwardSource 频道转发内容的来源统计
+type ForwardSource struct {
+	FromType      string    `json:"from_type"`
+	FromID        int64     `json:"from_id"`
+	Name          string    `json:"name"`               // 来源频道标题或隐藏账号的显示名称
+	Username      string    `json:"username,omitempty"` // 来源频道用户名
+	Count         int       `json:"count"`
+	LastForwarded time.Time `json:"last_forwarded"`
+}
+
+// MessageVersion 消息的一个历史版本
+//
+// 只有内容（文本或媒体）发生过变化的消息才会记录版本，
+// 第一个版本是检测到编辑之前保存的内容。
+type MessageVersion struct {
+	ID        int64     `json:"id" db:"id"`
+	MessageID int64     `json:"message_id" db:"message_id"`
+	Version   int       `json:"version" db:"version"`
+	Text      string    `json:"text" db:"text"`
+	MediaType string    `json:"media_type" db:"media_type"`
+	MediaURL  string    `json:"media_url" db:"media_url"`
+	EditDate  time.Time `json:"edit_date" db:"edit_date"` // 该版本生效的时间
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Comment 频道帖子在讨论组中的评论
+type Comment struct {
+	ID         int64     `json:"id" db:"id"`
+	MessageID  int64     `json:"message_id" db:"message_id"`   // 所属帖子的数据库 ID
+	ChatID     int64     `json:"chat_id" db:"chat_id"`         // 讨论组的 Telegram ID
+	TelegramID int64     `json:"telegram_id" db:"telegram_id"` // 评论在讨论组中的消息 ID
+	AuthorID   int64     `json:"author_id" db:"author_id"`
+	AuthorName string    `json:"author_name" db:"author_name"`
+	Text       string    `json:"text" db:"text"`
+	ReplyToID  int64     `json:"reply_to_id" db:"reply_to_id"` // 回复的评论 ID，直接评论帖子时为 0
 	Date       time.Time `json:"date" db:"date"`
 	CreatedAt  time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// 消息实体类型
+const (
+	EntityBold        = "bold"
+	EntityItalic      = "italic"
+	EntityUnderline   = "underline"
+	EntityStrike      = "strike"
+	EntitySpoiler     = "spoiler"
+	EntityCode        = "code"
+	EntityPre         = "pre"
+	EntityBlockquote  = "blockquote"
+	EntityURL         = "url"
+	EntityTextURL     = "text_url"
+	EntityEmail       = "email"
+	EntityPhone       = "phone"
+	EntityMention     = "mention"
+	EntityMentionName = "mention_name"
+	EntityHashtag     = "hashtag"
+	EntityCashtag     = "cashtag"
+	EntityBotCommand  = "bot_command"
+	EntityBankCard    = "bank_card"
+	EntityCustomEmoji = "custom_emoji"
+	EntityUnknown     = "unknown"
+)
+
+// MessageEntity 消息格式实体（加粗、链接、提及、话题标签等）
+//
+// Offset 和 Length 与 Telegram 一致，以 UTF-16 码元为单位。
+type MessageEntity struct {
+	ID            int64  `json:"id" db:"id"`
+	MessageID     int64  `json:"message_id" db:"message_id"`
+	Type          string `json:"type" db:"type"`
+	Offset        int    `json:"offset" db:"offset"`
+	Length        int    `json:"length" db:"length"`
+	Text          string `json:"text" db:"text"`
+	URL           string `json:"url,omitempty" db:"url"`
+	UserID        int64  `json:"user_id,omitempty" db:"user_id"`
+	Language      string `json:"language,omitempty" db:"language"`
+	CustomEmojiID int64  `json:"custom_emoji_id,omitempty" db:"custom_emoji_id"`
+}
+
+// Media 消息中下载到本地的媒体文件
+//
+// 文件按内容的 SHA-256 存储，相同的文件在不同频道、不同消息之间只保存一份。
+type Media struct {
+	ID        int64     `json:"id" db:"id"`
+	MessageID int64     `json:"message_id" db:"message_id"`
+	MediaType string    `json:"media_type" db:"media_type"`
+	FileID    int64     `json:"file_id" db:"file_id"`
+	FileName  string    `json:"file_name" db:"file_name"`
+	MimeType  string    `json:"mime_type" db:"mime_type"`
+	Size      int64     `json:"size" db:"size"`
+	Width     int       `json:"width" db:"width"`
+	Height    int       `json:"height" db:"height"`
+	SHA256    string    `json:"sha256" db:"sha256"`
+	LocalPath string    `json:"local_path" db:"local_path"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// ChannelState 频道更新状态，记录已处理到的 pts，用于重启后补齐缺失的更新
+type ChannelState struct {
+	ChannelID int64     `json:"channel_id" db:"channel_id"`
+	Pts       int       `json:"pts" db:"pts"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// 请求等待原因
+const (
+	WaitReasonFloodWait = "flood_wait" // 服务器返回 FLOOD_WAIT_X
+	WaitReasonTransient = "transient"  // 临时性错误后的退避
+)
+
+// RequestWait 请求重试前的一次等待记录，用于调整请求间隔
+type RequestWait struct {
+	ID          int64     `json:"id" db:"id"`
+	Method      string    `json:"method" db:"method"`
+	Reason      string    `json:"reason" db:"reason"`
+	Error       string    `json:"error" db:"error"`
+	WaitSeconds int       `json:"wait_seconds" db:"wait_seconds"`
+	Attempt     int       `json:"attempt" db:"attempt"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 }
 
 // Config 配置模型
@@ -82,7 +418,39 @@ type LoggingConfig struct {
 }
 
 type ScraperConfig struct {
-	BatchSize            int `mapstructure:"batch_size"`
-	DelayBetweenRequests int `mapstructure:"delay_between_requests"`
-	MaxRetries           int `mapstructure:"max_retries"`
+	BatchSize                   int `mapstructure:"batch_size"`
+	DelayBetweenRequests        int `mapstructure:"delay_between_requests"`
+	MaxRetries                  int `mapstructure:"max_retries"`
+	PollInterval                int `mapstructure:"poll_interval"`
+	SubscriptionRefreshInterval int `mapstructure:"subscription_refresh_interval"`
+	VerifyInterval              int `mapstructure:"verify_interval"`
+	VerifyRecentMessages        int `mapstructure:"verify_recent_messages"`
+	ProfileRefreshInterval      int `mapstructure:"profile_refresh_interval"`
+	SnapshotInterval            int `mapstructure:"snapshot_interval"`
+	SavedSearchInterval         int `mapstructure:"saved_search_interval"`
+	// RequestsPerMinute 所有请求共享的全局限额，并发抓取时由所有 worker 共享
+	RequestsPerMinute int `mapstructure:"requests_per_minute"`
+	// FetchWorkers 批量抓取多个频道时同时抓取的频道数量
+	FetchWorkers int `mapstructure:"fetch_workers"`
+	// Comments 是否抓取帖子在讨论组中的评论
+	Comments bool `mapstructure:"comments"`
+
+	Media MediaConfig `mapstructure:"media"`
+}
+
+// MediaConfig 媒体下载配置，默认关闭
+type MediaConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Directory string `mapstructure:"directory"`
+	// Channels 允许下载媒体的频道（用户名或 Telegram ID），为空表示所有频道
+	Channels []string        `mapstructure:"channels"`
+	Photo    MediaTypeConfig `mapstructure:"photo"`
+	Document MediaTypeConfig `mapstructure:"document"`
+}
+
+// MediaTypeConfig 单种媒体类型的下载配置
+type MediaTypeConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MaxSize 单个文件的最大字节数，0 表示不限制
+	MaxSize int64 `mapstructure:"max_size"`
 }
@@ -0,0 +1,113 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// ChannelTarget 批量抓取中的一个频道，依次使用 TelegramID、InviteLink 和 Username
+type ChannelTarget struct {
+	TelegramID int64
+	InviteLink string // 私有频道的邀请链接
+	Username   string
+}
+
+// String 返回频道的显示名称
+func (t ChannelTarget) String() string {
+	if t.TelegramID != 0 {
+		return fmt.Sprintf("ID %d", t.TelegramID)
+	}
+	if t.InviteLink != "" {
+		return t.InviteLink
+	}
+	return t.Username
+}
+
+// ChannelInfo 获取目标对应的频道信息，join 为 true 时允许通过邀请链接加入频道
+func (s *Scraper) ChannelInfo(ctx context.Context, target ChannelTarget, join bool) (*models.Channel, error) {
+	if target.TelegramID != 0 {
+		return s.FetchChannelInfoByID(ctx, target.TelegramID)
+	}
+	if target.InviteLink != "" {
+		return s.FetchChannelInfoByInvite(ctx, target.InviteLink, join)
+	}
+	return s.FetchChannelInfo(ctx, target.Username)
+}
+
+// FetchResult 单个频道的抓取结果
+type FetchResult struct {
+	Target ChannelTarget
+	Err    error
+}
+
+// fetchWorkers 同时抓取的频道数量
+func (s *Scraper) fetchWorkers() int {
+	if s.config.FetchWorkers <= 0 {
+		return 4 // 默认值
+	}
+	return s.config.FetchWorkers
+}
+
+// FetchChannels 用固定数量的 worker 并发抓取多个频道的历史消息
+//
+// workers 为 0 时使用配置中的 fetch_workers。所有 worker 共享同一个全局限流器，
+// 并发数只影响同时进行的频道数量，不会增加总的请求频率。
+// 单个频道失败不影响其他频道，结果按 targets 的顺序返回。
+func (s *Scraper) FetchChannels(ctx context.Context, targets []ChannelTarget, opts FetchOptions, workers int) []FetchResult {
+	if workers <= 0 {
+		workers = s.fetchWorkers()
+	}
+	if workers > len(targets) {
+		workers = len(targets)
+	}
+
+	results := make([]FetchResult, len(targets))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results[index] = FetchResult{
+					Target: targets[index],
+					Err:    s.fetchTarget(ctx, targets[index], opts),
+				}
+			}
+		}()
+	}
+
+	for i := range targets {
+		if ctx.Err() != nil {
+			// 未开始的频道记录取消原因
+			results[i] = FetchResult{Target: targets[i], Err: ctx.Err()}
+			continue
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// fetchTarget 抓取单个频道并输出结果日志
+func (s *Scraper) fetchTarget(ctx context.Context, target ChannelTarget, opts FetchOptions) error {
+	var err error
+	if target.TelegramID != 0 {
+		err = s.FetchChannelHistoryByID(ctx, target.TelegramID, opts)
+	} else if target.InviteLink != "" {
+		err = s.FetchChannelHistoryByInvite(ctx, target.InviteLink, opts)
+	} else {
+		err = s.FetchChannelHistory(ctx, target.Username, opts)
+	}
+	if err != nil {
+		log.Printf("频道 %s 抓取失败: %v", target, err)
+		return err
+	}
+	log.Printf("频道 %s 的历史消息抓取完成", target)
+	return nil
+}
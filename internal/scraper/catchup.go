@@ -0,0 +1,133 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/gotd/td/tg"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// catchUp 通过 updates.getChannelDifference 补齐上次保存的 pts 之后的所有更新
+//
+// 包括新消息、编辑和删除。没有保存过 pts 或差异过大时，
+// 改为按消息 ID 拉取缺失的新消息，并以服务器当前的 pts 作为新的起点。
+func (s *Scraper) catchUp(ctx context.Context, live *liveChannel) error {
+	live.applyMu.Lock()
+	defer live.applyMu.Unlock()
+
+	channel, err := s.peers.resolveID(ctx, live.channel.TelegramID)
+	if err != nil {
+		return fmt.Errorf("解析频道失败: %w", err)
+	}
+
+	pts := live.currentPts()
+	if pts == 0 {
+		log.Printf("频道 %s 没有保存的更新状态，按消息 ID 补齐", channel.Title)
+		return s.catchUpByHistory(ctx, live, channel, nil)
+	}
+
+	// 普通账号每次最多获取 100 条差异
+	limit := s.pageSize()
+	if limit > 100 {
+		limit = 100
+	}
+
+	applied := 0
+	for {
+		diff, err := s.client.UpdatesGetChannelDifference(ctx, &tg.UpdatesGetChannelDifferenceRequest{
+			Channel: inputChannel(channel),
+			Filter:  &tg.ChannelMessagesFilterEmpty{},
+			Pts:     pts,
+			Limit:   limit,
+		})
+		if err != nil {
+			return fmt.Errorf("获取频道差异失败 (pts: %d): %w", pts, err)
+		}
+
+		switch d := diff.(type) {
+		case *tg.UpdatesChannelDifferenceEmpty:
+			s.savePts(live, d.Pts)
+			if applied > 0 {
+				log.Printf("频道 %s 补齐完成，共应用 %d 条更新", channel.Title, applied)
+			}
+			return nil
+		case *tg.UpdatesChannelDifference:
+			s.peers.remember(d.Chats)
+			s.senders.remember(d.Users, d.Chats)
+			// 写入失败时不推进 pts，下次补齐从上一页的 pts 重新获取
+			for _, msg := range d.NewMessages {
+				if err := s.applyNewMessage(ctx, live, msg); err != nil {
+					return fmt.Errorf("补齐差异失败 (pts: %d): %w", pts, err)
+				}
+			}
+			for _, update := range d.OtherUpdates {
+				if err := s.applyUpdate(ctx, live, update); err != nil {
+					return fmt.Errorf("补齐差异失败 (pts: %d): %w", pts, err)
+				}
+			}
+			applied += len(d.NewMessages) + len(d.OtherUpdates)
+			pts = d.Pts
+			s.savePts(live, pts)
+			if d.Final {
+				log.Printf("频道 %s 补齐完成，共应用 %d 条更新", channel.Title, applied)
+				return nil
+			}
+		case *tg.UpdatesChannelDifferenceTooLong:
+			s.peers.remember(d.Chats)
+			log.Printf("频道 %s 的差异过大，改为按消息 ID 补齐", channel.Title)
+			return s.catchUpByHistory(ctx, live, channel, d.Dialog)
+		default:
+			return fmt.Errorf("无效的差异响应类型: %T", diff)
+		}
+	}
+}
+
+// catchUpByHistory 按消息 ID 拉取缺失的新消息，并记录服务器当前的 pts
+func (s *Scraper) catchUpByHistory(ctx context.Context, live *liveChannel, channel *models.Channel, dialog tg.DialogClass) error {
+	lastMessageID, _ := live.snapshot()
+	if lastMessageID == 0 {
+		// 本地还没有任何消息，历史消息交给 fetch 命令抓取，这里只记录起点
+		log.Printf("频道 %s 暂无本地消息，可使用 fetch 命令抓取历史消息", channel.Title)
+	} else {
+		newestID, err := s.checkNewMessages(ctx, channel, lastMessageID)
+		if err != nil {
+			return err
+		}
+		live.advance(newestID)
+	}
+
+	var err error
+	pts := 0
+	if d, ok := dialog.(*tg.Dialog); ok {
+		pts = d.Pts
+	}
+	if pts == 0 {
+		if pts, err = s.channelPts(ctx, channel); err != nil {
+			return err
+		}
+	}
+
+	// 差异过大时旧的 pts 已失效，直接以服务器的 pts 为准
+	live.mu.Lock()
+	live.pts = 0
+	live.mu.Unlock()
+	s.savePts(live, pts)
+	return nil
+}
+
+// channelPts 通过 ChannelsGetFullChannel 获取频道当前的 pts
+func (s *Scraper) channelPts(ctx context.Context, channel *models.Channel) (int, error) {
+	full, err := s.client.ChannelsGetFullChannel(ctx, inputChannel(channel))
+	if err != nil {
+		return 0, fmt.Errorf("获取频道完整信息失败: %w", err)
+	}
+	s.peers.remember(full.Chats)
+
+	channelFull, ok := full.FullChat.(*tg.ChannelFull)
+	if !ok {
+		return 0, fmt.Errorf("无效的频道完整信息类型: %T", full.FullChat)
+	}
+	return channelFull.Pts, nil
+}
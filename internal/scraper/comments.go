@@ -0,0 +1,144 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// fetchComments 通过 messages.getReplies 抓取帖子在讨论组中的评论
+//
+// 只抓取比已保存评论更新的评论，帖子没有开启评论或没有新评论时不发出请求。
+func (s *Scraper) fetchComments(ctx context.Context, channel *models.Channel, message *tg.Message) error {
+	replies, ok := message.GetReplies()
+	if !ok || !replies.Comments || replies.Replies == 0 {
+		return nil
+	}
+
+	post, err := s.db.GetMessageByTelegramID(channel.ID, int64(message.ID))
+	if err != nil {
+		return err
+	}
+	lastID, err := s.db.GetLastCommentID(post.ID)
+	if err != nil {
+		return err
+	}
+	if maxID, ok := replies.GetMaxID(); ok && int64(maxID) <= lastID {
+		return nil
+	}
+
+	pageSize := s.pageSize()
+	offsetID := 0
+	saved := 0
+
+	for {
+		result, err := s.client.MessagesGetReplies(ctx, &tg.MessagesGetRepliesRequest{
+			Peer:     inputPeer(channel),
+			MsgID:    message.ID,
+			OffsetID: offsetID,
+			Limit:    pageSize,
+			MinID:    int(lastID),
+		})
+		if err != nil {
+			return fmt.Errorf("获取评论失败 (帖子 %d): %w", message.ID, err)
+		}
+		modified, ok := result.AsModified()
+		if !ok {
+			return fmt.Errorf("无效的评论响应类型: %T", result)
+		}
+		s.peers.remember(modified.GetChats())
+		s.senders.remember(modified.GetUsers(), modified.GetChats())
+
+		users := tg.UserClassArray(modified.GetUsers()).UserToMap()
+		chats := tg.ChatClassArray(modified.GetChats()).ChannelToMap()
+		msgs := modified.GetMessages()
+
+		for _, msg := range msgs {
+			comment, ok := msg.(*tg.Message)
+			if !ok {
+				continue
+			}
+			commentModel := buildComment(comment, replies.ChannelID, users, chats)
+			commentModel.MessageID = post.ID
+			if err := s.db.SaveComment(commentModel); err != nil {
+				log.Printf("保存评论失败: %v", err)
+				continue
+			}
+			saved++
+		}
+
+		if len(msgs) < pageSize {
+			break
+		}
+		offsetID = msgs[len(msgs)-1].GetID()
+
+		// 只在翻页之间等待，第一页紧跟在历史消息之后请求
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.delay):
+		}
+	}
+
+	if saved > 0 {
+		log.Printf("帖子 %d 新增 %d 条评论", message.ID, saved)
+	}
+	return nil
+}
+
+// buildComment 将讨论组中的消息转换为评论模型
+func buildComment(message *tg.Message, chatID int64, users map[int64]*tg.User, chats map[int64]*tg.Channel) *models.Comment {
+	comment := &models.Comment{
+		ChatID:     chatID,
+		TelegramID: int64(message.ID),
+		Text:       message.Message,
+		Date:       time.Unix(int64(message.Date), 0),
+	}
+
+	if from, ok := message.GetFromID(); ok {
+		comment.AuthorID, comment.AuthorName = peerName(from, users, chats)
+	}
+
+	// 回复其他评论时 reply_to_top_id 指向帖子在讨论组中的副本
+	if header, ok := message.ReplyTo.(*tg.MessageReplyHeader); ok {
+		if _, ok := header.GetReplyToTopID(); ok {
+			if replyTo, ok := header.GetReplyToMsgID(); ok {
+				comment.ReplyToID = int64(replyTo)
+			}
+		}
+	}
+	return comment
+}
+
+// peerName 返回发送者的 ID 和显示名称
+func peerName(peer tg.PeerClass, users map[int64]*tg.User, chats map[int64]*tg.Channel) (int64, string) {
+	switch p := peer.(type) {
+	case *tg.PeerUser:
+		if user, ok := users[p.UserID]; ok {
+			return p.UserID, userDisplayName(user)
+		}
+		return p.UserID, ""
+	case *tg.PeerChannel:
+		if channel, ok := chats[p.ChannelID]; ok {
+			return p.ChannelID, channel.Title
+		}
+		return p.ChannelID, ""
+	case *tg.PeerChat:
+		return p.ChatID, ""
+	}
+	return 0, ""
+}
+
+// userDisplayName 用户的显示名称，没有姓名时使用用户名
+func userDisplayName(user *tg.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = user.Username
+	}
+	return name
+}
@@ -0,0 +1,101 @@
+package scraper
+
+import (
+	"github.com/gotd/td/tg"
+	"github.com/momaek/tgchannel/internal/format"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// convertEntities 将 Telegram 消息实体转换为实体模型
+func convertEntities(text string, entities []tg.MessageEntityClass) []*models.MessageEntity {
+	result := make([]*models.MessageEntity, 0, len(entities))
+	for _, e := range entities {
+		entity := &models.MessageEntity{
+			Offset: e.GetOffset(),
+			Length: e.GetLength(),
+		}
+
+		switch v := e.(type) {
+		case *tg.MessageEntityBold:
+			entity.Type = models.EntityBold
+		case *tg.MessageEntityItalic:
+			entity.Type = models.EntityItalic
+		case *tg.MessageEntityUnderline:
+			entity.Type = models.EntityUnderline
+		case *tg.MessageEntityStrike:
+			entity.Type = models.EntityStrike
+		case *tg.MessageEntitySpoiler:
+			entity.Type = models.EntitySpoiler
+		case *tg.MessageEntityCode:
+			entity.Type = models.EntityCode
+		case *tg.MessageEntityPre:
+			entity.Type = models.EntityPre
+			entity.Language = v.Language
+		case *tg.MessageEntityBlockquote:
+			entity.Type = models.EntityBlockquote
+		case *tg.MessageEntityURL:
+			entity.Type = models.EntityURL
+		case *tg.MessageEntityTextURL:
+			entity.Type = models.EntityTextURL
+			entity.URL = v.URL
+		case *tg.MessageEntityEmail:
+			entity.Type = models.EntityEmail
+		case *tg.MessageEntityPhone:
+			entity.Type = models.EntityPhone
+		case *tg.MessageEntityMention:
+			entity.Type = models.EntityMention
+		case *tg.MessageEntityMentionName:
+			entity.Type = models.EntityMentionName
+			entity.UserID = v.UserID
+		case *tg.InputMessageEntityMentionName:
+			entity.Type = models.EntityMentionName
+			if user, ok := v.UserID.(*tg.InputUser); ok {
+				entity.UserID = user.UserID
+			}
+		case *tg.MessageEntityHashtag:
+			entity.Type = models.EntityHashtag
+		case *tg.MessageEntityCashtag:
+			entity.Type = models.EntityCashtag
+		case *tg.MessageEntityBotCommand:
+			entity.Type = models.EntityBotCommand
+		case *tg.MessageEntityBankCard:
+			entity.Type = models.EntityBankCard
+		case *tg.MessageEntityCustomEmoji:
+			entity.Type = models.EntityCustomEmoji
+			entity.CustomEmojiID = v.DocumentID
+		default:
+			entity.Type = models.EntityUnknown
+		}
+
+		entity.Text = format.Slice(text, entity.Offset, entity.Length)
+		result = append(result, entity)
+	}
+	return result
+}
+
+// convertReactions 将消息的回应统计转换为回应模型
+func convertReactions(reactions tg.MessageReactions) []*models.Reaction {
+	result := make([]*models.Reaction, 0, len(reactions.Results))
+	for _, r := range reactions.Results {
+		reaction := &models.Reaction{Count: r.Count}
+		switch v := r.Reaction.(type) {
+		case *tg.ReactionEmoji:
+			reaction.Emoji = v.Emoticon
+		case *tg.ReactionCustomEmoji:
+			reaction.CustomEmojiID = v.DocumentID
+		default:
+			continue
+		}
+		result = append(result, reaction)
+	}
+	return result
+}
+
+// reactionTotal 回应总数
+func reactionTotal(reactions []*models.Reaction) int32 {
+	var total int32
+	for _, reaction := range reactions {
+		total += int32(reaction.Count)
+	}
+	return total
+}
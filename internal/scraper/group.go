@@ -0,0 +1,164 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// participantsPageSize channels.getParticipants 每次请求的成员数量，服务器允许的最大值
+const participantsPageSize = 200
+
+// channelKind 根据频道标志判断类型
+func channelKind(channel *tg.Channel) string {
+	switch {
+	case channel.Gigagroup:
+		return models.ChannelGigagroup
+	case channel.Megagroup:
+		return models.ChannelMegagroup
+	case channel.Broadcast:
+		return models.ChannelBroadcast
+	}
+	return ""
+}
+
+// memberEvents 将群组的服务消息转换为成员变动，不是成员变动的服务消息返回空列表
+func memberEvents(message *tg.MessageService, channelID int64) []*models.MemberEvent {
+	var fromID int64
+	if from, ok := message.FromID.(*tg.PeerUser); ok {
+		fromID = from.UserID
+	}
+
+	event := func(userID, actorID int64, action string) *models.MemberEvent {
+		return &models.MemberEvent{
+			ChannelID: channelID,
+			MessageID: int64(message.ID),
+			UserID:    userID,
+			ActorID:   actorID,
+			Action:    action,
+			Date:      time.Unix(int64(message.Date), 0),
+		}
+	}
+
+	switch action := message.Action.(type) {
+	case *tg.MessageActionChatAddUser:
+		// 自己加入公开群组时，被添加的用户就是消息的发送者
+		events := make([]*models.MemberEvent, 0, len(action.Users))
+		for _, userID := range action.Users {
+			if userID == fromID {
+				events = append(events, event(userID, 0, models.MemberJoined))
+			} else {
+				events = append(events, event(userID, fromID, models.MemberAdded))
+			}
+		}
+		return events
+	case *tg.MessageActionChatJoinedByLink:
+		return []*models.MemberEvent{event(fromID, action.InviterID, models.MemberJoined)}
+	case *tg.MessageActionChatJoinedByRequest:
+		return []*models.MemberEvent{event(fromID, 0, models.MemberJoined)}
+	case *tg.MessageActionChatDeleteUser:
+		if action.UserID == fromID {
+			return []*models.MemberEvent{event(action.UserID, 0, models.MemberLeft)}
+		}
+		return []*models.MemberEvent{event(action.UserID, fromID, models.MemberRemoved)}
+	}
+	return nil
+}
+
+// saveServiceMessage 保存群组服务消息中的成员变动
+//
+// 其他服务消息（置顶、改名等）直接忽略。
+func (s *Scraper) saveServiceMessage(message *tg.MessageService, channelID int64) error {
+	for _, event := range memberEvents(message, channelID) {
+		if err := s.db.SaveMemberEvent(event); err != nil {
+			return fmt.Errorf("保存成员变动失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// SnapshotParticipants 通过 channels.getParticipants 记录群组当前的成员列表
+//
+// 广播频道需要管理员权限才能获取成员，这里只支持群组。
+// 服务器只返回最近的一部分成员，成员总数以服务器返回的为准。
+func (s *Scraper) SnapshotParticipants(ctx context.Context, channel *models.Channel) (*models.ParticipantSnapshot, error) {
+	if !channel.IsGroup() {
+		return nil, fmt.Errorf("%s 不是群组，只有群组可以获取成员列表", channel.Title)
+	}
+
+	snapshot := &models.ParticipantSnapshot{ChannelID: channel.ID}
+	offset := 0
+	for {
+		result, err := s.client.ChannelsGetParticipants(ctx, &tg.ChannelsGetParticipantsRequest{
+			Channel: inputChannel(channel),
+			Filter:  &tg.ChannelParticipantsRecent{},
+			Offset:  offset,
+			Limit:   participantsPageSize,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("获取群组成员失败 (offset: %d): %w", offset, err)
+		}
+		page, ok := result.(*tg.ChannelsChannelParticipants)
+		if !ok {
+			return nil, fmt.Errorf("无效的成员响应类型: %T", result)
+		}
+		s.peers.remember(page.Chats)
+		s.senders.remember(page.Users, page.Chats)
+
+		snapshot.Total = page.Count
+		for _, p := range page.Participants {
+			if participant := convertParticipant(p); participant != nil {
+				snapshot.Participants = append(snapshot.Participants, participant)
+			}
+		}
+		offset += len(page.Participants)
+		if len(page.Participants) < participantsPageSize || offset >= page.Count {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(s.delay):
+		}
+	}
+
+	if err := s.db.CreateParticipantSnapshot(snapshot); err != nil {
+		return nil, fmt.Errorf("保存成员快照失败: %w", err)
+	}
+	log.Printf("群组 %s 成员快照已保存: 获取到 %d 人，共 %d 人", channel.Title, len(snapshot.Participants), snapshot.Total)
+	return snapshot, nil
+}
+
+// convertParticipant 转换群组成员，已退出的成员和不是用户的成员返回 nil
+func convertParticipant(p tg.ChannelParticipantClass) *models.Participant {
+	joinedAt := func(date int) *time.Time {
+		if date == 0 {
+			return nil
+		}
+		t := time.Unix(int64(date), 0)
+		return &t
+	}
+
+	switch p := p.(type) {
+	case *tg.ChannelParticipant:
+		return &models.Participant{UserID: p.UserID, Role: models.RoleMember, JoinedAt: joinedAt(p.Date)}
+	case *tg.ChannelParticipantSelf:
+		return &models.Participant{UserID: p.UserID, Role: models.RoleMember, InviterID: p.InviterID,
+			JoinedAt: joinedAt(p.Date)}
+	case *tg.ChannelParticipantCreator:
+		return &models.Participant{UserID: p.UserID, Role: models.RoleCreator, Rank: p.Rank}
+	case *tg.ChannelParticipantAdmin:
+		return &models.Participant{UserID: p.UserID, Role: models.RoleAdmin, Rank: p.Rank,
+			InviterID: p.InviterID, JoinedAt: joinedAt(p.Date)}
+	case *tg.ChannelParticipantBanned:
+		if user, ok := p.Peer.(*tg.PeerUser); ok {
+			return &models.Participant{UserID: user.UserID, Role: models.RoleBanned, JoinedAt: joinedAt(p.Date)}
+		}
+	}
+	return nil
+}
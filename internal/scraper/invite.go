@@ -0,0 +1,157 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// inviteHosts 邀请链接可能使用的域名
+var inviteHosts = []string{"t.me/", "telegram.me/", "telegram.dog/"}
+
+// InviteHash 从邀请链接中提取 hash，不是邀请链接时返回 false
+//
+// 支持 t.me/+HASH、t.me/joinchat/HASH（可带 https:// 前缀，也可以是 telegram.me 域名）
+// 和 tg://join?invite=HASH 三种格式。
+func InviteHash(link string) (string, bool) {
+	link = strings.TrimSpace(link)
+	if hash, ok := strings.CutPrefix(link, "tg://join?invite="); ok {
+		return trimInviteHash(hash)
+	}
+
+	link = strings.TrimPrefix(strings.TrimPrefix(link, "https://"), "http://")
+	for _, host := range inviteHosts {
+		if len(link) < len(host) || !strings.EqualFold(link[:len(host)], host) {
+			continue
+		}
+		path := link[len(host):]
+		if hash, ok := strings.CutPrefix(path, "+"); ok {
+			return trimInviteHash(hash)
+		}
+		if hash, ok := strings.CutPrefix(path, "joinchat/"); ok {
+			return trimInviteHash(hash)
+		}
+	}
+	return "", false
+}
+
+// trimInviteHash 去掉 hash 后面的路径和查询参数
+func trimInviteHash(hash string) (string, bool) {
+	if i := strings.IndexAny(hash, "/?&#"); i >= 0 {
+		hash = hash[:i]
+	}
+	return hash, hash != ""
+}
+
+// FetchChannelInfoByInvite 通过邀请链接获取私有频道的信息
+//
+// 先用 messages.checkChatInvite 检查邀请：已加入的频道直接使用响应中的 access hash；
+// 尚未加入（包括可以临时预览）时，join 为 true 才会通过 messages.importChatInvite 加入频道，否则返回错误。
+// 预览的 access hash 只在预览期内有效，也收不到频道的推送更新，因此不会被保存。
+// 获取到的频道和 access hash 会保存到数据库，之后可以像公开频道一样通过 ID 抓取。
+func (s *Scraper) FetchChannelInfoByInvite(ctx context.Context, link string, join bool) (*models.Channel, error) {
+	hash, ok := InviteHash(link)
+	if !ok {
+		return nil, fmt.Errorf("无效的邀请链接: %s", link)
+	}
+
+	invite, err := s.client.MessagesCheckChatInvite(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("检查邀请链接失败: %w", err)
+	}
+
+	var chat tg.ChatClass
+	switch inv := invite.(type) {
+	case *tg.ChatInviteAlready:
+		chat = inv.Chat
+	case *tg.ChatInvitePeek:
+		// 未加入但可以临时预览，预览的 access hash 过期后失效，需要加入后再抓取
+		title := hash
+		if channel, ok := inv.Chat.(*tg.Channel); ok {
+			title = channel.Title
+		}
+		if !join {
+			return nil, fmt.Errorf("尚未加入频道 %s（当前只能预览），请使用 --join 通过邀请链接加入", title)
+		}
+		if chat, err = s.joinInvite(ctx, hash, title); err != nil {
+			return nil, err
+		}
+	case *tg.ChatInvite:
+		if !inv.Channel {
+			return nil, fmt.Errorf("邀请链接指向的是普通群组，不是频道: %s", inv.Title)
+		}
+		if !join {
+			return nil, fmt.Errorf("尚未加入频道 %s，请使用 --join 通过邀请链接加入", inv.Title)
+		}
+		if chat, err = s.joinInvite(ctx, hash, inv.Title); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("无效的邀请响应类型: %T", invite)
+	}
+
+	channel, ok := chat.(*tg.Channel)
+	if !ok {
+		return nil, fmt.Errorf("邀请链接指向的不是频道: %T", chat)
+	}
+	s.peers.remember([]tg.ChatClass{channel})
+	resolved, ok := s.peers.lookup(channel.ID)
+	if !ok {
+		return nil, fmt.Errorf("邀请响应中缺少频道 %s 的 access hash", channel.Title)
+	}
+	if s.profileStale(resolved) {
+		resolved = s.refreshProfile(ctx, resolved)
+	}
+	if resolved, err = s.activate(resolved); err != nil {
+		return nil, err
+	}
+	// 私有频道没有用户名，记下邀请链接以便之后用同一个链接找到本地的频道
+	if err := s.db.SetChannelInviteHash(resolved.TelegramID, hash); err != nil {
+		log.Printf("保存频道 %s 的邀请链接失败: %v", resolved.Title, err)
+	}
+
+	log.Printf("频道信息获取成功: %s (ID: %d)", resolved.Title, resolved.TelegramID)
+	return resolved, nil
+}
+
+// joinInvite 通过邀请链接加入频道，返回加入后的频道
+func (s *Scraper) joinInvite(ctx context.Context, hash, title string) (tg.ChatClass, error) {
+	updates, err := s.client.MessagesImportChatInvite(ctx, hash)
+	if tgerr.Is(err, "INVITE_REQUEST_SENT") {
+		return nil, fmt.Errorf("频道 %s 需要管理员审核，已提交加入申请，通过后再重新抓取", title)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("加入频道 %s 失败: %w", title, err)
+	}
+	log.Printf("已通过邀请链接加入频道: %s", title)
+
+	var chats []tg.ChatClass
+	switch u := updates.(type) {
+	case *tg.Updates:
+		chats = u.Chats
+	case *tg.UpdatesCombined:
+		chats = u.Chats
+	}
+	for _, chat := range chats {
+		if channel, ok := chat.(*tg.Channel); ok && !channel.Min {
+			return channel, nil
+		}
+	}
+	return nil, fmt.Errorf("加入频道 %s 的响应中没有频道信息", title)
+}
+
+// FetchChannelHistoryByInvite 通过邀请链接获取频道的历史消息
+func (s *Scraper) FetchChannelHistoryByInvite(ctx context.Context, link string, opts FetchOptions) error {
+	channel, err := s.FetchChannelInfoByInvite(ctx, link, opts.Join)
+	if err != nil {
+		return fmt.Errorf("获取频道信息失败: %w", err)
+	}
+
+	log.Printf("开始抓取频道 %s 的历史消息...", channel.Title)
+	return s.fetchHistory(ctx, channel, opts)
+}
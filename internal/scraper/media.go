@@ -0,0 +1,282 @@
+package scraper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/tg"
+	"github.com/momaek/tgchannel/internal/database"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// mediaDownloader 将消息中的图片和文件下载到本地
+//
+// 文件以内容的 SHA-256 命名，按前两级哈希分目录存放，
+// 相同的文件（包括被转发到其他频道的文件）只下载和保存一份。
+type mediaDownloader struct {
+	db         *database.Database
+	client     *tg.Client
+	config     *models.MediaConfig
+	downloader *downloader.Downloader
+
+	mu      sync.Mutex
+	allowed map[int64]bool // 频道 ID -> 是否允许下载
+}
+
+// newMediaDownloader 创建媒体下载器，未启用时返回 nil
+func newMediaDownloader(db *database.Database, client *tg.Client, config *models.MediaConfig) *mediaDownloader {
+	if config == nil || !config.Enabled {
+		return nil
+	}
+	return &mediaDownloader{
+		db:         db,
+		client:     client,
+		config:     config,
+		downloader: downloader.NewDownloader(),
+		allowed:    make(map[int64]bool),
+	}
+}
+
+// directory 媒体文件的根目录
+func (m *mediaDownloader) directory() string {
+	if m.config.Directory == "" {
+		return "media" // 默认值
+	}
+	return m.config.Directory
+}
+
+// channelAllowed 判断频道是否开启了媒体下载
+func (m *mediaDownloader) channelAllowed(channelID int64) bool {
+	if len(m.config.Channels) == 0 {
+		return true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if allowed, ok := m.allowed[channelID]; ok {
+		return allowed
+	}
+
+	allowed := false
+	if channel, err := m.db.GetChannelByID(channelID); err == nil {
+		for _, c := range m.config.Channels {
+			if id, err := strconv.ParseInt(c, 10, 64); err == nil && id == channel.TelegramID {
+				allowed = true
+				break
+			}
+			if channel.Username != "" && normalizeUsername(c) == normalizeUsername(channel.Username) {
+				allowed = true
+				break
+			}
+		}
+	}
+	m.allowed[channelID] = allowed
+	return allowed
+}
+
+// mediaFile 待下载的媒体文件
+type mediaFile struct {
+	location tg.InputFileLocationClass
+	media    *models.Media
+	limit    models.MediaTypeConfig
+}
+
+// save 下载消息中的媒体并写入 media 表
+func (m *mediaDownloader) save(ctx context.Context, message *tg.Message, messageModel *models.Message) error {
+	if message.Media == nil || !m.channelAllowed(messageModel.ChannelID) {
+		return nil
+	}
+
+	file, ok := m.describe(message.Media)
+	if !ok {
+		return nil
+	}
+	if !file.limit.Enabled {
+		return nil
+	}
+	if file.limit.MaxSize > 0 && file.media.Size > file.limit.MaxSize {
+		log.Printf("跳过过大的媒体文件 (消息 %d, %d 字节, 上限 %d 字节)", message.ID, file.media.Size, file.limit.MaxSize)
+		return nil
+	}
+
+	file.media.MessageID = messageModel.ID
+
+	// 同一个 Telegram 文件已经下载过（例如转发到多个频道），直接复用
+	if existing, err := m.db.GetMediaByFileID(file.media.MediaType, file.media.FileID); err == nil {
+		if _, statErr := os.Stat(existing.LocalPath); statErr == nil {
+			file.media.SHA256 = existing.SHA256
+			file.media.LocalPath = existing.LocalPath
+			return m.db.SaveMedia(file.media)
+		}
+	}
+
+	if err := m.download(ctx, file); err != nil {
+		return err
+	}
+	return m.db.SaveMedia(file.media)
+}
+
+// describe 解析媒体的下载位置和元数据
+func (m *mediaDownloader) describe(media tg.MessageMediaClass) (*mediaFile, bool) {
+	switch md := media.(type) {
+	case *tg.MessageMediaPhoto:
+		photo, ok := md.Photo.(*tg.Photo)
+		if !ok {
+			return nil, false
+		}
+		size, ok := largestPhotoSize(photo.Sizes)
+		if !ok {
+			return nil, false
+		}
+		return &mediaFile{
+			location: &tg.InputPhotoFileLocation{
+				ID:            photo.ID,
+				AccessHash:    photo.AccessHash,
+				FileReference: photo.FileReference,
+				ThumbSize:     size.Type,
+			},
+			media: &models.Media{
+				MediaType: "photo",
+				FileID:    photo.ID,
+				MimeType:  "image/jpeg",
+				Size:      int64(size.Size),
+				Width:     size.W,
+				Height:    size.H,
+			},
+			limit: m.config.Photo,
+		}, true
+	case *tg.MessageMediaDocument:
+		document, ok := md.Document.(*tg.Document)
+		if !ok {
+			return nil, false
+		}
+		mediaModel := &models.Media{
+			MediaType: "document",
+			FileID:    document.ID,
+			MimeType:  document.MimeType,
+			Size:      document.Size,
+		}
+		for _, attr := range document.Attributes {
+			switch a := attr.(type) {
+			case *tg.DocumentAttributeFilename:
+				mediaModel.FileName = a.FileName
+			case *tg.DocumentAttributeImageSize:
+				mediaModel.Width, mediaModel.Height = a.W, a.H
+			case *tg.DocumentAttributeVideo:
+				mediaModel.Width, mediaModel.Height = a.W, a.H
+			}
+		}
+		return &mediaFile{
+			location: &tg.InputDocumentFileLocation{
+				ID:            document.ID,
+				AccessHash:    document.AccessHash,
+				FileReference: document.FileReference,
+			},
+			media: mediaModel,
+			limit: m.config.Document,
+		}, true
+	}
+	return nil, false
+}
+
+// download 下载文件到临时文件，计算哈希后移动到内容寻址的位置
+func (m *mediaDownloader) download(ctx context.Context, file *mediaFile) error {
+	dir := m.directory()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("创建媒体目录失败: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "download-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	_, err = m.downloader.Download(m.client, file.location).Stream(ctx, io.MultiWriter(tmp, hash))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("下载媒体文件失败: %w", err)
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	target := filepath.Join(dir, sum[:2], sum[2:4], sum+mediaExtension(file.media))
+	file.media.SHA256 = sum
+	file.media.LocalPath = target
+
+	// 内容相同的文件已存在时直接复用
+	if _, err := os.Stat(target); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("创建媒体目录失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("保存媒体文件失败: %w", err)
+	}
+
+	log.Printf("媒体文件已保存: %s", target)
+	return nil
+}
+
+// photoSize 图片尺寸
+type photoSize struct {
+	Type string
+	W, H int
+	Size int
+}
+
+// largestPhotoSize 选出分辨率最高的图片尺寸
+func largestPhotoSize(sizes []tg.PhotoSizeClass) (photoSize, bool) {
+	var (
+		best  photoSize
+		found bool
+	)
+	for _, s := range sizes {
+		var candidate photoSize
+		switch size := s.(type) {
+		case *tg.PhotoSize:
+			candidate = photoSize{Type: size.Type, W: size.W, H: size.H, Size: size.Size}
+		case *tg.PhotoSizeProgressive:
+			candidate = photoSize{Type: size.Type, W: size.W, H: size.H}
+			if n := len(size.Sizes); n > 0 {
+				candidate.Size = size.Sizes[n-1]
+			}
+		default:
+			// 缩略图和内联的小图不下载
+			continue
+		}
+		if !found || candidate.W*candidate.H > best.W*best.H {
+			best = candidate
+			found = true
+		}
+	}
+	return best, found
+}
+
+// mediaExtension 根据文件名或 MIME 类型推断扩展名
+func mediaExtension(media *models.Media) string {
+	if ext := filepath.Ext(media.FileName); ext != "" {
+		return strings.ToLower(ext)
+	}
+	if media.MediaType == "photo" {
+		return ".jpg"
+	}
+	if exts, err := mime.ExtensionsByType(media.MimeType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
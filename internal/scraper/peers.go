@@ -0,0 +1,306 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/gotd/td/tg"
+	"github.com/momaek/tgchannel/internal/database"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// peerCache 频道 peer 缓存
+//
+// 所有需要 InputPeerChannel / InputChannel 的调用都通过它获取频道，
+// 查找顺序为：内存 -> 数据库 -> Telegram API。
+// 从 API 拿到的 access hash 会写回数据库，后续抓取不再重复解析用户名。
+type peerCache struct {
+	db     *database.Database
+	client *tg.Client
+
+	mu         sync.RWMutex
+	byID       map[int64]*models.Channel // telegram_id -> 频道
+	byUsername map[string]int64          // 小写用户名 -> telegram_id
+	minSeen    map[int64]string          // 只见过 min 信息的频道 telegram_id -> 标题
+}
+
+// newPeerCache 创建 peer 缓存
+func newPeerCache(db *database.Database, client *tg.Client) *peerCache {
+	return &peerCache{
+		db:         db,
+		client:     client,
+		byID:       make(map[int64]*models.Channel),
+		byUsername: make(map[string]int64),
+		minSeen:    make(map[int64]string),
+	}
+}
+
+// normalizeUsername 去掉 @ 前缀并转为小写
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(username), "@"))
+}
+
+// lookup 从内存中查找频道
+func (p *peerCache) lookup(telegramID int64) (*models.Channel, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	channel, ok := p.byID[telegramID]
+	return channel, ok
+}
+
+// lookupUsername 从内存中按用户名查找频道
+func (p *peerCache) lookupUsername(username string) (*models.Channel, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	id, ok := p.byUsername[normalizeUsername(username)]
+	if !ok {
+		return nil, false
+	}
+	channel, ok := p.byID[id]
+	return channel, ok
+}
+
+// store 将频道写入内存缓存
+func (p *peerCache) store(channel *models.Channel) {
+	if channel.AccessHash == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if old, ok := p.byID[channel.TelegramID]; ok && old.Username != "" {
+		delete(p.byUsername, normalizeUsername(old.Username))
+	}
+	p.byID[channel.TelegramID] = channel
+	if channel.Username != "" {
+		p.byUsername[normalizeUsername(channel.Username)] = channel.TelegramID
+	}
+}
+
+// resolveUsername 通过用户名获取频道，必要时调用 ContactsResolveUsername
+func (p *peerCache) resolveUsername(ctx context.Context, username string) (*models.Channel, error) {
+	username = normalizeUsername(username)
+	if username == "" {
+		return nil, fmt.Errorf("频道用户名为空")
+	}
+
+	if channel, ok := p.lookupUsername(username); ok {
+		return channel, nil
+	}
+
+	if channel, err := p.db.GetChannelByUsername(username); err == nil && channel.AccessHash != 0 {
+		p.store(channel)
+		return channel, nil
+	}
+
+	resolved, err := p.client.ContactsResolveUsername(ctx, username)
+	if err != nil {
+		return nil, fmt.Errorf("解析频道失败: %w", err)
+	}
+
+	peerChannel, ok := resolved.Peer.(*tg.PeerChannel)
+	if !ok {
+		return nil, fmt.Errorf("不是有效的频道")
+	}
+
+	p.remember(resolved.Chats)
+
+	if channel, ok := p.lookup(peerChannel.ChannelID); ok {
+		return channel, nil
+	}
+	return nil, fmt.Errorf("解析结果中缺少频道 %s 的 access hash", username)
+}
+
+// resolveID 通过 Telegram ID 获取频道
+//
+// 本地没有 access hash 时，会先尝试用已保存的用户名解析，
+// 再从对话列表中查找，ID 对应的频道必须已加入或曾经解析过。
+func (p *peerCache) resolveID(ctx context.Context, telegramID int64) (*models.Channel, error) {
+	if channel, ok := p.lookup(telegramID); ok {
+		return channel, nil
+	}
+
+	stored, err := p.db.GetChannelByTelegramID(telegramID)
+	if err == nil {
+		if stored.AccessHash != 0 {
+			p.store(stored)
+			return stored, nil
+		}
+		if stored.Username != "" {
+			if channel, err := p.resolveUsername(ctx, stored.Username); err == nil && channel.TelegramID == telegramID {
+				return channel, nil
+			}
+		}
+	}
+
+	if err := p.loadDialogs(ctx); err != nil {
+		return nil, err
+	}
+
+	if channel, ok := p.lookup(telegramID); ok {
+		return channel, nil
+	}
+	return nil, fmt.Errorf("未找到频道 %d 的 access hash，请先通过用户名抓取或确认账号已加入该频道", telegramID)
+}
+
+// loadDialogs 遍历对话列表，缓存其中所有频道的 access hash
+func (p *peerCache) loadDialogs(ctx context.Context) error {
+	var (
+		offsetDate int
+		offsetID   int
+		offsetPeer tg.InputPeerClass = &tg.InputPeerEmpty{}
+	)
+
+	for {
+		dialogs, err := p.client.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
+			OffsetDate: offsetDate,
+			OffsetID:   offsetID,
+			OffsetPeer: offsetPeer,
+			Limit:      100,
+		})
+		if err != nil {
+			return fmt.Errorf("获取对话列表失败: %w", err)
+		}
+
+		modified, ok := dialogs.AsModified()
+		if !ok {
+			return nil
+		}
+		p.remember(modified.GetChats())
+
+		if _, ok := dialogs.(*tg.MessagesDialogsSlice); !ok || len(modified.GetDialogs()) < 100 {
+			return nil
+		}
+
+		// 以最后一个对话作为下一页的偏移
+		dialogList := modified.GetDialogs()
+		last, ok := dialogList[len(dialogList)-1].(*tg.Dialog)
+		if !ok {
+			return nil
+		}
+		nextPeer, ok := p.dialogInputPeer(last.Peer, modified.GetUsers())
+		if !ok {
+			return nil
+		}
+		offsetDate = 0
+		for _, msg := range modified.GetMessages() {
+			if m, ok := msg.(*tg.Message); ok && m.ID == last.TopMessage {
+				offsetDate = m.Date
+				break
+			}
+		}
+		offsetID = last.TopMessage
+		offsetPeer = nextPeer
+	}
+}
+
+// dialogInputPeer 将对话的 Peer 转换为分页用的 InputPeer
+func (p *peerCache) dialogInputPeer(peer tg.PeerClass, users []tg.UserClass) (tg.InputPeerClass, bool) {
+	switch pr := peer.(type) {
+	case *tg.PeerChannel:
+		channel, ok := p.lookup(pr.ChannelID)
+		if !ok {
+			return nil, false
+		}
+		return inputPeer(channel), true
+	case *tg.PeerChat:
+		return &tg.InputPeerChat{ChatID: pr.ChatID}, true
+	case *tg.PeerUser:
+		for _, u := range users {
+			if user, ok := u.(*tg.User); ok && user.ID == pr.UserID {
+				return &tg.InputPeerUser{UserID: user.ID, AccessHash: user.AccessHash}, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// remember 缓存 API 响应中携带的频道，并写回数据库
+//
+// min 构造的频道不携带可用的 access hash，只记录名称。
+// 响应中顺带出现的频道以非活跃状态保存，用户明确获取的频道由 activate 标记为活跃。
+func (p *peerCache) remember(chats []tg.ChatClass) {
+	for _, chat := range chats {
+		channel, ok := chat.(*tg.Channel)
+		if !ok {
+			continue
+		}
+		if channel.Min || channel.AccessHash == 0 {
+			p.rememberMin(channel)
+			continue
+		}
+
+		if cached, ok := p.lookup(channel.ID); ok &&
+			cached.AccessHash == channel.AccessHash &&
+			cached.Username == channel.Username &&
+			cached.Title == channel.Title &&
+			cached.Kind == channelKind(channel) {
+			continue
+		}
+
+		channelModel := &models.Channel{
+			TelegramID:  channel.ID,
+			AccessHash:  channel.AccessHash,
+			Username:    channel.Username,
+			Title:       channel.Title,
+			MemberCount: int32(channel.ParticipantsCount),
+			Kind:        channelKind(channel),
+		}
+		if err := p.db.SaveChannel(channelModel); err != nil {
+			log.Printf("保存频道 %d 的 access hash 失败: %v", channel.ID, err)
+			continue
+		}
+		p.store(channelModel)
+	}
+}
+
+// rememberMin 保存只有 min 信息的频道（如转发来源）的标题和用户名
+//
+// min 频道的 access hash 不能用于请求，只记录名称，已保存的 access hash 不受影响。
+// 这些频道无法直接抓取，以非活跃状态保存。
+func (p *peerCache) rememberMin(channel *tg.Channel) {
+	if _, ok := p.lookup(channel.ID); ok {
+		return
+	}
+	p.mu.Lock()
+	if p.minSeen[channel.ID] == channel.Title {
+		p.mu.Unlock()
+		return
+	}
+	p.minSeen[channel.ID] = channel.Title
+	p.mu.Unlock()
+
+	// 已有完整信息的频道以完整信息为准
+	if stored, err := p.db.GetChannelByTelegramID(channel.ID); err == nil && stored.AccessHash != 0 {
+		return
+	}
+
+	channelModel := &models.Channel{
+		TelegramID: channel.ID,
+		Username:   channel.Username,
+		Title:      channel.Title,
+		Kind:       channelKind(channel),
+	}
+	if err := p.db.SaveChannel(channelModel); err != nil {
+		log.Printf("保存频道 %d 的信息失败: %v", channel.ID, err)
+	}
+}
+
+// inputPeer 根据频道构造 InputPeerChannel
+func inputPeer(channel *models.Channel) *tg.InputPeerChannel {
+	return &tg.InputPeerChannel{
+		ChannelID:  channel.TelegramID,
+		AccessHash: channel.AccessHash,
+	}
+}
+
+// inputChannel 根据频道构造 InputChannel
+func inputChannel(channel *models.Channel) *tg.InputChannel {
+	return &tg.InputChannel{
+		ChannelID:  channel.TelegramID,
+		AccessHash: channel.AccessHash,
+	}
+}
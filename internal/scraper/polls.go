@@ -0,0 +1,119 @@
+package scraper
+
+import (
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// buildPoll 将消息中的投票转换为投票模型
+func buildPoll(media *tg.MessageMediaPoll) *models.Poll {
+	poll := &models.Poll{TelegramID: media.Poll.ID}
+	applyPoll(poll, media.Poll)
+	applyPollResults(poll, media.Results)
+	return poll
+}
+
+// applyPoll 更新投票的题目、选项和状态
+func applyPoll(poll *models.Poll, p tg.Poll) {
+	poll.Question = p.Question
+	poll.Quiz = p.Quiz
+	poll.MultipleChoice = p.MultipleChoice
+	poll.PublicVoters = p.PublicVoters
+	poll.Closed = p.Closed
+	poll.CloseDate = nil
+	if closeDate, ok := p.GetCloseDate(); ok {
+		t := time.Unix(int64(closeDate), 0)
+		poll.CloseDate = &t
+	}
+
+	// 保留已有选项的票数，投票更新中的题目和结果可能分开到达
+	existing := make(map[string]*models.PollAnswer, len(poll.Answers))
+	for _, answer := range poll.Answers {
+		existing[answer.Option] = answer
+	}
+	answers := make([]*models.PollAnswer, 0, len(p.Answers))
+	for i, a := range p.Answers {
+		option := hex.EncodeToString(a.Option)
+		answer, ok := existing[option]
+		if !ok {
+			answer = &models.PollAnswer{Option: option}
+		}
+		answer.Position = i
+		answer.Text = a.Text
+		answers = append(answers, answer)
+	}
+	poll.Answers = answers
+}
+
+// applyPollResults 更新投票的票数
+//
+// min 结果不包含当前账号的作答信息，此时不改动已记录的正确答案。
+func applyPollResults(poll *models.Poll, results tg.PollResults) {
+	if totalVoters, ok := results.GetTotalVoters(); ok {
+		poll.TotalVoters = totalVoters
+	}
+	if solution, ok := results.GetSolution(); ok {
+		poll.Solution = solution
+	}
+
+	voters, ok := results.GetResults()
+	if !ok {
+		return
+	}
+	byOption := make(map[string]*models.PollAnswer, len(poll.Answers))
+	for _, answer := range poll.Answers {
+		byOption[answer.Option] = answer
+	}
+	for _, v := range voters {
+		answer, ok := byOption[hex.EncodeToString(v.Option)]
+		if !ok {
+			continue
+		}
+		answer.Voters = v.Voters
+		if !results.Min && v.Correct {
+			answer.Correct = true
+		}
+	}
+}
+
+// savePoll 保存消息中的投票，失败时只记录日志
+func (s *Scraper) savePoll(msg tg.MessageClass, messageModel *models.Message) {
+	message, ok := msg.(*tg.Message)
+	if !ok {
+		return
+	}
+	media, ok := message.Media.(*tg.MessageMediaPoll)
+	if !ok {
+		return
+	}
+	poll := buildPoll(media)
+	poll.MessageID = messageModel.ID
+	if err := s.db.SavePoll(poll); err != nil {
+		log.Printf("保存消息 %d 的投票失败: %v", message.ID, err)
+	}
+}
+
+// handlePollUpdate 记录推送的投票结果变化
+//
+// 投票更新只携带投票 ID，同一个投票可能出现在多条已保存的消息中（例如被转发），
+// 这些记录会一起更新。投票关闭时更新中会附带完整的投票。
+func (s *Scraper) handlePollUpdate(u *tg.UpdateMessagePoll) {
+	polls, err := s.db.GetPollsByTelegramID(u.PollID)
+	if err != nil {
+		log.Printf("获取投票 %d 失败: %v", u.PollID, err)
+		return
+	}
+	for _, poll := range polls {
+		if p, ok := u.GetPoll(); ok {
+			applyPoll(poll, p)
+		}
+		applyPollResults(poll, u.Results)
+		if err := s.db.SavePoll(poll); err != nil {
+			log.Printf("更新投票 %d 失败: %v", u.PollID, err)
+		}
+	}
+}
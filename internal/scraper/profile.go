@@ -0,0 +1,92 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// profileRefreshInterval 完整频道信息的刷新间隔
+func (s *Scraper) profileRefreshInterval() time.Duration {
+	if s.config.ProfileRefreshInterval <= 0 {
+		return 24 * time.Hour // 默认值
+	}
+	return time.Duration(s.config.ProfileRefreshInterval) * time.Second
+}
+
+// profileStale 频道的完整信息是否从未获取或已超过刷新间隔
+func (s *Scraper) profileStale(channel *models.Channel) bool {
+	return channel.ProfileUpdatedAt == nil || time.Since(*channel.ProfileUpdatedAt) >= s.profileRefreshInterval()
+}
+
+// FetchChannelProfile 通过 channels.getFullChannel 获取频道的完整信息并保存
+//
+// 完整信息包括简介、成员数、关联的讨论组、置顶消息、慢速模式和创建时间，
+// 返回更新后的频道副本，传入的频道不会被修改。
+func (s *Scraper) FetchChannelProfile(ctx context.Context, channel *models.Channel) (*models.Channel, error) {
+	profile, _, err := s.fetchFullChannel(ctx, channel)
+	return profile, err
+}
+
+// fetchFullChannel 获取并保存频道的完整信息，同时返回当前在线人数
+func (s *Scraper) fetchFullChannel(ctx context.Context, channel *models.Channel) (*models.Channel, int32, error) {
+	full, err := s.client.ChannelsGetFullChannel(ctx, inputChannel(channel))
+	if err != nil {
+		return nil, 0, fmt.Errorf("获取频道完整信息失败: %w", err)
+	}
+	// 响应中同时包含频道本身和关联的讨论组
+	s.peers.remember(full.Chats)
+
+	channelFull, ok := full.FullChat.(*tg.ChannelFull)
+	if !ok {
+		return nil, 0, fmt.Errorf("无效的频道完整信息类型: %T", full.FullChat)
+	}
+
+	profile := *channel
+	profile.Description = channelFull.About
+	profile.LinkedChatID = 0
+	profile.PinnedMessageID = 0
+	profile.SlowModeSeconds = 0
+	if count, ok := channelFull.GetParticipantsCount(); ok {
+		profile.MemberCount = int32(count)
+	}
+	if linkedChatID, ok := channelFull.GetLinkedChatID(); ok {
+		profile.LinkedChatID = linkedChatID
+	}
+	if pinnedMsgID, ok := channelFull.GetPinnedMsgID(); ok {
+		profile.PinnedMessageID = int64(pinnedMsgID)
+	}
+	if slowmode, ok := channelFull.GetSlowmodeSeconds(); ok {
+		profile.SlowModeSeconds = slowmode
+	}
+	for _, chat := range full.Chats {
+		if c, ok := chat.(*tg.Channel); ok && c.ID == channel.TelegramID {
+			created := time.Unix(int64(c.Date), 0)
+			profile.TelegramCreatedAt = &created
+			break
+		}
+	}
+
+	if err := s.db.UpdateChannelProfile(&profile); err != nil {
+		return nil, 0, err
+	}
+	s.peers.store(&profile)
+
+	online, _ := channelFull.GetOnlineCount()
+	return &profile, int32(online), nil
+}
+
+// refreshProfile 重新获取频道的完整信息，失败时只记录日志并返回原频道
+func (s *Scraper) refreshProfile(ctx context.Context, channel *models.Channel) *models.Channel {
+	profile, err := s.FetchChannelProfile(ctx, channel)
+	if err != nil {
+		log.Printf("刷新频道 %s 的完整信息失败: %v", channel.Title, err)
+		return channel
+	}
+	log.Printf("频道 %s 的完整信息已更新 (成员: %d)", profile.Title, profile.MemberCount)
+	return profile
+}
@@ -0,0 +1,79 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// rateLimiter 所有请求共享的全局请求预算
+//
+// 并发抓取多个频道时，各个 worker 的请求按固定间隔依次放行，
+// 任意请求触发 FLOOD_WAIT 后所有 worker 一起暂停，避免继续消耗限额。
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time // 下一个请求最早可以发出的时间
+}
+
+// newRateLimiter 创建每分钟最多放行 perMinute 个请求的限流器
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		perMinute = 30 // 默认值，与单频道抓取时 2 秒一次的请求频率相同
+	}
+	return &rateLimiter{interval: time.Minute / time.Duration(perMinute)}
+}
+
+// wait 预约下一个请求时间并等待到该时间
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(slot)
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// pause 在 d 时间内不再放行新的请求
+func (l *rateLimiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.next) {
+		l.next = until
+	}
+}
+
+// rateLimitInvoker 在请求发出前经过全局限流器
+type rateLimitInvoker struct {
+	next    tg.Invoker
+	limiter *rateLimiter
+}
+
+// Invoke 实现 tg.Invoker
+//
+// 文件分片下载（upload.getFile）有单独的限额，不占用全局预算。
+func (r *rateLimitInvoker) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	if _, ok := input.(*tg.UploadGetFileRequest); !ok {
+		if err := r.limiter.wait(ctx); err != nil {
+			return err
+		}
+	}
+	return r.next.Invoke(ctx, input, output)
+}
@@ -0,0 +1,148 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// waitRecorder 记录每次重试前的等待
+type waitRecorder func(wait *models.RequestWait)
+
+// retryInvoker 为所有 Telegram 请求提供重试
+//
+// 遇到 FLOOD_WAIT_X 时按服务器要求的时间等待后重试，
+// 遇到临时性错误时按指数退避重试，最多重试 maxRetries 次。
+type retryInvoker struct {
+	next       tg.Invoker
+	maxRetries int
+	record     waitRecorder
+}
+
+// newRetryInvoker 创建带重试的 Invoker
+func newRetryInvoker(next tg.Invoker, maxRetries int, record waitRecorder) *retryInvoker {
+	if maxRetries <= 0 {
+		maxRetries = 3 // 默认值
+	}
+	return &retryInvoker{
+		next:       next,
+		maxRetries: maxRetries,
+		record:     record,
+	}
+}
+
+// Invoke 实现 tg.Invoker
+func (r *retryInvoker) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	method := requestName(input)
+
+	for attempt := 1; ; attempt++ {
+		err := r.next.Invoke(ctx, input, output)
+		if err == nil {
+			return nil
+		}
+		if attempt > r.maxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		var (
+			wait   time.Duration
+			reason string
+		)
+		if d, ok := tgerr.AsFloodWait(err); ok {
+			// 多等一秒，避免刚好卡在限流边界
+			wait = d + time.Second
+			reason = models.WaitReasonFloodWait
+			log.Printf("%s 触发 FLOOD_WAIT，等待 %v 后重试 (%d/%d)", method, wait, attempt, r.maxRetries)
+		} else if isTransient(err) {
+			wait = backoff(attempt)
+			reason = models.WaitReasonTransient
+			log.Printf("%s 请求失败: %v，等待 %v 后重试 (%d/%d)", method, err, wait, attempt, r.maxRetries)
+		} else {
+			return err
+		}
+
+		if r.record != nil {
+			r.record(&models.RequestWait{
+				Method:      method,
+				Reason:      reason,
+				Error:       err.Error(),
+				WaitSeconds: int(wait / time.Second),
+				Attempt:     attempt,
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// requestName 返回请求的 TL 类型名，用于日志和统计
+func requestName(input bin.Encoder) string {
+	if named, ok := input.(interface{ TypeName() string }); ok {
+		return named.TypeName()
+	}
+	return fmt.Sprintf("%T", input)
+}
+
+// isTransient 判断错误是否为可重试的临时性错误
+func isTransient(err error) bool {
+	if rpcErr, ok := tgerr.As(err); ok {
+		return rpcErr.Code >= 500 || rpcErr.Code == -503 ||
+			rpcErr.IsOneOf("TIMEOUT", "RPC_CALL_FAIL", "RPC_MCGET_FAIL", "MSG_WAIT_FAILED")
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// backoff 计算第 attempt 次重试前的退避时间，最长 1 分钟
+func backoff(attempt int) time.Duration {
+	wait := time.Second << (attempt - 1)
+	if wait > time.Minute {
+		wait = time.Minute
+	}
+	return wait
+}
+
+// waitStats 本次运行中的等待统计
+type waitStats struct {
+	mu         sync.Mutex
+	floodWaits int
+	retries    int
+	total      time.Duration
+}
+
+// add 累加一次等待
+func (w *waitStats) add(wait *models.RequestWait) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if wait.Reason == models.WaitReasonFloodWait {
+		w.floodWaits++
+	} else {
+		w.retries++
+	}
+	w.total += time.Duration(wait.WaitSeconds) * time.Second
+}
+
+// snapshot 返回统计结果
+func (w *waitStats) snapshot() (floodWaits, retries int, total time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.floodWaits, w.retries, w.total
+}
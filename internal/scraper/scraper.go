@@ -2,9 +2,12 @@ package scraper
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gotd/td/tg"
@@ -13,130 +16,242 @@ import (
 )
 
 type Scraper struct {
-	db     *database.Database
-	client *tg.Client
-	config *models.ScraperConfig
+	db      *database.Database
+	client  *tg.Client
+	config  *models.ScraperConfig
+	peers   *peerCache
+	senders *senderCache
+	waits   *waitStats
+	limit   *rateLimiter
+	delay   time.Duration    // 分页请求之间的间隔
+	media   *mediaDownloader // 未启用媒体下载时为 nil
+
+	liveMu sync.RWMutex
+	live   map[int64]*liveChannel // telegram_id -> 实时监听中的频道
 }
 
 // NewScraper 创建新的爬虫实例
-func NewScraper(db *database.Database, client *tg.Client, config *models.ScraperConfig) *Scraper {
-	return &Scraper{
+//
+// invoker 通常是已连接的 *telegram.Client，测试中可以替换为 tgfake.Backend。
+// 爬虫发出的所有请求都会经过重试层，按 max_retries 处理 FLOOD_WAIT 和临时性错误；
+// 每次尝试都会经过全局限流器，并发抓取时所有 worker 共享 requests_per_minute 的请求预算。
+func NewScraper(db *database.Database, invoker tg.Invoker, config *models.ScraperConfig) *Scraper {
+	s := &Scraper{
 		db:     db,
-		client: client,
 		config: config,
+		waits:  &waitStats{},
+		limit:  newRateLimiter(config.RequestsPerMinute),
+		delay:  requestDelay(config),
+		live:   make(map[int64]*liveChannel),
+	}
+	limited := &rateLimitInvoker{next: invoker, limiter: s.limit}
+	s.client = tg.NewClient(newRetryInvoker(limited, config.MaxRetries, s.recordWait))
+	s.peers = newPeerCache(db, s.client)
+	s.senders = newSenderCache(db)
+	s.media = newMediaDownloader(db, s.client, &config.Media)
+	return s
+}
+
+// recordWait 记录重试前的等待，便于根据 FLOOD_WAIT 的频率调整 delay_between_requests
+func (s *Scraper) recordWait(wait *models.RequestWait) {
+	s.waits.add(wait)
+	if wait.Reason == models.WaitReasonFloodWait {
+		// 限额是按账号计算的，其他 worker 也需要一起等待
+		s.limit.pause(time.Duration(wait.WaitSeconds) * time.Second)
+	}
+	if err := s.db.CreateRequestWait(wait); err != nil {
+		log.Printf("记录请求等待失败: %v", err)
 	}
 }
 
-// FetchChannelInfo 获取频道信息
-func (s *Scraper) FetchChannelInfo(ctx context.Context, username string) (*models.Channel, error) {
-	// 移除 @ 符号
-	username = strings.TrimPrefix(username, "@")
+// logWaitSummary 输出本次运行的等待统计
+func (s *Scraper) logWaitSummary() {
+	floodWaits, retries, total := s.waits.snapshot()
+	if floodWaits == 0 && retries == 0 {
+		return
+	}
+	log.Printf("请求等待统计: FLOOD_WAIT %d 次，临时错误重试 %d 次，累计等待 %v；频繁触发 FLOOD_WAIT 时可适当增大 delay_between_requests",
+		floodWaits, retries, total)
+}
 
-	// 解析频道
-	peer, err := s.client.ContactsResolveUsername(ctx, username)
-	if err != nil {
-		return nil, fmt.Errorf("解析频道失败: %w", err)
+// pageSize 每次请求的消息数量
+func (s *Scraper) pageSize() int {
+	if s.config.BatchSize <= 0 {
+		return 100 // 默认值
 	}
+	return s.config.BatchSize
+}
 
-	// 检查是否是频道
-	channel, ok := peer.Chats[0].(*tg.Channel)
-	if !ok {
-		return nil, fmt.Errorf("不是有效的频道")
+// requestDelay 分页请求之间的间隔
+func requestDelay(config *models.ScraperConfig) time.Duration {
+	if config.DelayBetweenRequests <= 0 {
+		return 2 * time.Second // 默认值
 	}
+	return time.Duration(config.DelayBetweenRequests) * time.Second
+}
 
-	// 创建频道模型
-	channelModel := &models.Channel{
-		TelegramID:  channel.ID,
-		Username:    username,
-		Title:       channel.Title,
-		Description: "", // 暂时留空
-		MemberCount: int32(channel.ParticipantsCount),
-		IsActive:    true,
+// FetchChannelInfo 获取频道信息
+//
+// 完整信息（简介、关联讨论组等）超过 profile_refresh_interval 未更新时会一并刷新。
+func (s *Scraper) FetchChannelInfo(ctx context.Context, username string) (*models.Channel, error) {
+	// 通过 peer 缓存解析频道，解析结果（含 access hash）会保存到数据库
+	channel, err := s.peers.resolveUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if s.profileStale(channel) {
+		channel = s.refreshProfile(ctx, channel)
+	}
+	if channel, err = s.activate(channel); err != nil {
+		return nil, err
 	}
 
-	// 保存到数据库
-	if err := s.db.CreateChannel(channelModel); err != nil {
-		return nil, fmt.Errorf("保存频道失败: %w", err)
+	log.Printf("频道信息获取成功: %s (%s)", channel.Title, channel.Username)
+	return channel, nil
+}
+
+// activate 将用户明确获取的频道标记为活跃
+//
+// 其他响应中顺带保存的频道是非活跃的，返回标记后的副本，不修改缓存中共享的频道。
+func (s *Scraper) activate(channel *models.Channel) (*models.Channel, error) {
+	if channel.IsActive {
+		return channel, nil
+	}
+	if err := s.db.ActivateChannel(channel.TelegramID); err != nil {
+		return nil, fmt.Errorf("激活频道失败: %w", err)
 	}
+	activated := *channel
+	activated.IsActive = true
+	return &activated, nil
+}
 
-	log.Printf("频道信息获取成功: %s (%s)", channelModel.Title, channelModel.Username)
-	return channelModel, nil
+// FetchOptions 历史消息抓取选项
+type FetchOptions struct {
+	// Limit 最多抓取的消息数量，0 表示不限制
+	Limit int
+	// Full 为 true 时忽略已保存的消息，从最新消息开始完整遍历并刷新已有记录；
+	// 默认只抓取比本地最新消息更新的消息
+	Full bool
+	// Since 只抓取该时间及之后发布的消息，零值表示不限制
+	Since time.Time
+	// Until 只抓取该时间之前发布的消息，零值表示不限制
+	Until time.Time
+	// Comments 为 true 时同时抓取帖子在讨论组中的评论，配置中开启 comments 时总是抓取
+	Comments bool
+	// Join 为 true 时通过邀请链接指定的频道尚未加入时自动加入
+	Join bool
+	// Participants 为 true 时抓取完成后记录群组的成员快照，广播频道会跳过
+	Participants bool
+}
+
+// hasWindow 是否指定了时间范围
+func (o FetchOptions) hasWindow() bool {
+	return !o.Since.IsZero() || !o.Until.IsZero()
+}
+
+// incremental 是否只抓取本地最新消息之后的消息
+//
+// 指定时间范围时通常是回填旧消息，不能以本地最新消息作为下界。
+func (o FetchOptions) incremental() bool {
+	return !o.Full && !o.hasWindow()
 }
 
 // FetchChannelHistory 抓取频道历史消息
-func (s *Scraper) FetchChannelHistory(ctx context.Context, channelUsername string, limit int) error {
-	// 获取或创建频道
-	channel, err := s.db.GetChannelByUsername(channelUsername)
+func (s *Scraper) FetchChannelHistory(ctx context.Context, channelUsername string, opts FetchOptions) error {
+	channel, err := s.FetchChannelInfo(ctx, channelUsername)
 	if err != nil {
-		// 如果频道不存在，先获取频道信息
-		channel, err = s.FetchChannelInfo(ctx, channelUsername)
-		if err != nil {
-			return fmt.Errorf("获取频道信息失败: %w", err)
-		}
+		return fmt.Errorf("获取频道信息失败: %w", err)
 	}
 
-	// 移除 @ 符号
-	username := strings.TrimPrefix(channelUsername, "@")
+	log.Printf("开始抓取频道 %s 的历史消息...", channelUsername)
+	return s.fetchHistory(ctx, channel, opts)
+}
 
-	// 解析频道
-	peer, err := s.client.ContactsResolveUsername(ctx, username)
-	if err != nil {
-		return fmt.Errorf("解析频道失败: %w", err)
+// fetchHistory 分页抓取频道历史消息
+func (s *Scraper) fetchHistory(ctx context.Context, channel *models.Channel, opts FetchOptions) error {
+	peer := inputPeer(channel)
+	limit := opts.Limit
+
+	// 增量模式下只抓取本地最新消息之后的消息
+	minID := 0
+	if opts.incremental() {
+		lastID, err := s.db.GetLastMessageID(channel.ID)
+		if err != nil {
+			return err
+		}
+		minID = int(lastID)
 	}
 
-	// 转换为 InputPeer
-	peerChannel := peer.Peer.(*tg.PeerChannel)
-	inputPeer := &tg.InputPeerChannel{
-		ChannelID:  peerChannel.ChannelID,
-		AccessHash: 0, // 暂时设为0，需要从其他地方获取
+	// 已有本地消息的增量抓取从本地最新消息开始向更新的方向翻页，每页从旧到新保存；
+	// 受 limit 限制或中途出错停止时，下次运行会从已保存的最新消息继续，不会留下缺口
+	forward := minID > 0
+
+	// 完整遍历或回填时会遇到已保存的消息，使用覆盖写入避免唯一约束冲突
+	save := s.processMessage
+	if !opts.incremental() {
+		save = s.refreshMessage
 	}
 
 	// 分页参数
-	pageSize := s.config.BatchSize
-	if pageSize <= 0 {
-		pageSize = 100 // 默认值
-	}
-	requestDelay := time.Duration(s.config.DelayBetweenRequests) * time.Second
-	if requestDelay <= 0 {
-		requestDelay = 2 * time.Second // 默认值
-	}
+	pageSize := s.pageSize()
+	requestDelay := s.delay
 	totalFetched := 0
 	offsetID := 0
 
-	log.Printf("开始分页抓取频道 %s 的历史消息，目标 %d 条，批次大小 %d，请求间隔 %v...", channelUsername, limit, pageSize, requestDelay)
+	// 指定结束时间时，第一页直接跳到该时间之前的消息
+	offsetDate := 0
+	if !opts.Until.IsZero() {
+		offsetDate = int(opts.Until.Unix())
+	}
 
-	for totalFetched < limit {
-		remaining := limit - totalFetched
+	target := "全部"
+	if limit > 0 {
+		target = fmt.Sprintf("%d 条", limit)
+	}
+	switch {
+	case minID > 0:
+		log.Printf("增量抓取频道 %s 中 ID 大于 %d 的消息，目标 %s，批次大小 %d，请求间隔 %v...", channel.Title, minID, target, pageSize, requestDelay)
+	case opts.hasWindow():
+		log.Printf("抓取频道 %s 在 %s 的消息，目标 %s，批次大小 %d，请求间隔 %v...", channel.Title, describeWindow(opts.Since, opts.Until), target, pageSize, requestDelay)
+	default:
+		log.Printf("分页抓取频道 %s 的历史消息，目标 %s，批次大小 %d，请求间隔 %v...", channel.Title, target, pageSize, requestDelay)
+	}
+
+	for limit <= 0 || totalFetched < limit {
 		currentLimit := pageSize
-		if remaining < pageSize {
-			currentLimit = remaining
+		if limit > 0 && limit-totalFetched < pageSize {
+			currentLimit = limit - totalFetched
 		}
 
 		// 获取历史消息
-		history, err := s.client.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
-			Peer:       inputPeer,
+		request := &tg.MessagesGetHistoryRequest{
+			Peer:       peer,
 			OffsetID:   offsetID,
-			OffsetDate: 0,
+			OffsetDate: offsetDate,
 			AddOffset:  0,
 			Limit:      currentLimit,
 			MaxID:      0,
-			MinID:      0,
+			MinID:      minID,
 			Hash:       0,
-		})
+		}
+		if forward {
+			// 取紧接在 min_id 之后的 currentLimit 条消息
+			request.OffsetID = minID + 1
+			request.AddOffset = -currentLimit
+		}
+		history, err := s.client.MessagesGetHistory(ctx, request)
 		if err != nil {
 			return fmt.Errorf("获取历史消息失败 (offset: %d): %w", offsetID, err)
 		}
 
 		// 兼容处理不同的消息响应类型
-		var msgs []tg.MessageClass
-		switch m := history.(type) {
-		case *tg.MessagesMessages:
-			msgs = m.Messages
-		case *tg.MessagesChannelMessages:
-			msgs = m.Messages
-		default:
+		modified, ok := history.AsModified()
+		if !ok {
 			return fmt.Errorf("无效的消息响应类型: %T", history)
 		}
+		s.peers.remember(modified.GetChats())
+		s.senders.remember(modified.GetUsers(), modified.GetChats())
+		msgs := modified.GetMessages()
 
 		if len(msgs) == 0 {
 			log.Printf("没有更多消息了，已抓取 %d 条", totalFetched)
@@ -145,23 +260,56 @@ func (s *Scraper) FetchChannelHistory(ctx context.Context, channelUsername strin
 
 		log.Printf("获取到 %d 条消息 (offset: %d)...", len(msgs), offsetID)
 
+		if forward {
+			// 响应按从新到旧排列，先保存较旧的消息
+			msgs = reversed(msgs)
+		}
+
+		reachedSince := false
 		for _, msg := range msgs {
-			if err := s.processMessage(ctx, msg, channel.ID); err != nil {
+			if message, ok := msg.(*tg.Message); ok {
+				date := time.Unix(int64(message.Date), 0)
+				if !opts.Since.IsZero() && date.Before(opts.Since) {
+					// 消息按时间倒序返回，之后的消息都早于开始时间
+					reachedSince = true
+					break
+				}
+				if !opts.Until.IsZero() && !date.Before(opts.Until) {
+					continue
+				}
+			}
+			if err := save(ctx, msg, channel.ID); err != nil {
 				log.Printf("处理消息失败: %v", err)
 				continue
 			}
 			totalFetched++
-		}
 
-		if len(msgs) > 0 {
-			if lastMsg, ok := msgs[len(msgs)-1].(*tg.Message); ok {
-				offsetID = lastMsg.ID
+			if message, ok := msg.(*tg.Message); ok && (opts.Comments || s.config.Comments) {
+				if err := s.fetchComments(ctx, channel, message); err != nil {
+					log.Printf("抓取消息 %d 的评论失败: %v", message.ID, err)
+				}
 			}
 		}
 
-		log.Printf("已抓取 %d/%d 条消息", totalFetched, limit)
+		// 之后的分页以消息 ID 为准
+		if forward {
+			minID = msgs[len(msgs)-1].GetID()
+		} else {
+			offsetID = msgs[len(msgs)-1].GetID()
+		}
+		offsetDate = 0
 
-		if totalFetched >= limit {
+		if limit > 0 {
+			log.Printf("已抓取 %d/%d 条消息", totalFetched, limit)
+		} else {
+			log.Printf("已抓取 %d 条消息", totalFetched)
+		}
+
+		if reachedSince {
+			log.Printf("已到达开始时间 %s，已抓取 %d 条", opts.Since.Format("2006-01-02 15:04:05"), totalFetched)
+			break
+		}
+		if limit > 0 && totalFetched >= limit {
 			break
 		}
 		if len(msgs) < currentLimit {
@@ -178,34 +326,225 @@ func (s *Scraper) FetchChannelHistory(ctx context.Context, channelUsername strin
 	}
 
 	log.Printf("历史消息抓取完成，共处理 %d 条消息", totalFetched)
+	if opts.Participants {
+		if !channel.IsGroup() {
+			log.Printf("%s 不是群组，跳过成员快照", channel.Title)
+		} else if _, err := s.SnapshotParticipants(ctx, channel); err != nil {
+			log.Printf("记录群组 %s 的成员快照失败: %v", channel.Title, err)
+		}
+	}
+	s.logWaitSummary()
 	return nil
 }
 
+// reversed 返回顺序相反的消息列表
+func reversed(msgs []tg.MessageClass) []tg.MessageClass {
+	result := make([]tg.MessageClass, len(msgs))
+	for i, msg := range msgs {
+		result[len(msgs)-1-i] = msg
+	}
+	return result
+}
+
+// describeWindow 格式化时间范围用于日志输出
+func describeWindow(since, until time.Time) string {
+	const layout = "2006-01-02 15:04:05"
+	from, to := "最早", "现在"
+	if !since.IsZero() {
+		from = since.Format(layout)
+	}
+	if !until.IsZero() {
+		to = until.Format(layout)
+	}
+	return from + " ~ " + to
+}
+
 // processMessage 处理单条消息
 func (s *Scraper) processMessage(ctx context.Context, msg tg.MessageClass, channelID int64) error {
+	if service, ok := msg.(*tg.MessageService); ok {
+		return s.saveServiceMessage(service, channelID)
+	}
+	messageModel, err := s.buildMessage(ctx, msg, channelID)
+	if err != nil {
+		return err
+	}
+
+	// 保存到数据库
+	if err := s.db.CreateMessage(messageModel); err != nil {
+		return fmt.Errorf("保存消息失败: %w", err)
+	}
+
+	s.saveEntities(messageModel)
+	s.saveReactions(msg, messageModel)
+	s.savePoll(msg, messageModel)
+	s.saveMedia(ctx, msg, messageModel)
+	return nil
+}
+
+// refreshMessage 处理被编辑或重新抓取的消息，覆盖数据库中已有的内容
+//
+// 内容与数据库中不同时，旧内容和新内容都会记录到 message_versions。
+func (s *Scraper) refreshMessage(ctx context.Context, msg tg.MessageClass, channelID int64) error {
+	if service, ok := msg.(*tg.MessageService); ok {
+		return s.saveServiceMessage(service, channelID)
+	}
+	messageModel, err := s.buildMessage(ctx, msg, channelID)
+	if err != nil {
+		return err
+	}
+
+	// 覆盖之前取出旧内容，用于判断是否被编辑；消息尚未保存时为 nil
+	previous, err := s.storedMessage(channelID, messageModel.TelegramID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.UpsertMessage(messageModel); err != nil {
+		return fmt.Errorf("更新消息失败: %w", err)
+	}
+
+	if previous != nil && contentChanged(previous, messageModel) {
+		s.saveVersions(previous, messageModel)
+	}
+	s.saveEntities(messageModel)
+	s.saveReactions(msg, messageModel)
+	s.savePoll(msg, messageModel)
+	s.saveMedia(ctx, msg, messageModel)
+	return nil
+}
+
+// storedMessage 获取已保存的消息，消息尚未保存时返回 nil
+//
+// 其他错误（如数据库繁忙）需要返回，不能当作消息不存在，否则编辑前的版本会被直接覆盖。
+func (s *Scraper) storedMessage(channelID, telegramID int64) (*models.Message, error) {
+	message, err := s.db.GetMessageByTelegramID(channelID, telegramID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取已保存的消息失败: %w", err)
+	}
+	return message, nil
+}
+
+// saveVersions 记录消息编辑前后的版本，失败时只记录日志
+//
+// 第一次检测到编辑时先补记旧内容作为初始版本。
+func (s *Scraper) saveVersions(previous, current *models.Message) {
+	previousDate := previous.Date
+	if previous.EditDate != nil {
+		previousDate = *previous.EditDate
+	}
+	if _, err := s.db.SaveMessageVersion(previous, previousDate); err != nil {
+		log.Printf("记录消息 %d 的历史版本失败: %v", previous.TelegramID, err)
+		return
+	}
+
+	currentDate := time.Now()
+	if current.EditDate != nil {
+		currentDate = *current.EditDate
+	}
+	saved, err := s.db.SaveMessageVersion(current, currentDate)
+	if err != nil {
+		log.Printf("记录消息 %d 的历史版本失败: %v", current.TelegramID, err)
+		return
+	}
+	if saved {
+		log.Printf("消息 %d 的内容已被编辑，已记录新版本", current.TelegramID)
+	}
+}
+
+// contentChanged 判断消息的文本或媒体是否发生变化
+func contentChanged(previous, current *models.Message) bool {
+	return previous.Text != current.Text ||
+		previous.MediaType != current.MediaType ||
+		previous.MediaURL != current.MediaURL
+}
+
+// saveEntities 保存消息的格式实体，失败时只记录日志
+func (s *Scraper) saveEntities(messageModel *models.Message) {
+	if err := s.db.ReplaceMessageEntities(messageModel.ID, messageModel.Entities); err != nil {
+		log.Printf("保存消息 %d 的格式实体失败: %v", messageModel.TelegramID, err)
+	}
+}
+
+// saveReactions 记录消息的回应快照，失败时只记录日志
+func (s *Scraper) saveReactions(msg tg.MessageClass, messageModel *models.Message) {
+	message, ok := msg.(*tg.Message)
+	if !ok {
+		return
+	}
+	var reactions []*models.Reaction
+	if r, ok := message.GetReactions(); ok {
+		reactions = convertReactions(r)
+	}
+	if _, err := s.db.SaveReactionSnapshot(messageModel.ID, reactions); err != nil {
+		log.Printf("记录消息 %d 的回应失败: %v", message.ID, err)
+	}
+}
+
+// saveMedia 按配置下载消息中的媒体文件，失败时只记录日志
+func (s *Scraper) saveMedia(ctx context.Context, msg tg.MessageClass, messageModel *models.Message) {
+	if s.media == nil {
+		return
+	}
 	message, ok := msg.(*tg.Message)
 	if !ok {
-		return fmt.Errorf("无效的消息类型")
+		return
+	}
+	if err := s.media.save(ctx, message, messageModel); err != nil {
+		log.Printf("下载消息 %d 的媒体文件失败: %v", message.ID, err)
+	}
+}
+
+// buildMessage 将 Telegram 消息转换为消息模型
+func (s *Scraper) buildMessage(ctx context.Context, msg tg.MessageClass, channelID int64) (*models.Message, error) {
+	message, ok := msg.(*tg.Message)
+	if !ok {
+		return nil, fmt.Errorf("无效的消息类型")
 	}
 
 	// 创建消息模型
 	messageModel := &models.Message{
 		TelegramID: int64(message.ID),
 		ChannelID:  channelID,
-		SenderID:   0,
-		SenderName: "",
+		PostAuthor: message.PostAuthor,
 		Text:       message.Message,
 		Views:      int32(message.Views),
 		Forwards:   int32(message.Forwards),
-		Replies:    0,
 		Date:       time.Unix(int64(message.Date), 0),
+		Entities:   convertEntities(message.Message, message.Entities),
+	}
+	if editDate, ok := message.GetEditDate(); ok {
+		t := time.Unix(int64(editDate), 0)
+		messageModel.EditDate = &t
+	}
+
+	// 相册中的每条消息 grouped_id 相同
+	if groupedID, ok := message.GetGroupedID(); ok {
+		messageModel.GroupedID = groupedID
+	}
+
+	if fwd, ok := message.GetFwdFrom(); ok {
+		messageModel.Forward = buildForwardHeader(fwd)
+	}
+
+	// 回复关系，回复其他会话中的消息时不记录
+	if header, ok := message.ReplyTo.(*tg.MessageReplyHeader); ok && header.ReplyToPeerID == nil {
+		messageModel.ReplyToID = int64(header.ReplyToMsgID)
+		messageModel.ThreadID = int64(header.ReplyToTopID)
+	}
+
+	if replies, ok := message.GetReplies(); ok {
+		messageModel.Replies = int32(replies.Replies)
+	}
+	if reactions, ok := message.GetReactions(); ok {
+		messageModel.Reactions = reactionTotal(convertReactions(reactions))
 	}
 
-	// 处理发送者信息
+	// 处理发送者信息，频道自身发布的帖子没有 from_id
 	if message.FromID != nil {
-		if peerUser, ok := message.FromID.(*tg.PeerUser); ok {
-			messageModel.SenderID = peerUser.UserID
-		}
+		messageModel.SenderType, messageModel.SenderID, messageModel.SenderName = s.senders.resolve(message.FromID)
 	}
 
 	// 处理媒体文件
@@ -215,12 +554,28 @@ func (s *Scraper) processMessage(ctx context.Context, msg tg.MessageClass, chann
 		}
 	}
 
-	// 保存到数据库
-	if err := s.db.CreateMessage(messageModel); err != nil {
-		return fmt.Errorf("保存消息失败: %w", err)
-	}
+	return messageModel, nil
+}
 
-	return nil
+// buildForwardHeader 转换消息的转发来源
+func buildForwardHeader(fwd tg.MessageFwdHeader) *models.ForwardHeader {
+	header := &models.ForwardHeader{
+		FromType:   models.ForwardFromHidden,
+		FromName:   fwd.FromName,
+		MessageID:  int64(fwd.ChannelPost),
+		Date:       time.Unix(int64(fwd.Date), 0),
+		PostAuthor: fwd.PostAuthor,
+		Imported:   fwd.Imported,
+	}
+	switch from := fwd.FromID.(type) {
+	case *tg.PeerChannel:
+		header.FromType, header.FromID = models.ForwardFromChannel, from.ChannelID
+	case *tg.PeerUser:
+		header.FromType, header.FromID = models.ForwardFromUser, from.UserID
+	case *tg.PeerChat:
+		header.FromType, header.FromID = models.ForwardFromChat, from.ChatID
+	}
+	return header
 }
 
 // processMedia 处理媒体文件
@@ -235,6 +590,8 @@ func (s *Scraper) processMedia(ctx context.Context, media tg.MessageMediaClass,
 		if webpage, ok := m.Webpage.(*tg.WebPage); ok {
 			message.MediaURL = webpage.URL
 		}
+	case *tg.MessageMediaPoll:
+		message.MediaType = "poll"
 	default:
 		message.MediaType = "unknown"
 	}
@@ -242,299 +599,311 @@ func (s *Scraper) processMedia(ctx context.Context, media tg.MessageMediaClass,
 }
 
 // ListenForUpdates 监听频道更新
+//
+// 监听的频道来自 subscriptions 表中所有活跃的订阅，运行期间会定期刷新，
+// 新增订阅的频道自动开始监听，取消订阅的频道停止监听。
+// 新消息主要通过 RegisterUpdateHandlers 注册的推送更新入库，
+// 每个频道的定时轮询只在长时间没有收到推送时作为兜底。
 func (s *Scraper) ListenForUpdates(ctx context.Context) error {
 	log.Println("开始监听频道更新...")
 
-	// 获取所有订阅的频道
-	// 这里需要实现获取用户订阅频道的逻辑
-	// 暂时使用示例数据
-	subscribedChannels := []string{"@example_channel"}
-
-	for _, channelUsername := range subscribedChannels {
-		go s.monitorChannel(ctx, channelUsername)
+	// 调用一次 getState，通知服务器开始向当前会话推送更新
+	if _, err := s.client.UpdatesGetState(ctx); err != nil {
+		return fmt.Errorf("获取更新状态失败: %w", err)
 	}
 
-	// 保持运行
-	<-ctx.Done()
-	return nil
-}
-
-// monitorChannel 监控单个频道
-func (s *Scraper) monitorChannel(ctx context.Context, channelUsername string) {
-	log.Printf("开始监控频道: %s", channelUsername)
-
-	// 获取频道信息
-	channel, err := s.db.GetChannelByUsername(channelUsername)
-	if err != nil {
-		log.Printf("获取频道信息失败: %v", err)
-		return
+	refreshInterval := time.Duration(s.config.SubscriptionRefreshInterval) * time.Second
+	if refreshInterval <= 0 {
+		refreshInterval = time.Minute // 默认值
 	}
 
-	// 获取最新消息ID
-	messages, err := s.db.GetChannelMessages(channel.ID, 1, 0)
-	if err != nil {
-		log.Printf("获取最新消息失败: %v", err)
-		return
-	}
+	// telegram_id -> 停止监控的函数
+	monitors := make(map[int64]context.CancelFunc)
+	defer func() {
+		for _, stop := range monitors {
+			stop()
+		}
+	}()
 
-	var lastMessageID int64
-	if len(messages) > 0 {
-		lastMessageID = messages[0].TelegramID
+	if err := s.syncMonitors(ctx, monitors); err != nil {
+		return fmt.Errorf("加载订阅频道失败: %w", err)
 	}
 
-	// 定期检查新消息
-	ticker := time.NewTicker(30 * time.Second)
+	// 保存的全局搜索独立执行，不阻塞订阅的刷新
+	go s.watchSavedSearches(ctx)
+
+	ticker := time.NewTicker(refreshInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		case <-ticker.C:
-			if err := s.checkNewMessages(ctx, channel, lastMessageID); err != nil {
-				log.Printf("检查新消息失败: %v", err)
+			if err := s.syncMonitors(ctx, monitors); err != nil {
+				log.Printf("刷新订阅频道失败: %v", err)
 			}
 		}
 	}
 }
 
-// checkNewMessages 检查新消息
-func (s *Scraper) checkNewMessages(ctx context.Context, channel *models.Channel, lastMessageID int64) error {
-	// 移除 @ 符号
-	username := strings.TrimPrefix(channel.Username, "@")
-
-	// 解析频道
-	peer, err := s.client.ContactsResolveUsername(ctx, username)
+// syncMonitors 按照当前活跃的订阅启动或停止频道监控
+func (s *Scraper) syncMonitors(ctx context.Context, monitors map[int64]context.CancelFunc) error {
+	channels, err := s.db.GetActiveSubscribedChannels()
 	if err != nil {
-		return fmt.Errorf("解析频道失败: %w", err)
-	}
-
-	// 转换为 InputPeer
-	peerChannel := peer.Peer.(*tg.PeerChannel)
-	inputPeer := &tg.InputPeerChannel{
-		ChannelID:  peerChannel.ChannelID,
-		AccessHash: 0, // 暂时设为0
-	}
-
-	// 获取最新消息
-	history, err := s.client.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
-		Peer:       inputPeer,
-		OffsetID:   0,
-		OffsetDate: 0,
-		AddOffset:  0,
-		Limit:      10,
-		MaxID:      0,
-		MinID:      0,
-		Hash:       0,
-	})
-	if err != nil {
-		return fmt.Errorf("获取最新消息失败: %w", err)
+		return err
 	}
 
-	messages, ok := history.(*tg.MessagesMessages)
-	if !ok {
-		return fmt.Errorf("无效的消息响应")
+	active := make(map[int64]*models.Channel, len(channels))
+	for _, channel := range channels {
+		active[channel.TelegramID] = channel
 	}
 
-	// 处理新消息
-	for _, msg := range messages.Messages {
-		message, ok := msg.(*tg.Message)
-		if !ok {
-			continue
+	changed := false
+	for telegramID, stop := range monitors {
+		if _, ok := active[telegramID]; !ok {
+			stop()
+			delete(monitors, telegramID)
+			changed = true
+			log.Printf("频道 %d 的订阅已取消，停止监控", telegramID)
 		}
+	}
 
-		// 检查是否是新消息
-		if int64(message.ID) > lastMessageID {
-			if err := s.processMessage(ctx, msg, channel.ID); err != nil {
-				log.Printf("处理新消息失败: %v", err)
-				continue
-			}
-			lastMessageID = int64(message.ID)
-			log.Printf("收到新消息: %s", message.Message[:min(len(message.Message), 50)])
+	for telegramID, channel := range active {
+		if _, ok := monitors[telegramID]; ok {
+			continue
 		}
+		monitorCtx, stop := context.WithCancel(ctx)
+		monitors[telegramID] = stop
+		changed = true
+		go s.monitorChannel(monitorCtx, channel)
 	}
 
+	if changed {
+		s.reportWatching(channels)
+	}
 	return nil
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// reportWatching 输出当前监听的频道列表
+func (s *Scraper) reportWatching(channels []*models.Channel) {
+	if len(channels) == 0 {
+		log.Println("当前没有活跃的订阅，请先使用 subscribe 命令订阅频道")
+		return
 	}
-	return b
-}
 
-// FetchChannelHistoryByID 通过 Channel ID 抓取频道历史消息
-func (s *Scraper) FetchChannelHistoryByID(ctx context.Context, channelID int64, limit int) error {
-	// 获取或创建频道
-	channel, err := s.db.GetChannelByTelegramID(channelID)
-	if err != nil {
-		// 如果频道不存在，先获取频道信息
-		channel, err = s.FetchChannelInfoByID(ctx, channelID)
-		if err != nil {
-			return fmt.Errorf("获取频道信息失败: %w", err)
+	names := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		if channel.Username != "" {
+			names = append(names, fmt.Sprintf("%s (@%s)", channel.Title, channel.Username))
+		} else {
+			names = append(names, fmt.Sprintf("%s (ID: %d)", channel.Title, channel.TelegramID))
 		}
 	}
+	log.Printf("正在监听 %d 个频道: %s", len(channels), strings.Join(names, ", "))
+}
 
-	// 先通过 ChannelsGetChannels 获取 AccessHash
-	inputChannel := &tg.InputChannel{
-		ChannelID:  channelID,
-		AccessHash: 0, // 先设为0，实际会被 API 校验
-	}
-	chats, err := s.client.ChannelsGetChannels(ctx, []tg.InputChannelClass{inputChannel})
+// monitorChannel 监控单个频道
+func (s *Scraper) monitorChannel(ctx context.Context, channel *models.Channel) {
+	log.Printf("开始监控频道: %s (ID: %d)", channel.Title, channel.TelegramID)
+
+	// 获取最新消息ID
+	lastMessageID, err := s.db.GetLastMessageID(channel.ID)
 	if err != nil {
-		return fmt.Errorf("获取频道信息失败: %w", err)
+		log.Printf("获取最新消息失败: %v", err)
+		return
 	}
-	chatsResult, ok := chats.(*tg.MessagesChats)
-	if !ok || len(chatsResult.Chats) == 0 {
-		return fmt.Errorf("无效的频道响应")
+
+	// 获取上次保存的 pts
+	state, err := s.db.GetChannelState(channel.ID)
+	if err != nil {
+		log.Printf("获取频道更新状态失败: %v", err)
+		return
 	}
-	channelObj, ok := chatsResult.Chats[0].(*tg.Channel)
-	if !ok {
-		return fmt.Errorf("不是有效的频道")
+
+	// 注册到实时监听列表，推送更新只会处理已注册的频道
+	live := s.watch(channel, lastMessageID, state.Pts)
+	defer s.unwatch(live)
+
+	// 启动时补齐停机期间缺失的更新
+	if err := s.catchUp(ctx, live); err != nil {
+		log.Printf("补齐频道 %s 的更新失败: %v", channel.Title, err)
 	}
 
-	// 用 ID 和 AccessHash 组装 InputPeerChannel
-	inputPeer := &tg.InputPeerChannel{
-		ChannelID:  channelObj.ID,
-		AccessHash: channelObj.AccessHash,
+	// 定期轮询作为推送更新的兜底
+	pollInterval := time.Duration(s.config.PollInterval) * time.Second
+	if pollInterval <= 0 {
+		pollInterval = 5 * time.Minute // 默认值
 	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
 
-	// 分页参数
-	pageSize := s.config.BatchSize
-	if pageSize <= 0 {
-		pageSize = 100 // 默认值
+	// 定期校验已保存的消息是否被删除
+	verifyTicker := time.NewTicker(s.verifyInterval())
+	defer verifyTicker.Stop()
+
+	// 定期刷新频道的完整信息和记录统计快照，启动时已过期的立即处理；
+	// 快照同样会获取完整信息，两者都过期时只需请求一次
+	if s.snapshotDue(channel) {
+		if err := s.takeSnapshot(ctx, channel); err != nil {
+			log.Printf("记录频道 %s 的统计快照失败: %v", channel.Title, err)
+		}
+	} else if s.profileStale(channel) {
+		s.refreshProfile(ctx, channel)
 	}
-	requestDelay := time.Duration(s.config.DelayBetweenRequests) * time.Second
-	if requestDelay <= 0 {
-		requestDelay = 2 * time.Second // 默认值
+	profileTicker := time.NewTicker(s.profileRefreshInterval())
+	defer profileTicker.Stop()
+	snapshotTicker := time.NewTicker(s.snapshotInterval())
+	defer snapshotTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-live.catchUp:
+			if err := s.catchUp(ctx, live); err != nil {
+				log.Printf("补齐频道 %s 的更新失败: %v", channel.Title, err)
+			}
+		case <-profileTicker.C:
+			s.refreshProfile(ctx, channel)
+		case <-snapshotTicker.C:
+			if err := s.takeSnapshot(ctx, channel); err != nil {
+				log.Printf("记录频道 %s 的统计快照失败: %v", channel.Title, err)
+			}
+		case <-verifyTicker.C:
+			if err := s.verifyDeletedMessages(ctx, channel); err != nil {
+				log.Printf("校验频道 %s 的已删除消息失败: %v", channel.Title, err)
+			}
+		case <-ticker.C:
+			if _, lastUpdate := live.snapshot(); time.Since(lastUpdate) < pollInterval {
+				// 推送更新正常，无需轮询
+				continue
+			}
+			if err := s.catchUp(ctx, live); err != nil {
+				log.Printf("检查新消息失败: %v", err)
+			}
+		}
 	}
-	totalFetched := 0
-	offsetID := 0
+}
 
-	log.Printf("开始分页抓取频道 ID %d 的历史消息，目标 %d 条，批次大小 %d，请求间隔 %v...", channelID, limit, pageSize, requestDelay)
+// checkNewMessages 拉取 lastMessageID 之后的所有新消息，返回处理后的最新消息 ID
+func (s *Scraper) checkNewMessages(ctx context.Context, channel *models.Channel, lastMessageID int64) (int64, error) {
+	// 从 peer 缓存获取 access hash
+	resolved, err := s.peers.resolveID(ctx, channel.TelegramID)
+	if err != nil {
+		return lastMessageID, fmt.Errorf("解析频道失败: %w", err)
+	}
 
-	for totalFetched < limit {
-		remaining := limit - totalFetched
-		currentLimit := pageSize
-		if remaining < pageSize {
-			currentLimit = remaining
-		}
+	pageSize := s.pageSize()
+	newestID := lastMessageID
+	offsetID := 0
 
-		// 获取历史消息
+	for {
+		// 获取最新消息，MinID 限定只返回比 lastMessageID 新的消息
 		history, err := s.client.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
-			Peer:       inputPeer,
+			Peer:       inputPeer(resolved),
 			OffsetID:   offsetID,
 			OffsetDate: 0,
 			AddOffset:  0,
-			Limit:      currentLimit,
+			Limit:      pageSize,
 			MaxID:      0,
-			MinID:      0,
+			MinID:      int(lastMessageID),
 			Hash:       0,
 		})
 		if err != nil {
-			return fmt.Errorf("获取历史消息失败 (offset: %d): %w", offsetID, err)
-		}
-
-		// 兼容处理不同的消息响应类型
-		var msgs []tg.MessageClass
-		switch m := history.(type) {
-		case *tg.MessagesMessages:
-			msgs = m.Messages
-		case *tg.MessagesChannelMessages:
-			msgs = m.Messages
-		default:
-			return fmt.Errorf("无效的消息响应类型: %T", history)
+			return newestID, fmt.Errorf("获取最新消息失败: %w", err)
 		}
 
-		if len(msgs) == 0 {
-			log.Printf("没有更多消息了，已抓取 %d 条", totalFetched)
-			break
+		messages, ok := history.AsModified()
+		if !ok {
+			return newestID, fmt.Errorf("无效的消息响应")
 		}
+		s.peers.remember(messages.GetChats())
+		s.senders.remember(messages.GetUsers(), messages.GetChats())
+		msgs := messages.GetMessages()
 
-		log.Printf("获取到 %d 条消息 (offset: %d)...", len(msgs), offsetID)
-
+		// 处理新消息（响应按从新到旧排列，需与调用前的 ID 比较）
 		for _, msg := range msgs {
-			if err := s.processMessage(ctx, msg, channel.ID); err != nil {
-				log.Printf("处理消息失败: %v", err)
+			message, ok := msg.(*tg.Message)
+			if !ok {
 				continue
 			}
-			totalFetched++
-		}
 
-		if len(msgs) > 0 {
-			if lastMsg, ok := msgs[len(msgs)-1].(*tg.Message); ok {
-				offsetID = lastMsg.ID
+			// 检查是否是新消息
+			if int64(message.ID) > lastMessageID {
+				if err := s.processMessage(ctx, msg, channel.ID); err != nil {
+					log.Printf("处理新消息失败: %v", err)
+					continue
+				}
+				if int64(message.ID) > newestID {
+					newestID = int64(message.ID)
+				}
+				log.Printf("收到新消息: %s", logPreview(message.Message))
 			}
 		}
 
-		log.Printf("已抓取 %d/%d 条消息", totalFetched, limit)
-
-		if totalFetched >= limit {
-			break
+		if len(msgs) < pageSize {
+			return newestID, nil
 		}
-		if len(msgs) < currentLimit {
-			log.Printf("没有更多消息了，已抓取 %d 条", totalFetched)
-			break
+		// 按最后一条的 ID 翻页，服务消息或已删除的消息也可以作为翻页位置
+		last := msgs[len(msgs)-1].GetID()
+		if int64(last) <= lastMessageID+1 {
+			return newestID, nil
 		}
-		log.Printf("等待 %v 后继续...", requestDelay)
+		offsetID = last
+
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(requestDelay):
-			continue
+			return newestID, ctx.Err()
+		case <-time.After(s.delay):
 		}
 	}
-
-	log.Printf("历史消息抓取完成，共处理 %d 条消息", totalFetched)
-	return nil
 }
 
-// FetchChannelInfoByID 通过 Channel ID 获取频道信息
-func (s *Scraper) FetchChannelInfoByID(ctx context.Context, channelID int64) (*models.Channel, error) {
-	// 创建 InputChannel
-	inputChannel := &tg.InputChannel{
-		ChannelID:  channelID,
-		AccessHash: 0, // 暂时设为0，需要从其他地方获取
+func min(a, b int) int {
+	if a < b {
+		return a
 	}
+	return b
+}
 
-	// 获取频道信息
-	chats, err := s.client.ChannelsGetChannels(ctx, []tg.InputChannelClass{inputChannel})
-	if err != nil {
-		return nil, fmt.Errorf("获取频道信息失败: %w", err)
-	}
+// logPreviewLength 日志中消息预览的最大字符数
+const logPreviewLength = 50
 
-	// 处理响应
-	chatsResult, ok := chats.(*tg.MessagesChats)
-	if !ok {
-		return nil, fmt.Errorf("无效的频道响应")
+// logPreview 按字符截取消息开头用于日志，避免截断多字节字符
+func logPreview(text string) string {
+	runes := []rune(text)
+	if len(runes) <= logPreviewLength {
+		return text
 	}
+	return string(runes[:logPreviewLength])
+}
 
-	if len(chatsResult.Chats) == 0 {
-		return nil, fmt.Errorf("未找到频道")
+// FetchChannelHistoryByID 通过 Channel ID 抓取频道历史消息
+func (s *Scraper) FetchChannelHistoryByID(ctx context.Context, channelID int64, opts FetchOptions) error {
+	channel, err := s.FetchChannelInfoByID(ctx, channelID)
+	if err != nil {
+		return fmt.Errorf("获取频道信息失败: %w", err)
 	}
 
-	// 检查是否是频道
-	channel, ok := chatsResult.Chats[0].(*tg.Channel)
-	if !ok {
-		return nil, fmt.Errorf("不是有效的频道")
-	}
+	log.Printf("开始抓取频道 ID %d 的历史消息...", channelID)
+	return s.fetchHistory(ctx, channel, opts)
+}
 
-	// 创建频道模型
-	channelModel := &models.Channel{
-		TelegramID:  channel.ID,
-		Username:    channel.Username,
-		Title:       channel.Title,
-		Description: "", // 暂时留空
-		MemberCount: int32(channel.ParticipantsCount),
-		IsActive:    true,
+// FetchChannelInfoByID 通过 Channel ID 获取频道信息
+func (s *Scraper) FetchChannelInfoByID(ctx context.Context, channelID int64) (*models.Channel, error) {
+	// 通过 peer 缓存获取频道，缓存未命中时从对话列表中查找 access hash
+	channel, err := s.peers.resolveID(ctx, channelID)
+	if err != nil {
+		return nil, err
 	}
-
-	// 保存到数据库
-	if err := s.db.CreateChannel(channelModel); err != nil {
-		return nil, fmt.Errorf("保存频道失败: %w", err)
+	if s.profileStale(channel) {
+		channel = s.refreshProfile(ctx, channel)
+	}
+	if channel, err = s.activate(channel); err != nil {
+		return nil, err
 	}
 
-	log.Printf("频道信息获取成功: %s (ID: %d)", channelModel.Title, channelModel.TelegramID)
-	return channelModel, nil
+	log.Printf("频道信息获取成功: %s (ID: %d)", channel.Title, channel.TelegramID)
+	return channel, nil
 }
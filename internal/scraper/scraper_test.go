@@ -0,0 +1,1340 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/momaek/tgchannel/internal/database"
+	"github.com/momaek/tgchannel/internal/models"
+	"github.com/momaek/tgchannel/internal/tgfake"
+)
+
+const (
+	testChannelID  = 1001
+	testAccessHash = 42
+)
+
+// testBase 测试消息的起始时间，第 i 条消息比它晚 i 分钟
+var testBase = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// newTestScraper 创建使用内存后端和临时数据库的爬虫，分页请求之间不等待
+func newTestScraper(t *testing.T) (*Scraper, *tgfake.Backend, *database.Database) {
+	t.Helper()
+	db, err := database.NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	backend := tgfake.New()
+	backend.AddChannel(testChannelID, testAccessHash, "test_channel", "Test Channel")
+
+	s := NewScraper(db, backend, &models.ScraperConfig{
+		BatchSize:         10,
+		MaxRetries:        2,
+		RequestsPerMinute: 1 << 20,
+	})
+	s.delay = 0
+	return s, backend, db
+}
+
+// addMessages 向频道添加 ID 为 from..to 的文本消息
+func addMessages(backend *tgfake.Backend, from, to int) {
+	for id := from; id <= to; id++ {
+		backend.AddMessage(testChannelID, &tg.Message{
+			ID:      id,
+			Message: "message",
+			Date:    int(testBase.Add(time.Duration(id) * time.Minute).Unix()),
+			Views:   id * 10,
+		})
+	}
+}
+
+// storedIDs 返回数据库中该频道所有消息的 Telegram ID，从新到旧排列
+func storedIDs(t *testing.T, db *database.Database) []int64 {
+	t.Helper()
+	channel, err := db.GetChannelByTelegramID(testChannelID)
+	if err != nil {
+		t.Fatalf("GetChannelByTelegramID: %v", err)
+	}
+	messages, err := db.FindMessages(database.MessageFilter{ChannelID: channel.ID, Limit: 1000})
+	if err != nil {
+		t.Fatalf("FindMessages: %v", err)
+	}
+	ids := make([]int64, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.TelegramID)
+	}
+	return ids
+}
+
+// idRange 返回从 from 递减到 to 的 ID 列表
+func idRange(from, to int64) []int64 {
+	var ids []int64
+	for id := from; id >= to; id-- {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFetchChannelHistoryPaginates(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	addMessages(backend, 1, 25)
+
+	if err := s.FetchChannelHistory(context.Background(), "@test_channel", FetchOptions{}); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+
+	if got := storedIDs(t, db); !equalIDs(got, idRange(25, 1)) {
+		t.Fatalf("stored ids = %v, want 25..1", got)
+	}
+
+	// 10 + 10 + 5，最后一页不足一页时停止
+	requests := backend.HistoryRequests()
+	wantOffsets := []int{0, 16, 6}
+	if len(requests) != len(wantOffsets) {
+		t.Fatalf("got %d history requests, want %d", len(requests), len(wantOffsets))
+	}
+	for i, r := range requests {
+		if r.OffsetID != wantOffsets[i] {
+			t.Errorf("request %d offset_id = %d, want %d", i, r.OffsetID, wantOffsets[i])
+		}
+		if r.Limit != 10 {
+			t.Errorf("request %d limit = %d, want 10", i, r.Limit)
+		}
+	}
+}
+
+func TestFetchChannelHistoryLimit(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	addMessages(backend, 1, 25)
+
+	if err := s.FetchChannelHistory(context.Background(), "test_channel", FetchOptions{Limit: 13}); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+
+	if got := storedIDs(t, db); !equalIDs(got, idRange(25, 13)) {
+		t.Fatalf("stored ids = %v, want 25..13", got)
+	}
+	requests := backend.HistoryRequests()
+	if len(requests) != 2 || requests[1].Limit != 3 {
+		t.Fatalf("second page should only ask for the remaining 3 messages, got %d requests", len(requests))
+	}
+}
+
+func TestFetchChannelHistoryIncremental(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	addMessages(backend, 1, 5)
+	ctx := context.Background()
+
+	if err := s.FetchChannelHistory(ctx, "test_channel", FetchOptions{}); err != nil {
+		t.Fatalf("first fetch: %v", err)
+	}
+	addMessages(backend, 6, 8)
+	if err := s.FetchChannelHistory(ctx, "test_channel", FetchOptions{}); err != nil {
+		t.Fatalf("second fetch: %v", err)
+	}
+
+	requests := backend.HistoryRequests()
+	if last := requests[len(requests)-1]; last.MinID != 5 {
+		t.Errorf("incremental fetch min_id = %d, want 5", last.MinID)
+	}
+	if got := storedIDs(t, db); !equalIDs(got, idRange(8, 1)) {
+		t.Fatalf("stored ids = %v, want 8..1", got)
+	}
+}
+
+func TestFetchChannelHistoryIncrementalResumes(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	addMessages(backend, 1, 5)
+	ctx := context.Background()
+
+	if err := s.FetchChannelHistory(ctx, "test_channel", FetchOptions{}); err != nil {
+		t.Fatalf("first fetch: %v", err)
+	}
+	// 新消息比 limit 多，每次运行从已保存的最新消息之后继续，不留缺口
+	addMessages(backend, 6, 30)
+	if err := s.FetchChannelHistory(ctx, "test_channel", FetchOptions{Limit: 12}); err != nil {
+		t.Fatalf("second fetch: %v", err)
+	}
+	if got := storedIDs(t, db); !equalIDs(got, idRange(17, 1)) {
+		t.Fatalf("stored ids = %v, want 17..1", got)
+	}
+	requests := backend.HistoryRequests()
+	if r := requests[len(requests)-2]; r.MinID != 5 || r.OffsetID != 6 || r.AddOffset != -10 {
+		t.Errorf("first incremental page = min_id %d, offset_id %d, add_offset %d, want 5, 6, -10",
+			r.MinID, r.OffsetID, r.AddOffset)
+	}
+	if r := requests[len(requests)-1]; r.MinID != 15 || r.Limit != 2 {
+		t.Errorf("second incremental page = min_id %d, limit %d, want 15, 2", r.MinID, r.Limit)
+	}
+
+	if err := s.FetchChannelHistory(ctx, "test_channel", FetchOptions{Limit: 100}); err != nil {
+		t.Fatalf("third fetch: %v", err)
+	}
+	if got := storedIDs(t, db); !equalIDs(got, idRange(30, 1)) {
+		t.Fatalf("stored ids = %v, want 30..1", got)
+	}
+}
+
+func TestFetchChannelHistoryWindow(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	addMessages(backend, 1, 30)
+
+	opts := FetchOptions{
+		Since: testBase.Add(10 * time.Minute),
+		Until: testBase.Add(20 * time.Minute),
+	}
+	if err := s.FetchChannelHistory(context.Background(), "test_channel", opts); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+
+	// 开始时间包含，结束时间不包含
+	if got := storedIDs(t, db); !equalIDs(got, idRange(19, 10)) {
+		t.Fatalf("stored ids = %v, want 19..10", got)
+	}
+	requests := backend.HistoryRequests()
+	if requests[0].OffsetDate != int(opts.Until.Unix()) {
+		t.Errorf("first request offset_date = %d, want %d", requests[0].OffsetDate, opts.Until.Unix())
+	}
+	// 第二页遇到早于开始时间的消息后停止，不再请求第三页
+	if len(requests) != 2 {
+		t.Errorf("got %d history requests, want 2", len(requests))
+	}
+}
+
+func TestFetchChannelHistoryRetriesFloodWait(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	addMessages(backend, 1, 5)
+	backend.Fail("messages.getHistory", tgfake.FloodWait(0))
+
+	if err := s.FetchChannelHistory(context.Background(), "test_channel", FetchOptions{}); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+
+	if got := storedIDs(t, db); !equalIDs(got, idRange(5, 1)) {
+		t.Fatalf("stored ids = %v, want 5..1", got)
+	}
+	if floodWaits, _, _ := s.waits.snapshot(); floodWaits != 1 {
+		t.Errorf("flood waits = %d, want 1", floodWaits)
+	}
+	if n := len(backend.HistoryRequests()); n != 2 {
+		t.Errorf("got %d history requests, want 2 (flood wait + retry)", n)
+	}
+}
+
+func TestFetchChannelHistoryError(t *testing.T) {
+	s, backend, _ := newTestScraper(t)
+	addMessages(backend, 1, 5)
+	backend.Fail("messages.getHistory", tgerr.New(400, "CHANNEL_PRIVATE"))
+
+	err := s.FetchChannelHistory(context.Background(), "test_channel", FetchOptions{})
+	if !tgerr.Is(err, "CHANNEL_PRIVATE") {
+		t.Fatalf("err = %v, want CHANNEL_PRIVATE", err)
+	}
+	// 非临时性错误不重试
+	if n := len(backend.HistoryRequests()); n != 1 {
+		t.Errorf("got %d history requests, want 1", n)
+	}
+}
+
+func TestFetchChannelHistoryUnknownChannel(t *testing.T) {
+	s, _, _ := newTestScraper(t)
+
+	err := s.FetchChannelHistory(context.Background(), "missing_channel", FetchOptions{})
+	if !tgerr.Is(err, "USERNAME_NOT_OCCUPIED") {
+		t.Fatalf("err = %v, want USERNAME_NOT_OCCUPIED", err)
+	}
+}
+
+func TestFetchChannelHistoryByInvite(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	private := backend.AddChannel(3003, 77, "", "Private Channel")
+	private.Left = true
+	backend.AddInvite("AbC_dEf", 3003)
+	backend.AddMessage(3003, &tg.Message{ID: 1, Message: "secret", Date: int(testBase.Unix())})
+
+	link := "https://t.me/+AbC_dEf"
+	if err := s.FetchChannelHistoryByInvite(ctx, link, FetchOptions{}); err == nil {
+		t.Fatal("expected error for a channel that has not been joined")
+	}
+	if n := len(backend.Requests("messages.importChatInvite")); n != 0 {
+		t.Fatalf("joined without --join: %d import requests", n)
+	}
+
+	if err := s.FetchChannelHistoryByInvite(ctx, link, FetchOptions{Join: true}); err != nil {
+		t.Fatalf("FetchChannelHistoryByInvite: %v", err)
+	}
+	channel, err := db.GetChannelByTelegramID(3003)
+	if err != nil {
+		t.Fatalf("GetChannelByTelegramID: %v", err)
+	}
+	if channel.AccessHash != 77 || channel.Title != "Private Channel" {
+		t.Errorf("stored channel = %+v", channel)
+	}
+	// 之后可以用同一个邀请链接在本地找到频道（unsubscribe 依赖此查找）
+	if byInvite, err := db.GetChannelByInviteHash("AbC_dEf"); err != nil || byInvite.TelegramID != 3003 {
+		t.Errorf("GetChannelByInviteHash = %v, %v", byInvite, err)
+	}
+	if _, err := db.GetMessageByTelegramID(channel.ID, 1); err != nil {
+		t.Errorf("message not stored: %v", err)
+	}
+
+	// 加入后通过 ID 抓取，不再需要邀请链接
+	if err := s.FetchChannelHistoryByID(ctx, 3003, FetchOptions{Full: true}); err != nil {
+		t.Fatalf("FetchChannelHistoryByID: %v", err)
+	}
+	if n := len(backend.Requests("messages.importChatInvite")); n != 1 {
+		t.Errorf("got %d import requests, want 1", n)
+	}
+}
+
+func TestFetchChannelInfoByInvitePeek(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	preview := backend.AddChannel(3003, 77, "", "Preview Channel")
+	preview.Left = true
+	preview.Peek = true
+	backend.AddInvite("PeEk", 3003)
+
+	// 只能预览时需要加入，预览的 access hash 和邀请链接都不保存
+	if _, err := s.FetchChannelInfoByInvite(ctx, "https://t.me/+PeEk", false); err == nil {
+		t.Fatal("expected error for a channel that can only be previewed")
+	}
+	if channel, err := db.GetChannelByTelegramID(3003); err == nil {
+		t.Errorf("stored a previewed channel: %+v", channel)
+	}
+	if _, err := db.GetChannelByInviteHash("PeEk"); err == nil {
+		t.Error("stored the invite hash of a previewed channel")
+	}
+
+	channel, err := s.FetchChannelInfoByInvite(ctx, "https://t.me/+PeEk", true)
+	if err != nil {
+		t.Fatalf("FetchChannelInfoByInvite: %v", err)
+	}
+	if n := len(backend.Requests("messages.importChatInvite")); n != 1 {
+		t.Errorf("got %d import requests, want 1", n)
+	}
+	if channel.AccessHash != 77 || !channel.IsActive {
+		t.Errorf("joined channel = %+v", channel)
+	}
+}
+
+func TestInviteHash(t *testing.T) {
+	tests := []struct {
+		link string
+		hash string
+		ok   bool
+	}{
+		{"https://t.me/+AbC_dEf", "AbC_dEf", true},
+		{"t.me/joinchat/AbC_dEf", "AbC_dEf", true},
+		{"https://telegram.me/joinchat/AbC_dEf/", "AbC_dEf", true},
+		{"tg://join?invite=AbC_dEf", "AbC_dEf", true},
+		{"https://t.me/+", "", false},
+		{"https://t.me/channel_name", "", false},
+		{"@channel_name", "", false},
+	}
+	for _, tt := range tests {
+		hash, ok := InviteHash(tt.link)
+		if hash != tt.hash || ok != tt.ok {
+			t.Errorf("InviteHash(%q) = %q, %v, want %q, %v", tt.link, hash, ok, tt.hash, tt.ok)
+		}
+	}
+}
+
+func TestSearchChannel(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	addMessages(backend, 1, 30)
+	// ID 为 3 的倍数的消息包含关键词，共 12 条
+	for id := 3; id <= 36; id += 3 {
+		backend.AddMessage(testChannelID, &tg.Message{
+			ID:      id,
+			Message: "learning Golang",
+			Date:    int(testBase.Add(time.Duration(id) * time.Minute).Unix()),
+		})
+	}
+
+	// 先抓取一部分消息，搜索命中已保存的消息时按重新抓取处理
+	if err := s.FetchChannelHistory(ctx, "test_channel", FetchOptions{Limit: 5}); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+	channel, err := s.ChannelInfo(ctx, ChannelTarget{Username: "test_channel"}, false)
+	if err != nil {
+		t.Fatalf("ChannelInfo: %v", err)
+	}
+
+	saved, err := s.SearchChannel(ctx, channel, SearchOptions{Query: "golang"})
+	if err != nil {
+		t.Fatalf("SearchChannel: %v", err)
+	}
+	if saved != 12 {
+		t.Errorf("saved = %d, want 12", saved)
+	}
+	// 10 + 2，最后一页不足一页时停止
+	if n := len(backend.Requests("messages.search")); n != 2 {
+		t.Errorf("got %d search requests, want 2", n)
+	}
+
+	hits, err := db.FindMessages(database.MessageFilter{ChannelID: channel.ID, Query: "golang", Limit: 100})
+	if err != nil {
+		t.Fatalf("FindMessages: %v", err)
+	}
+	if len(hits) != 12 || hits[0].TelegramID != 36 || hits[11].TelegramID != 3 {
+		t.Fatalf("got %d hits, want 36..3 every 3", len(hits))
+	}
+	// 抓取的 36、33、30、29、28 加上其余命中的消息
+	if got := storedIDs(t, db); len(got) != 14 {
+		t.Errorf("stored %d messages, want 14", len(got))
+	}
+
+	// 时间范围两端：开始时间包含，结束时间不包含
+	saved, err = s.SearchChannel(ctx, channel, SearchOptions{
+		Query: "golang",
+		Since: testBase.Add(12 * time.Minute),
+		Until: testBase.Add(21 * time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("SearchChannel with window: %v", err)
+	}
+	if saved != 3 {
+		t.Errorf("saved = %d, want 3 (12, 15, 18)", saved)
+	}
+	hits, err = db.FindMessages(database.MessageFilter{Query: "golang", Limit: 100})
+	if err != nil {
+		t.Fatalf("FindMessages: %v", err)
+	}
+	if len(hits) != 12 {
+		t.Errorf("repeated hits should be recorded once, got %d", len(hits))
+	}
+
+	if _, err := s.SearchChannel(ctx, channel, SearchOptions{Query: "golang", Filter: "sticker"}); err == nil {
+		t.Error("expected error for an unsupported filter")
+	}
+}
+
+func TestSearchGlobal(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	date := func(minutes int) int { return int(testBase.Add(time.Duration(minutes) * time.Minute).Unix()) }
+
+	// 未加入、也没有保存过的公开频道
+	news := backend.AddChannel(5005, 55, "news_channel", "News")
+	news.Left = true
+	for id := 1; id <= 8; id++ {
+		backend.AddMessage(5005, &tg.Message{ID: id, Message: "Election results", Date: date(id)})
+	}
+	for id := 1; id <= 5; id++ {
+		backend.AddMessage(testChannelID, &tg.Message{ID: id, Message: "election day", Date: date(id)})
+	}
+	// 群组中的结果不保存
+	group := backend.AddChannel(6006, 66, "", "Group")
+	group.Megagroup = true
+	backend.AddMessage(6006, &tg.Message{ID: 1, Message: "election chat", Date: date(1)})
+	backend.AddMessage(6006, &tg.Message{ID: 2, Message: "off topic", Date: date(2)})
+
+	saved, err := s.SearchGlobal(ctx, SearchOptions{Query: "election"})
+	if err != nil {
+		t.Fatalf("SearchGlobal: %v", err)
+	}
+	if saved != 13 {
+		t.Errorf("saved = %d, want 13", saved)
+	}
+	// 14 条结果：10 + 4，第二页从第一页最后一条继续
+	requests := backend.Requests("messages.searchGlobal")
+	if len(requests) != 2 {
+		t.Fatalf("got %d searchGlobal requests, want 2", len(requests))
+	}
+	second := requests[1].(*tg.MessagesSearchGlobalRequest)
+	if second.OffsetRate == 0 || second.OffsetID == 0 {
+		t.Errorf("second page offset = rate %d, id %d", second.OffsetRate, second.OffsetID)
+	}
+
+	channel, err := db.GetChannelByTelegramID(5005)
+	if err != nil {
+		t.Fatalf("new channel not registered: %v", err)
+	}
+	if channel.AccessHash != 55 || channel.Username != "news_channel" {
+		t.Errorf("registered channel = %+v", channel)
+	}
+	hits, err := db.FindMessages(database.MessageFilter{ChannelID: channel.ID, Query: "election", Limit: 100})
+	if err != nil {
+		t.Fatalf("FindMessages: %v", err)
+	}
+	if len(hits) != 8 {
+		t.Errorf("got %d hits in the new channel, want 8", len(hits))
+	}
+	if groupChannel, err := db.GetChannelByTelegramID(6006); err == nil {
+		if messages, _ := db.FindMessages(database.MessageFilter{ChannelID: groupChannel.ID, Limit: 100}); len(messages) != 0 {
+			t.Errorf("stored %d group messages, want 0", len(messages))
+		}
+	}
+
+	// 保存的搜索首次执行默认只查找 saved_search_interval 之内的帖子
+	search := &models.SavedSearch{Query: "election"}
+	if err := s.SaveSearch(search); err != nil {
+		t.Fatalf("SaveSearch: %v", err)
+	}
+	if search.FirstRunSince == nil || time.Since(*search.FirstRunSince) < 59*time.Minute {
+		t.Fatalf("first run since = %v, want about an hour ago", search.FirstRunSince)
+	}
+	backend.AddMessage(5005, &tg.Message{ID: 9, Message: "election update", Date: int(time.Now().Add(-time.Minute).Unix())})
+	before := len(backend.Requests("messages.searchGlobal"))
+	saved, err = s.RunSavedSearch(ctx, search)
+	if err != nil {
+		t.Fatalf("RunSavedSearch: %v", err)
+	}
+	if saved != 1 {
+		t.Errorf("first run saved = %d, want 1", saved)
+	}
+	first := backend.Requests("messages.searchGlobal")[before].(*tg.MessagesSearchGlobalRequest)
+	if first.MinDate != int(search.FirstRunSince.Unix()) {
+		t.Errorf("first run min_date = %d, want %d", first.MinDate, search.FirstRunSince.Unix())
+	}
+
+	// 第二次执行只查找上次执行之后的帖子
+	backend.AddMessage(5005, &tg.Message{ID: 10, Message: "election recount", Date: int(time.Now().Add(time.Minute).Unix())})
+	searches, err := db.GetSavedSearches()
+	if err != nil || len(searches) != 1 || searches[0].LastRunAt == nil || searches[0].FirstRunSince == nil {
+		t.Fatalf("GetSavedSearches = %v, %v", searches, err)
+	}
+	saved, err = s.RunSavedSearch(ctx, searches[0])
+	if err != nil {
+		t.Fatalf("RunSavedSearch: %v", err)
+	}
+	if saved != 1 {
+		t.Errorf("second run saved = %d, want 1", saved)
+	}
+
+	// 刚执行过的搜索还没有到期
+	before = len(backend.Requests("messages.searchGlobal"))
+	s.runDueSavedSearches(ctx)
+	if after := len(backend.Requests("messages.searchGlobal")); after != before {
+		t.Errorf("ran a saved search that is not due: %d requests", after-before)
+	}
+
+	// 指定的开始时间和数量只限定首次执行，并记录在保存的搜索中
+	bounded := &models.SavedSearch{Query: "results", FirstRunSince: &testBase, FirstRunLimit: 3}
+	if err := s.SaveSearch(bounded); err != nil {
+		t.Fatalf("SaveSearch: %v", err)
+	}
+	if !bounded.FirstRunSince.Equal(testBase) || bounded.FirstRunLimit != 3 {
+		t.Errorf("saved bound = %v, %d", bounded.FirstRunSince, bounded.FirstRunLimit)
+	}
+	if saved, err = s.RunSavedSearch(ctx, bounded); err != nil || saved != 3 {
+		t.Errorf("bounded first run = %d, %v, want 3", saved, err)
+	}
+	// 停用后重新保存的搜索重新按首次执行的范围搜索
+	if err := db.DeactivateSavedSearch(bounded.ID); err != nil {
+		t.Fatalf("DeactivateSavedSearch: %v", err)
+	}
+	bounded = &models.SavedSearch{Query: "results", FirstRunSince: &testBase}
+	if err := s.SaveSearch(bounded); err != nil {
+		t.Fatalf("SaveSearch: %v", err)
+	}
+	if bounded.LastRunAt != nil || bounded.FirstRunLimit != 0 {
+		t.Errorf("reactivated search = last run %v, limit %d", bounded.LastRunAt, bounded.FirstRunLimit)
+	}
+}
+
+func TestFetchMegagroup(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	group := backend.AddChannel(4004, 88, "test_group", "Test Group")
+	group.Megagroup = true
+	group.Participants = []tg.ChannelParticipantClass{
+		&tg.ChannelParticipantCreator{UserID: 1},
+		&tg.ChannelParticipantAdmin{UserID: 2, Date: int(testBase.Unix()), Rank: "mod"},
+		&tg.ChannelParticipant{UserID: 3, Date: int(testBase.Unix())},
+	}
+	backend.SetUser(1, "Ann", "", "")
+	backend.SetUser(2, "Bob", "", "")
+	backend.SetUser(3, "Cat", "", "")
+
+	date := int(testBase.Unix())
+	backend.AddMessage(4004, &tg.Message{ID: 1, Message: "question", Date: date, FromID: &tg.PeerUser{UserID: 1}})
+	backend.AddMessage(4004, &tg.Message{ID: 2, Message: "answer", Date: date, FromID: &tg.PeerUser{UserID: 2},
+		ReplyTo: &tg.MessageReplyHeader{ReplyToMsgID: 1}})
+	backend.AddServiceMessage(4004, &tg.MessageService{ID: 3, Date: date, FromID: &tg.PeerUser{UserID: 1},
+		Action: &tg.MessageActionChatAddUser{Users: []int64{3}}})
+	backend.AddServiceMessage(4004, &tg.MessageService{ID: 4, Date: date, FromID: &tg.PeerUser{UserID: 2},
+		Action: &tg.MessageActionChatDeleteUser{UserID: 2}})
+	backend.AddServiceMessage(4004, &tg.MessageService{ID: 5, Date: date, FromID: &tg.PeerUser{UserID: 1},
+		Action: &tg.MessageActionPinMessage{}})
+
+	if err := s.FetchChannelHistory(ctx, "test_group", FetchOptions{Participants: true}); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+
+	channel, err := db.GetChannelByTelegramID(4004)
+	if err != nil {
+		t.Fatalf("GetChannelByTelegramID: %v", err)
+	}
+	if channel.Kind != models.ChannelMegagroup || !channel.IsGroup() {
+		t.Errorf("kind = %q, want megagroup", channel.Kind)
+	}
+
+	answer, err := db.GetMessageByTelegramID(channel.ID, 2)
+	if err != nil {
+		t.Fatalf("GetMessageByTelegramID: %v", err)
+	}
+	if answer.ReplyToID != 1 || answer.SenderName != "Bob" {
+		t.Errorf("answer reply_to = %d, sender = %q", answer.ReplyToID, answer.SenderName)
+	}
+	chain, err := db.GetReplyChain(channel.ID, 2, 3)
+	if err != nil {
+		t.Fatalf("GetReplyChain: %v", err)
+	}
+	if len(chain) != 1 || chain[0].TelegramID != 1 || chain[0].SenderName != "Ann" {
+		t.Errorf("reply chain = %+v", chain)
+	}
+
+	counts, err := db.CountMemberEvents(channel.ID, time.Time{})
+	if err != nil {
+		t.Fatalf("CountMemberEvents: %v", err)
+	}
+	if len(counts) != 2 || counts[models.MemberAdded] != 1 || counts[models.MemberLeft] != 1 {
+		t.Errorf("member events = %v, want one add and one leave", counts)
+	}
+
+	snapshot, err := db.GetLatestParticipantSnapshot(channel.ID)
+	if err != nil || snapshot == nil {
+		t.Fatalf("GetLatestParticipantSnapshot: %v", err)
+	}
+	if snapshot.Total != 3 || len(snapshot.Participants) != 3 {
+		t.Fatalf("snapshot = %+v", snapshot)
+	}
+	if p := snapshot.Participants[0]; p.Role != models.RoleCreator || p.Name != "Ann" {
+		t.Errorf("first participant = %+v, want creator Ann", p)
+	}
+	if p := snapshot.Participants[1]; p.Role != models.RoleAdmin || p.Rank != "mod" {
+		t.Errorf("second participant = %+v, want admin mod", p)
+	}
+}
+
+func TestProcessMessage(t *testing.T) {
+	s, _, db := newTestScraper(t)
+	ctx := context.Background()
+	channel, err := s.FetchChannelInfo(ctx, "test_channel")
+	if err != nil {
+		t.Fatalf("FetchChannelInfo: %v", err)
+	}
+
+	date := testBase.Add(time.Hour)
+	editDate := date.Add(time.Minute)
+	message := &tg.Message{
+		ID:       7,
+		PeerID:   &tg.PeerChannel{ChannelID: testChannelID},
+		FromID:   &tg.PeerUser{UserID: 99},
+		Message:  "hello #golang",
+		Date:     int(date.Unix()),
+		Views:    120,
+		Forwards: 3,
+		Entities: []tg.MessageEntityClass{
+			&tg.MessageEntityBold{Offset: 0, Length: 5},
+			&tg.MessageEntityHashtag{Offset: 6, Length: 7},
+		},
+		Media: &tg.MessageMediaWebPage{
+			Webpage: &tg.WebPage{URL: "https://example.com"},
+		},
+	}
+	message.SetEditDate(int(editDate.Unix()))
+	message.SetGroupedID(555)
+	message.SetReplies(tg.MessageReplies{Replies: 4})
+	message.SetFwdFrom(tg.MessageFwdHeader{
+		FromID:      &tg.PeerChannel{ChannelID: 2002},
+		ChannelPost: 11,
+		Date:        int(testBase.Unix()),
+		PostAuthor:  "author",
+	})
+	message.SetReactions(tg.MessageReactions{Results: []tg.ReactionCount{
+		{Reaction: &tg.ReactionEmoji{Emoticon: "👍"}, Count: 5},
+		{Reaction: &tg.ReactionCustomEmoji{DocumentID: 8}, Count: 2},
+	}})
+
+	if err := s.processMessage(ctx, message, channel.ID); err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+
+	got, err := db.GetMessageByTelegramID(channel.ID, 7)
+	if err != nil {
+		t.Fatalf("GetMessageByTelegramID: %v", err)
+	}
+	if got.Text != "hello #golang" || got.SenderID != 99 || got.Views != 120 || got.Forwards != 3 ||
+		got.Replies != 4 || got.Reactions != 7 || got.GroupedID != 555 {
+		t.Errorf("unexpected message: %+v", got)
+	}
+	if !got.Date.Equal(date) {
+		t.Errorf("date = %v, want %v", got.Date, date)
+	}
+	if got.EditDate == nil || !got.EditDate.Equal(editDate) {
+		t.Errorf("edit date = %v, want %v", got.EditDate, editDate)
+	}
+	if got.MediaType != "webpage" || got.MediaURL != "https://example.com" {
+		t.Errorf("media = %s %s, want webpage https://example.com", got.MediaType, got.MediaURL)
+	}
+	if fwd := got.Forward; fwd == nil || fwd.FromType != models.ForwardFromChannel ||
+		fwd.FromID != 2002 || fwd.MessageID != 11 || fwd.PostAuthor != "author" {
+		t.Errorf("forward = %+v", got.Forward)
+	}
+
+	entities, err := db.GetMessageEntities(got.ID)
+	if err != nil {
+		t.Fatalf("GetMessageEntities: %v", err)
+	}
+	if len(entities) != 2 || entities[0].Type != models.EntityBold || entities[1].Text != "#golang" {
+		t.Errorf("unexpected entities: %+v", entities)
+	}
+
+	snapshot, err := db.GetLatestReactionSnapshot(got.ID)
+	if err != nil || snapshot == nil {
+		t.Fatalf("GetLatestReactionSnapshot: %v", err)
+	}
+	if snapshot.Total != 7 || len(snapshot.Reactions) != 2 {
+		t.Errorf("unexpected reaction snapshot: %+v", snapshot)
+	}
+}
+
+func TestRememberedChannelsInactive(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	backend.AddChannel(3003, 33, "other_channel", "Other")
+
+	// 转发来源等只有 min 信息或顺带出现在响应中的频道不是活跃频道
+	source := &tg.Channel{ID: 2002, Title: "Source", Broadcast: true, Min: true, Photo: &tg.ChatPhotoEmpty{}}
+	other := &tg.Channel{ID: 3003, Title: "Other", Username: "other_channel", Broadcast: true, Photo: &tg.ChatPhotoEmpty{}}
+	other.SetAccessHash(33)
+	s.peers.remember([]tg.ChatClass{source, other})
+	for _, id := range []int64{2002, 3003} {
+		channel, err := db.GetChannelByTelegramID(id)
+		if err != nil {
+			t.Fatalf("GetChannelByTelegramID(%d): %v", id, err)
+		}
+		if channel.IsActive {
+			t.Errorf("channel %d is active after being seen in a response", id)
+		}
+	}
+
+	// 明确获取的频道标记为活跃，之后再次出现在响应中也保持活跃
+	channel, err := s.FetchChannelInfoByID(ctx, 3003)
+	if err != nil {
+		t.Fatalf("FetchChannelInfoByID: %v", err)
+	}
+	if !channel.IsActive {
+		t.Error("fetched channel is not active")
+	}
+	s.peers.remember([]tg.ChatClass{&tg.Channel{ID: 3003, Title: "Renamed", Username: "other_channel", Broadcast: true,
+		AccessHash: 33, Photo: &tg.ChatPhotoEmpty{}}})
+	stored, err := db.GetChannelByTelegramID(3003)
+	if err != nil {
+		t.Fatalf("GetChannelByTelegramID: %v", err)
+	}
+	if !stored.IsActive || stored.Title != "Renamed" {
+		t.Errorf("stored channel = %+v, want active and renamed", stored)
+	}
+}
+
+func TestFetchChannelHistorySenders(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	backend.SetUser(99, "Ann", "Lee", "ann")
+
+	signed := &tg.Message{ID: 1, Message: "signed", Date: int(testBase.Unix())}
+	signed.SetFromID(&tg.PeerUser{UserID: 99})
+	signed.SetPostAuthor("Ann L.")
+	anonymous := &tg.Message{ID: 2, Message: "anonymous admin", Date: int(testBase.Unix())}
+	anonymous.SetFromID(&tg.PeerChannel{ChannelID: testChannelID})
+	backend.AddMessage(testChannelID, signed)
+	backend.AddMessage(testChannelID, anonymous)
+	backend.AddMessage(testChannelID, &tg.Message{ID: 3, Message: "post", Date: int(testBase.Unix())})
+
+	if err := s.FetchChannelHistory(ctx, "test_channel", FetchOptions{}); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+	channel, err := db.GetChannelByTelegramID(testChannelID)
+	if err != nil {
+		t.Fatalf("GetChannelByTelegramID: %v", err)
+	}
+	message := func(id int64) *models.Message {
+		t.Helper()
+		m, err := db.GetMessageByTelegramID(channel.ID, id)
+		if err != nil {
+			t.Fatalf("GetMessageByTelegramID(%d): %v", id, err)
+		}
+		return m
+	}
+
+	if m := message(1); m.SenderType != models.SenderUser || m.SenderID != 99 ||
+		m.SenderName != "Ann Lee" || m.PostAuthor != "Ann L." {
+		t.Errorf("signed post sender = %s %d %q %q", m.SenderType, m.SenderID, m.SenderName, m.PostAuthor)
+	}
+	if m := message(2); m.SenderType != models.SenderChannel || m.SenderID != testChannelID ||
+		m.SenderName != "Test Channel" {
+		t.Errorf("anonymous admin sender = %s %d %q", m.SenderType, m.SenderID, m.SenderName)
+	}
+	if m := message(3); m.SenderType != "" || m.SenderID != 0 || m.SenderName != "" {
+		t.Errorf("channel post sender = %s %d %q", m.SenderType, m.SenderID, m.SenderName)
+	}
+
+	// 改名后重新抓取，已保存的消息保留原名称，senders 表更新为新名称
+	backend.SetUser(99, "Bob", "", "bob")
+	if err := s.FetchChannelHistory(ctx, "test_channel", FetchOptions{Full: true}); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+	if m := message(1); m.SenderName != "Ann Lee" {
+		t.Errorf("sender name after rename = %q, want Ann Lee", m.SenderName)
+	}
+	sender, err := db.GetSender(models.SenderUser, 99)
+	if err != nil {
+		t.Fatalf("GetSender: %v", err)
+	}
+	if sender.Name != "Bob" || sender.Username != "bob" {
+		t.Errorf("sender = %+v, want Bob (@bob)", sender)
+	}
+
+	// 响应中没有附带用户时从 senders 表解析
+	if _, _, name := newSenderCache(db).resolve(&tg.PeerUser{UserID: 99}); name != "Bob" {
+		t.Errorf("resolved name = %q, want Bob", name)
+	}
+}
+
+func TestProcessMessagePoll(t *testing.T) {
+	s, _, db := newTestScraper(t)
+	ctx := context.Background()
+	channel, err := s.FetchChannelInfo(ctx, "test_channel")
+	if err != nil {
+		t.Fatalf("FetchChannelInfo: %v", err)
+	}
+
+	message := &tg.Message{
+		ID:     8,
+		PeerID: &tg.PeerChannel{ChannelID: testChannelID},
+		Date:   int(testBase.Unix()),
+		Media: &tg.MessageMediaPoll{
+			Poll: tg.Poll{
+				ID:       77,
+				Quiz:     true,
+				Question: "2 + 2?",
+				Answers: []tg.PollAnswer{
+					{Text: "3", Option: []byte{0}},
+					{Text: "4", Option: []byte{1}},
+				},
+			},
+			Results: tg.PollResults{
+				Results: []tg.PollAnswerVoters{
+					{Option: []byte{0}, Voters: 1},
+					{Option: []byte{1}, Voters: 9, Correct: true},
+				},
+				TotalVoters: 10,
+			},
+		},
+	}
+	message.Media.(*tg.MessageMediaPoll).Results.SetFlags()
+
+	if err := s.processMessage(ctx, message, channel.ID); err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+
+	stored, err := db.GetMessageByTelegramID(channel.ID, 8)
+	if err != nil {
+		t.Fatalf("GetMessageByTelegramID: %v", err)
+	}
+	if stored.MediaType != "poll" {
+		t.Errorf("media type = %s, want poll", stored.MediaType)
+	}
+	poll, err := db.GetMessagePoll(stored.ID)
+	if err != nil {
+		t.Fatalf("GetMessagePoll: %v", err)
+	}
+	if !poll.Quiz || poll.TotalVoters != 10 || len(poll.Answers) != 2 {
+		t.Fatalf("unexpected poll: %+v", poll)
+	}
+	if poll.Answers[1].Voters != 9 || !poll.Answers[1].Correct || poll.Answers[0].Correct {
+		t.Errorf("unexpected answers: %+v %+v", poll.Answers[0], poll.Answers[1])
+	}
+}
+
+func TestProcessMessageRejectsEmpty(t *testing.T) {
+	s, _, _ := newTestScraper(t)
+	if err := s.processMessage(context.Background(), &tg.MessageEmpty{ID: 1}, 1); err == nil {
+		t.Fatal("processMessage should reject messageEmpty")
+	}
+}
+
+func TestCheckNewMessages(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	addMessages(backend, 1, 5)
+	if err := s.FetchChannelHistory(ctx, "test_channel", FetchOptions{}); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+	channel, err := db.GetChannelByTelegramID(testChannelID)
+	if err != nil {
+		t.Fatalf("GetChannelByTelegramID: %v", err)
+	}
+
+	// 两页以上的新消息
+	addMessages(backend, 6, 28)
+	newest, err := s.checkNewMessages(ctx, channel, 5)
+	if err != nil {
+		t.Fatalf("checkNewMessages: %v", err)
+	}
+	if newest != 28 {
+		t.Errorf("newest = %d, want 28", newest)
+	}
+	if got := storedIDs(t, db); !equalIDs(got, idRange(28, 1)) {
+		t.Fatalf("stored ids = %v, want 28..1", got)
+	}
+
+	for _, r := range backend.HistoryRequests()[1:] {
+		if r.MinID != 5 {
+			t.Errorf("min_id = %d, want 5", r.MinID)
+		}
+	}
+
+	// 没有新消息时不改变最新 ID
+	newest, err = s.checkNewMessages(ctx, channel, 28)
+	if err != nil {
+		t.Fatalf("checkNewMessages: %v", err)
+	}
+	if newest != 28 {
+		t.Errorf("newest = %d, want 28", newest)
+	}
+}
+
+func TestCheckNewMessagesServiceMessageAtPageEnd(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	addMessages(backend, 1, 5)
+	if err := s.FetchChannelHistory(ctx, "test_channel", FetchOptions{}); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+	channel, err := db.GetChannelByTelegramID(testChannelID)
+	if err != nil {
+		t.Fatalf("GetChannelByTelegramID: %v", err)
+	}
+
+	// 第一页 28..19 以服务消息结束，仍需继续翻页
+	addMessages(backend, 6, 18)
+	backend.AddServiceMessage(testChannelID, &tg.MessageService{ID: 19, Date: int(testBase.Unix()),
+		Action: &tg.MessageActionPinMessage{}})
+	addMessages(backend, 20, 28)
+	newest, err := s.checkNewMessages(ctx, channel, 5)
+	if err != nil {
+		t.Fatalf("checkNewMessages: %v", err)
+	}
+	if newest != 28 {
+		t.Errorf("newest = %d, want 28", newest)
+	}
+	if got, want := storedIDs(t, db), append(idRange(28, 20), idRange(18, 1)...); !equalIDs(got, want) {
+		t.Fatalf("stored ids = %v, want %v", got, want)
+	}
+	if requests := backend.HistoryRequests(); requests[2].OffsetID != 19 {
+		t.Errorf("second page offset_id = %d, want 19", requests[2].OffsetID)
+	}
+}
+
+func TestHandleChannelUpdate(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	addMessages(backend, 1, 3)
+	if err := s.FetchChannelHistory(ctx, "test_channel", FetchOptions{}); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+	channel, err := db.GetChannelByTelegramID(testChannelID)
+	if err != nil {
+		t.Fatalf("GetChannelByTelegramID: %v", err)
+	}
+	live := s.watch(channel, 3, 100)
+	newMessage := func(id, pts int) {
+		message := &tg.Message{ID: id, Message: "live", Date: int(testBase.Add(time.Duration(id) * time.Minute).Unix()),
+			PeerID: &tg.PeerChannel{ChannelID: testChannelID}}
+		s.handleChannelUpdate(ctx, testChannelID, &tg.UpdateNewChannelMessage{Message: message, Pts: pts, PtsCount: 1}, pts, 1)
+	}
+
+	newMessage(4, 101)
+	if got := storedIDs(t, db); !equalIDs(got, idRange(4, 1)) {
+		t.Fatalf("stored ids = %v, want 4..1", got)
+	}
+	if state, err := db.GetChannelState(channel.ID); err != nil || state.Pts != 101 {
+		t.Errorf("stored state = %+v, %v, want pts 101", state, err)
+	}
+
+	// 重复的更新被忽略
+	newMessage(5, 101)
+	if got := storedIDs(t, db); !equalIDs(got, idRange(4, 1)) {
+		t.Errorf("duplicate update stored ids = %v, want 4..1", got)
+	}
+
+	// 有缺口时不应用，请求补齐
+	newMessage(7, 104)
+	if got := storedIDs(t, db); !equalIDs(got, idRange(4, 1)) {
+		t.Errorf("gap update stored ids = %v, want 4..1", got)
+	}
+	if live.currentPts() != 101 {
+		t.Errorf("pts = %d, want 101", live.currentPts())
+	}
+	select {
+	case <-live.catchUp:
+	default:
+		t.Error("gap did not request a catch-up")
+	}
+}
+
+func TestHandleChannelUpdateConcurrent(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	addMessages(backend, 1, 3)
+	channel, _ := watchTestChannel(t, s, db, 100)
+	s.media = newMediaDownloader(db, s.client, &models.MediaConfig{
+		Enabled:   true,
+		Directory: t.TempDir(),
+		Photo:     models.MediaTypeConfig{Enabled: true},
+	})
+
+	peer := &tg.PeerChannel{ChannelID: testChannelID}
+	photo := &tg.Message{ID: 4, Message: "photo", Date: int(testBase.Add(4 * time.Minute).Unix()), PeerID: peer,
+		Media: &tg.MessageMediaPhoto{Photo: &tg.Photo{ID: 1, Sizes: []tg.PhotoSizeClass{&tg.PhotoSize{Type: "x", W: 1, H: 1, Size: 10}}}}}
+	text := &tg.Message{ID: 5, Message: "text", Date: int(testBase.Add(5 * time.Minute).Unix()), PeerID: peer}
+
+	// gotd 在各自的协程中处理更新，第一条更新下载媒体时第二条更新已经到达
+	release := backend.Hold("upload.getFile")
+	var wg sync.WaitGroup
+	deliver := func(message *tg.Message, pts int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handleChannelUpdate(ctx, testChannelID, &tg.UpdateNewChannelMessage{Message: message, Pts: pts, PtsCount: 1}, pts, 1)
+		}()
+	}
+	deliver(photo, 101)
+	for deadline := time.Now().Add(5 * time.Second); len(backend.Requests("upload.getFile")) == 0; {
+		if time.Now().After(deadline) {
+			release()
+			t.Fatal("media download was not requested")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	deliver(text, 102)
+	time.Sleep(100 * time.Millisecond)
+
+	// 第一条更新写入完成之前，第二条更新既不能写入，也不能保存 pts
+	if got := storedIDs(t, db); !equalIDs(got, idRange(4, 1)) {
+		t.Errorf("stored ids while the first update is applied = %v, want 4..1", got)
+	}
+	if state, err := db.GetChannelState(channel.ID); err == nil && state.Pts > 100 {
+		t.Errorf("stored pts %d while the first update is applied", state.Pts)
+	}
+
+	release()
+	wg.Wait()
+	if got := storedIDs(t, db); !equalIDs(got, idRange(5, 1)) {
+		t.Errorf("stored ids = %v, want 5..1", got)
+	}
+	if state, err := db.GetChannelState(channel.ID); err != nil || state.Pts != 102 {
+		t.Errorf("stored state = %+v, %v, want pts 102", state, err)
+	}
+}
+
+func TestFetchComments(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	// 只在评论翻页之间等待，单页评论不受请求间隔影响
+	s.delay = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const discussionID = 9009
+	date := int(testBase.Unix())
+	addComments := func(from, to int) {
+		for id := from; id <= to; id++ {
+			backend.AddComment(testChannelID, 2, &tg.Message{ID: id, Message: "comment", Date: date,
+				PeerID: &tg.PeerChannel{ChannelID: discussionID}, FromID: &tg.PeerUser{UserID: 1}})
+		}
+	}
+	post := func(replies, maxID int) *tg.Message {
+		info := tg.MessageReplies{Comments: true, Replies: replies}
+		info.SetMaxID(maxID)
+		info.SetChannelID(discussionID)
+		message := &tg.Message{ID: 2, Message: "post", Date: date}
+		message.SetReplies(info)
+		return message
+	}
+	backend.AddMessage(testChannelID, &tg.Message{ID: 1, Message: "no comments", Date: date})
+	backend.AddMessage(testChannelID, post(3, 103))
+	addComments(101, 103)
+
+	if err := s.FetchChannelHistory(ctx, "test_channel", FetchOptions{Comments: true}); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+	// 没有评论的帖子不发出请求
+	if requests := backend.Requests("messages.getReplies"); len(requests) != 1 {
+		t.Fatalf("got %d getReplies requests, want 1", len(requests))
+	}
+	channel, err := db.GetChannelByTelegramID(testChannelID)
+	if err != nil {
+		t.Fatalf("GetChannelByTelegramID: %v", err)
+	}
+	stored, err := db.GetMessageByTelegramID(channel.ID, 2)
+	if err != nil {
+		t.Fatalf("GetMessageByTelegramID: %v", err)
+	}
+	if comments, err := db.GetMessageComments(stored.ID); err != nil || len(comments) != 3 {
+		t.Fatalf("GetMessageComments = %d, %v, want 3", len(comments), err)
+	}
+
+	// 新评论超过一页时从已保存的最新评论之后翻页
+	s.delay = 0
+	addComments(104, 115)
+	if err := s.fetchComments(ctx, channel, post(15, 115)); err != nil {
+		t.Fatalf("fetchComments: %v", err)
+	}
+	requests := backend.Requests("messages.getReplies")
+	if len(requests) != 3 {
+		t.Fatalf("got %d getReplies requests, want 3", len(requests))
+	}
+	for _, r := range requests[1:] {
+		if r := r.(*tg.MessagesGetRepliesRequest); r.MinID != 103 {
+			t.Errorf("min_id = %d, want 103", r.MinID)
+		}
+	}
+	if r := requests[2].(*tg.MessagesGetRepliesRequest); r.OffsetID != 106 {
+		t.Errorf("second page offset_id = %d, want 106", r.OffsetID)
+	}
+	if comments, err := db.GetMessageComments(stored.ID); err != nil || len(comments) != 15 {
+		t.Errorf("GetMessageComments = %d, %v, want 15", len(comments), err)
+	}
+
+	// 没有新评论时不发出请求
+	if err := s.fetchComments(ctx, channel, post(15, 115)); err != nil {
+		t.Fatalf("fetchComments: %v", err)
+	}
+	if n := len(backend.Requests("messages.getReplies")); n != 3 {
+		t.Errorf("got %d getReplies requests, want 3", n)
+	}
+}
+
+// watchTestChannel 抓取测试频道的历史消息并开始监听，返回已保存的频道和监听状态
+func watchTestChannel(t *testing.T, s *Scraper, db *database.Database, pts int) (*models.Channel, *liveChannel) {
+	t.Helper()
+	if err := s.FetchChannelHistory(context.Background(), "test_channel", FetchOptions{}); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+	channel, err := db.GetChannelByTelegramID(testChannelID)
+	if err != nil {
+		t.Fatalf("GetChannelByTelegramID: %v", err)
+	}
+	lastMessageID, err := db.GetLastMessageID(channel.ID)
+	if err != nil {
+		t.Fatalf("GetLastMessageID: %v", err)
+	}
+	return channel, s.watch(channel, lastMessageID, pts)
+}
+
+func TestCatchUpChannelDifference(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	addMessages(backend, 1, 3)
+	channel, live := watchTestChannel(t, s, db, 100)
+
+	peer := &tg.PeerChannel{ChannelID: testChannelID}
+	date := int(testBase.Add(10 * time.Minute).Unix())
+	edited := &tg.Message{ID: 2, Message: "edited", Date: int(testBase.Add(2 * time.Minute).Unix()), PeerID: peer}
+	edited.SetEditDate(date)
+	backend.AddChannelDifference(testChannelID,
+		&tg.UpdatesChannelDifference{
+			Pts:          102,
+			NewMessages:  []tg.MessageClass{&tg.Message{ID: 4, Message: "missed", Date: date, PeerID: peer}},
+			OtherUpdates: []tg.UpdateClass{&tg.UpdateEditChannelMessage{Message: edited, Pts: 102, PtsCount: 1}},
+		},
+		&tg.UpdatesChannelDifference{
+			Final:        true,
+			Pts:          103,
+			OtherUpdates: []tg.UpdateClass{&tg.UpdateDeleteChannelMessages{ChannelID: testChannelID, Messages: []int{1}, Pts: 103, PtsCount: 1}},
+		},
+	)
+
+	if err := s.catchUp(ctx, live); err != nil {
+		t.Fatalf("catchUp: %v", err)
+	}
+
+	// 第二次请求从第一页返回的 pts 继续
+	requests := backend.Requests("updates.getChannelDifference")
+	if len(requests) != 2 {
+		t.Fatalf("got %d getChannelDifference requests, want 2", len(requests))
+	}
+	for i, want := range []int{100, 102} {
+		if r := requests[i].(*tg.UpdatesGetChannelDifferenceRequest); r.Pts != want {
+			t.Errorf("request %d pts = %d, want %d", i, r.Pts, want)
+		}
+	}
+	if got := storedIDs(t, db); !equalIDs(got, idRange(4, 1)) {
+		t.Errorf("stored ids = %v, want 4..1", got)
+	}
+	if message, err := db.GetMessageByTelegramID(channel.ID, 2); err != nil || message.Text != "edited" {
+		t.Errorf("edited message = %+v, %v", message, err)
+	}
+	if message, err := db.GetMessageByTelegramID(channel.ID, 1); err != nil || message.DeletedAt == nil {
+		t.Errorf("deleted message = %+v, %v, want deleted_at", message, err)
+	}
+	if live.currentPts() != 103 {
+		t.Errorf("pts = %d, want 103", live.currentPts())
+	}
+	if state, err := db.GetChannelState(channel.ID); err != nil || state.Pts != 103 {
+		t.Errorf("stored state = %+v, %v, want pts 103", state, err)
+	}
+}
+
+func TestCatchUpDifferenceTooLong(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	addMessages(backend, 1, 3)
+	channel, live := watchTestChannel(t, s, db, 100)
+
+	// 差异过大时按消息 ID 补齐，并以 dialog 中的 pts 作为新的起点
+	addMessages(backend, 4, 25)
+	backend.AddChannelDifference(testChannelID, &tg.UpdatesChannelDifferenceTooLong{
+		Final:  true,
+		Dialog: &tg.Dialog{Peer: &tg.PeerChannel{ChannelID: testChannelID}, TopMessage: 25, Pts: 500},
+	})
+	if err := s.catchUp(ctx, live); err != nil {
+		t.Fatalf("catchUp: %v", err)
+	}
+	if got := storedIDs(t, db); !equalIDs(got, idRange(25, 1)) {
+		t.Errorf("stored ids = %v, want 25..1", got)
+	}
+	if lastMessageID, _ := live.snapshot(); lastMessageID != 25 {
+		t.Errorf("last message id = %d, want 25", lastMessageID)
+	}
+	if live.currentPts() != 500 {
+		t.Errorf("pts = %d, want 500", live.currentPts())
+	}
+	if state, err := db.GetChannelState(channel.ID); err != nil || state.Pts != 500 {
+		t.Errorf("stored state = %+v, %v, want pts 500", state, err)
+	}
+
+	// 没有保存过 pts 时不请求差异，以频道完整信息中的 pts 为准
+	backend.Channel(testChannelID).Pts = 42
+	addMessages(backend, 26, 27)
+	live = s.watch(channel, 25, 0)
+	before := len(backend.Requests("updates.getChannelDifference"))
+	if err := s.catchUp(ctx, live); err != nil {
+		t.Fatalf("catchUp: %v", err)
+	}
+	if after := len(backend.Requests("updates.getChannelDifference")); after != before {
+		t.Errorf("requested a difference without a saved pts")
+	}
+	if got := storedIDs(t, db); !equalIDs(got, idRange(27, 1)) {
+		t.Errorf("stored ids = %v, want 27..1", got)
+	}
+	if state, err := db.GetChannelState(channel.ID); err != nil || state.Pts != 42 {
+		t.Errorf("stored state = %+v, %v, want pts 42", state, err)
+	}
+}
+
+func TestMessageVersions(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	addMessages(backend, 1, 3)
+	channel, _ := watchTestChannel(t, s, db, 100)
+
+	edit := func(text string, minutes, pts int) {
+		message := &tg.Message{ID: 2, Message: text, Date: int(testBase.Add(2 * time.Minute).Unix()),
+			PeerID: &tg.PeerChannel{ChannelID: testChannelID}}
+		message.SetEditDate(int(testBase.Add(time.Duration(minutes) * time.Minute).Unix()))
+		s.handleChannelUpdate(ctx, testChannelID, &tg.UpdateEditChannelMessage{Message: message, Pts: pts, PtsCount: 1}, pts, 1)
+	}
+	// 第一次编辑同时补记原始内容，内容未变化的编辑（如只更新浏览数）不记录
+	edit("first edit", 10, 101)
+	edit("first edit", 11, 102)
+	edit("second edit", 20, 103)
+
+	stored, err := db.GetMessageByTelegramID(channel.ID, 2)
+	if err != nil {
+		t.Fatalf("GetMessageByTelegramID: %v", err)
+	}
+	versions, err := db.GetMessageVersions(stored.ID)
+	if err != nil {
+		t.Fatalf("GetMessageVersions: %v", err)
+	}
+	want := []struct {
+		text string
+		date time.Time
+	}{
+		{"message", testBase.Add(2 * time.Minute)},
+		{"first edit", testBase.Add(10 * time.Minute)},
+		{"second edit", testBase.Add(20 * time.Minute)},
+	}
+	if len(versions) != len(want) {
+		t.Fatalf("got %d versions, want %d", len(versions), len(want))
+	}
+	for i, v := range versions {
+		if v.Version != i+1 || v.Text != want[i].text || !v.EditDate.Equal(want[i].date) {
+			t.Errorf("version %d = %d %q %v, want %d %q %v", i, v.Version, v.Text, v.EditDate, i+1, want[i].text, want[i].date)
+		}
+	}
+	if stored.Text != "second edit" {
+		t.Errorf("text = %q, want %q", stored.Text, "second edit")
+	}
+
+	// 没有被编辑过的消息没有历史版本
+	other, err := db.GetMessageByTelegramID(channel.ID, 3)
+	if err != nil {
+		t.Fatalf("GetMessageByTelegramID: %v", err)
+	}
+	if versions, err := db.GetMessageVersions(other.ID); err != nil || len(versions) != 0 {
+		t.Errorf("unedited message versions = %d, %v", len(versions), err)
+	}
+}
+
+func TestLogPreview(t *testing.T) {
+	text := strings.Repeat("中", 60)
+	if got := logPreview(text); got != strings.Repeat("中", 50) {
+		t.Errorf("logPreview = %q, want the first 50 runes", got)
+	}
+	if got := logPreview("short"); got != "short" {
+		t.Errorf("logPreview = %q, want %q", got, "short")
+	}
+}
+
+func TestCheckNewMessagesError(t *testing.T) {
+	s, backend, db := newTestScraper(t)
+	ctx := context.Background()
+	addMessages(backend, 1, 3)
+	if err := s.FetchChannelHistory(ctx, "test_channel", FetchOptions{}); err != nil {
+		t.Fatalf("FetchChannelHistory: %v", err)
+	}
+	channel, err := db.GetChannelByTelegramID(testChannelID)
+	if err != nil {
+		t.Fatalf("GetChannelByTelegramID: %v", err)
+	}
+
+	failure := errors.New("connection reset")
+	backend.Fail("messages.getHistory", failure)
+	newest, err := s.checkNewMessages(ctx, channel, 3)
+	if !errors.Is(err, failure) {
+		t.Fatalf("err = %v, want %v", err, failure)
+	}
+	if newest != 3 {
+		t.Errorf("newest = %d, want unchanged 3", newest)
+	}
+}
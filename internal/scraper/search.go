@@ -0,0 +1,388 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// SearchOptions 服务器端搜索选项
+type SearchOptions struct {
+	Query  string
+	Filter string    // 消息类型过滤，见 SearchFilters，为空时不过滤
+	Since  time.Time // 只搜索此时间及之后的消息，零值表示不限制
+	Until  time.Time // 只搜索此时间之前的消息，零值表示不限制
+	Limit  int       // 最多保存的消息数量，0 表示全部
+}
+
+// dates 返回请求使用的 min_date 和 max_date，零值表示不限制
+func (o SearchOptions) dates() (int, int) {
+	minDate, maxDate := 0, 0
+	if !o.Since.IsZero() {
+		minDate = int(o.Since.Unix())
+	}
+	if !o.Until.IsZero() {
+		maxDate = int(o.Until.Unix())
+	}
+	return minDate, maxDate
+}
+
+// searchFilters 过滤名称对应的 Telegram 过滤器
+var searchFilters = map[string]func() tg.MessagesFilterClass{
+	"photo":       func() tg.MessagesFilterClass { return &tg.InputMessagesFilterPhotos{} },
+	"video":       func() tg.MessagesFilterClass { return &tg.InputMessagesFilterVideo{} },
+	"photo_video": func() tg.MessagesFilterClass { return &tg.InputMessagesFilterPhotoVideo{} },
+	"document":    func() tg.MessagesFilterClass { return &tg.InputMessagesFilterDocument{} },
+	"url":         func() tg.MessagesFilterClass { return &tg.InputMessagesFilterURL{} },
+	"gif":         func() tg.MessagesFilterClass { return &tg.InputMessagesFilterGif{} },
+	"voice":       func() tg.MessagesFilterClass { return &tg.InputMessagesFilterVoice{} },
+	"music":       func() tg.MessagesFilterClass { return &tg.InputMessagesFilterMusic{} },
+	"round":       func() tg.MessagesFilterClass { return &tg.InputMessagesFilterRoundVideo{} },
+	"geo":         func() tg.MessagesFilterClass { return &tg.InputMessagesFilterGeo{} },
+	"pinned":      func() tg.MessagesFilterClass { return &tg.InputMessagesFilterPinned{} },
+}
+
+// SearchFilters 支持的过滤名称
+var SearchFilters = []string{"photo", "video", "photo_video", "document", "url", "gif", "voice", "music", "round", "geo", "pinned"}
+
+// searchFilter 返回过滤名称对应的过滤器
+func searchFilter(name string) (tg.MessagesFilterClass, error) {
+	if name == "" {
+		return &tg.InputMessagesFilterEmpty{}, nil
+	}
+	filter, ok := searchFilters[name]
+	if !ok {
+		return nil, fmt.Errorf("不支持的过滤类型: %s", name)
+	}
+	return filter(), nil
+}
+
+// SearchChannel 通过 messages.search 在频道内进行服务器端搜索，保存所有命中的消息
+//
+// 适合只需要大频道中少量相关消息的场景，不必抓取完整的历史。
+// 命中的消息和普通抓取一样保存，并在 search_hits 中记录命中它的关键词。
+// 返回保存的消息数量。
+func (s *Scraper) SearchChannel(ctx context.Context, channel *models.Channel, opts SearchOptions) (int, error) {
+	if opts.Query == "" {
+		return 0, fmt.Errorf("搜索关键词不能为空")
+	}
+	filter, err := searchFilter(opts.Filter)
+	if err != nil {
+		return 0, err
+	}
+
+	minDate, maxDate := opts.dates()
+	pageSize := s.pageSize()
+	saved, offsetID := 0, 0
+	log.Printf("在频道 %s 中搜索 \"%s\"，时间范围 %s，批次大小 %d...", channel.Title, opts.Query,
+		describeWindow(opts.Since, opts.Until), pageSize)
+
+	for opts.Limit <= 0 || saved < opts.Limit {
+		currentLimit := pageSize
+		if opts.Limit > 0 && opts.Limit-saved < pageSize {
+			currentLimit = opts.Limit - saved
+		}
+
+		result, err := s.client.MessagesSearch(ctx, &tg.MessagesSearchRequest{
+			Peer:     inputPeer(channel),
+			Q:        opts.Query,
+			Filter:   filter,
+			MinDate:  minDate,
+			MaxDate:  maxDate,
+			OffsetID: offsetID,
+			Limit:    currentLimit,
+		})
+		if err != nil {
+			return saved, fmt.Errorf("搜索消息失败 (offset: %d): %w", offsetID, err)
+		}
+		modified, ok := result.AsModified()
+		if !ok {
+			return saved, fmt.Errorf("无效的搜索响应类型: %T", result)
+		}
+		s.peers.remember(modified.GetChats())
+		s.senders.remember(modified.GetUsers(), modified.GetChats())
+		msgs := modified.GetMessages()
+		if len(msgs) == 0 {
+			break
+		}
+
+		for _, msg := range msgs {
+			if message, ok := msg.(*tg.Message); ok && maxDate > 0 && message.Date >= maxDate {
+				continue
+			}
+			if err := s.saveSearchHit(ctx, msg, channel.ID, opts.Query); err != nil {
+				log.Printf("保存搜索结果 %d 失败: %v", msg.GetID(), err)
+				continue
+			}
+			saved++
+		}
+		log.Printf("已保存 %d 条搜索结果 (offset: %d)", saved, offsetID)
+
+		offsetID = msgs[len(msgs)-1].GetID()
+		if len(msgs) < currentLimit {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return saved, ctx.Err()
+		case <-time.After(s.delay):
+		}
+	}
+
+	log.Printf("频道 %s 搜索 \"%s\" 完成，共保存 %d 条消息", channel.Title, opts.Query, saved)
+	s.logWaitSummary()
+	return saved, nil
+}
+
+// saveSearchHit 保存一条搜索命中的消息并记录命中的关键词
+//
+// 已保存过的消息按重新抓取处理，内容有变化时会记录编辑版本。
+func (s *Scraper) saveSearchHit(ctx context.Context, msg tg.MessageClass, channelID int64, query string) error {
+	if _, ok := msg.(*tg.Message); !ok {
+		return fmt.Errorf("不是普通消息: %T", msg)
+	}
+
+	existing, err := s.storedMessage(channelID, int64(msg.GetID()))
+	if err != nil {
+		return err
+	}
+	save := s.processMessage
+	if existing != nil {
+		save = s.refreshMessage
+	}
+	if err := save(ctx, msg, channelID); err != nil {
+		return err
+	}
+
+	stored, err := s.db.GetMessageByTelegramID(channelID, int64(msg.GetID()))
+	if err != nil {
+		return fmt.Errorf("获取已保存的消息失败: %w", err)
+	}
+	return s.db.SaveSearchHit(stored.ID, query)
+}
+
+// SearchGlobal 通过 messages.searchGlobal 在 Telegram 的所有公开频道中搜索帖子，保存命中的消息
+//
+// 只保存广播频道的帖子，群组和私聊中的结果会被跳过。结果中之前没有见过的频道
+// 会连同 access hash 自动写入 channels 表，之后可以直接使用 fetch --id 抓取。
+// 命中的消息同样在 search_hits 中记录关键词。返回保存的消息数量。
+func (s *Scraper) SearchGlobal(ctx context.Context, opts SearchOptions) (int, error) {
+	if opts.Query == "" {
+		return 0, fmt.Errorf("搜索关键词不能为空")
+	}
+	filter, err := searchFilter(opts.Filter)
+	if err != nil {
+		return 0, err
+	}
+
+	minDate, maxDate := opts.dates()
+	pageSize := s.pageSize()
+	var (
+		saved, discovered    int
+		offsetRate, offsetID int
+		offsetPeer           tg.InputPeerClass = &tg.InputPeerEmpty{}
+	)
+	log.Printf("全局搜索 \"%s\"，时间范围 %s，批次大小 %d...", opts.Query, describeWindow(opts.Since, opts.Until), pageSize)
+
+	for opts.Limit <= 0 || saved < opts.Limit {
+		currentLimit := pageSize
+		if opts.Limit > 0 && opts.Limit-saved < pageSize {
+			currentLimit = opts.Limit - saved
+		}
+
+		result, err := s.client.MessagesSearchGlobal(ctx, &tg.MessagesSearchGlobalRequest{
+			Q:          opts.Query,
+			Filter:     filter,
+			MinDate:    minDate,
+			MaxDate:    maxDate,
+			OffsetRate: offsetRate,
+			OffsetPeer: offsetPeer,
+			OffsetID:   offsetID,
+			Limit:      currentLimit,
+		})
+		if err != nil {
+			return saved, fmt.Errorf("全局搜索失败 (offset: %d): %w", offsetID, err)
+		}
+		modified, ok := result.AsModified()
+		if !ok {
+			return saved, fmt.Errorf("无效的搜索响应类型: %T", result)
+		}
+		discovered += s.registerChannels(modified.GetChats())
+		s.senders.remember(modified.GetUsers(), modified.GetChats())
+		msgs := modified.GetMessages()
+		if len(msgs) == 0 {
+			break
+		}
+
+		for _, msg := range msgs {
+			message, ok := msg.(*tg.Message)
+			if !ok || (maxDate > 0 && message.Date >= maxDate) {
+				continue
+			}
+			channel, ok := s.postChannel(message)
+			if !ok {
+				continue
+			}
+			if err := s.saveSearchHit(ctx, msg, channel.ID, opts.Query); err != nil {
+				log.Printf("保存频道 %s 的搜索结果 %d 失败: %v", channel.Title, message.ID, err)
+				continue
+			}
+			saved++
+		}
+		log.Printf("已保存 %d 条搜索结果，新发现 %d 个频道", saved, discovered)
+
+		// messages.messages 已包含全部结果，只有 messagesSlice 需要继续翻页
+		slice, ok := result.(*tg.MessagesMessagesSlice)
+		if !ok || len(msgs) < currentLimit {
+			break
+		}
+		last, ok := msgs[len(msgs)-1].AsNotEmpty()
+		if !ok {
+			break
+		}
+		if offsetPeer, ok = s.peers.dialogInputPeer(last.GetPeerID(), modified.GetUsers()); !ok {
+			log.Printf("无法构造下一页的偏移，停止翻页")
+			break
+		}
+		if nextRate, ok := slice.GetNextRate(); ok {
+			offsetRate = nextRate
+		}
+		offsetID = last.GetID()
+
+		select {
+		case <-ctx.Done():
+			return saved, ctx.Err()
+		case <-time.After(s.delay):
+		}
+	}
+
+	log.Printf("全局搜索 \"%s\" 完成，共保存 %d 条消息，新发现 %d 个频道", opts.Query, saved, discovered)
+	s.logWaitSummary()
+	return saved, nil
+}
+
+// registerChannels 保存搜索结果中的频道，返回其中之前没有保存过的广播频道数量
+func (s *Scraper) registerChannels(chats []tg.ChatClass) int {
+	discovered := 0
+	for _, chat := range chats {
+		channel, ok := chat.(*tg.Channel)
+		if !ok || !channel.Broadcast {
+			continue
+		}
+		if _, err := s.db.GetChannelByTelegramID(channel.ID); err == nil {
+			continue
+		}
+		if channel.Username != "" {
+			log.Printf("发现新频道: %s (@%s)", channel.Title, channel.Username)
+		} else {
+			log.Printf("发现新频道: %s (ID: %d)", channel.Title, channel.ID)
+		}
+		discovered++
+	}
+	s.peers.remember(chats)
+	return discovered
+}
+
+// postChannel 返回帖子所在的广播频道，不是频道帖子时返回 false
+func (s *Scraper) postChannel(message *tg.Message) (*models.Channel, bool) {
+	peer, ok := message.PeerID.(*tg.PeerChannel)
+	if !ok {
+		return nil, false
+	}
+	channel, err := s.db.GetChannelByTelegramID(peer.ChannelID)
+	if err != nil || channel.IsGroup() {
+		return nil, false
+	}
+	return channel, true
+}
+
+// savedSearchCheckInterval serve 检查保存的全局搜索是否到期的间隔
+const savedSearchCheckInterval = time.Minute
+
+// savedSearchInterval 保存的全局搜索重新执行的间隔
+func (s *Scraper) savedSearchInterval() time.Duration {
+	if s.config.SavedSearchInterval <= 0 {
+		return time.Hour // 默认值
+	}
+	return time.Duration(s.config.SavedSearchInterval) * time.Second
+}
+
+// SaveSearch 保存全局搜索，未指定首次执行的开始时间时使用 saved_search_interval 之前
+func (s *Scraper) SaveSearch(search *models.SavedSearch) error {
+	if search.FirstRunSince == nil {
+		since := time.Now().Add(-s.savedSearchInterval())
+		search.FirstRunSince = &since
+	}
+	if err := s.db.SaveSavedSearch(search); err != nil {
+		return fmt.Errorf("保存搜索失败: %w", err)
+	}
+	return nil
+}
+
+// RunSavedSearch 执行一次保存的全局搜索，成功后记录执行时间
+//
+// 首次执行按保存时记录的开始时间和数量限定范围，避免遍历整个全局索引；
+// 执行过的搜索只查找上次执行之后发布的帖子。
+func (s *Scraper) RunSavedSearch(ctx context.Context, search *models.SavedSearch) (int, error) {
+	startedAt := time.Now()
+	opts := SearchOptions{Query: search.Query, Filter: search.Filter}
+	switch {
+	case search.LastRunAt != nil:
+		opts.Since = *search.LastRunAt
+	case search.FirstRunSince != nil:
+		opts.Since = *search.FirstRunSince
+		opts.Limit = search.FirstRunLimit
+	default:
+		opts.Since = startedAt.Add(-s.savedSearchInterval())
+		opts.Limit = search.FirstRunLimit
+	}
+	saved, err := s.SearchGlobal(ctx, opts)
+	if err != nil {
+		return saved, err
+	}
+	if err := s.db.MarkSavedSearchRun(search.ID, startedAt); err != nil {
+		return saved, err
+	}
+	search.LastRunAt = &startedAt
+	return saved, nil
+}
+
+// runDueSavedSearches 执行所有已超过 saved_search_interval 的保存的全局搜索
+func (s *Scraper) runDueSavedSearches(ctx context.Context) {
+	searches, err := s.db.GetSavedSearches()
+	if err != nil {
+		log.Printf("获取保存的搜索失败: %v", err)
+		return
+	}
+	for _, search := range searches {
+		if ctx.Err() != nil {
+			return
+		}
+		if search.LastRunAt != nil && time.Since(*search.LastRunAt) < s.savedSearchInterval() {
+			continue
+		}
+		if _, err := s.RunSavedSearch(ctx, search); err != nil {
+			log.Printf("执行保存的搜索 \"%s\" 失败: %v", search.Query, err)
+		}
+	}
+}
+
+// watchSavedSearches 在 serve 运行期间定期执行到期的保存的全局搜索
+//
+// 每分钟检查一次，serve 运行期间新保存的搜索也会被执行。
+func (s *Scraper) watchSavedSearches(ctx context.Context) {
+	ticker := time.NewTicker(savedSearchCheckInterval)
+	defer ticker.Stop()
+	for {
+		s.runDueSavedSearches(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package scraper
+
+import (
+	"log"
+	"sync"
+
+	"github.com/gotd/td/tg"
+	"github.com/momaek/tgchannel/internal/database"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// senderKey 发送者在缓存中的键
+type senderKey struct {
+	peerType   string
+	telegramID int64
+}
+
+// senderCache 消息发送者名称缓存
+//
+// 消息只携带发送者的 peer，名称在同一响应的 Users / Chats 中。
+// 每次收到响应时先调用 remember 记下其中的用户和频道，构建消息时再用 resolve 解析名称。
+// 用户名称会写入 senders 表，更新等不附带用户信息的响应也能解析出之前见过的发送者。
+type senderCache struct {
+	db *database.Database
+
+	mu     sync.RWMutex
+	saved  map[senderKey]models.Sender // 已写入 senders 表的发送者
+	titles map[int64]string            // 响应中见过的频道 telegram_id -> 标题
+}
+
+// newSenderCache 创建发送者缓存
+func newSenderCache(db *database.Database) *senderCache {
+	return &senderCache{
+		db:     db,
+		saved:  make(map[senderKey]models.Sender),
+		titles: make(map[int64]string),
+	}
+}
+
+// remember 记录 API 响应中携带的用户和频道
+//
+// 用户立即写入 senders 表，名称和用户名都没有变化时不重复写入；
+// 频道只记录标题，真正作为发送者出现时才写入。
+func (c *senderCache) remember(users []tg.UserClass, chats []tg.ChatClass) {
+	for _, u := range users {
+		user, ok := u.(*tg.User)
+		if !ok {
+			continue
+		}
+		c.save(models.Sender{
+			PeerType:   models.SenderUser,
+			TelegramID: user.ID,
+			Name:       userDisplayName(user),
+			Username:   user.Username,
+		})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, chat := range chats {
+		if channel, ok := chat.(*tg.Channel); ok {
+			c.titles[channel.ID] = channel.Title
+		}
+	}
+}
+
+// save 将发送者写入 senders 表，与上次写入的内容相同时跳过
+func (c *senderCache) save(sender models.Sender) {
+	key := senderKey{sender.PeerType, sender.TelegramID}
+	c.mu.RLock()
+	cached, ok := c.saved[key]
+	c.mu.RUnlock()
+	if ok && cached.Name == sender.Name && cached.Username == sender.Username {
+		return
+	}
+
+	if err := c.db.SaveSender(&sender); err != nil {
+		log.Printf("保存发送者 %s %d 失败: %v", sender.PeerType, sender.TelegramID, err)
+		return
+	}
+	c.mu.Lock()
+	c.saved[key] = sender
+	c.mu.Unlock()
+}
+
+// lookup 依次从内存和 senders 表中查找发送者名称
+func (c *senderCache) lookup(peerType string, telegramID int64) string {
+	key := senderKey{peerType, telegramID}
+	c.mu.RLock()
+	cached, ok := c.saved[key]
+	c.mu.RUnlock()
+	if ok {
+		return cached.Name
+	}
+
+	sender, err := c.db.GetSender(peerType, telegramID)
+	if err != nil {
+		return ""
+	}
+	c.mu.Lock()
+	c.saved[key] = *sender
+	c.mu.Unlock()
+	return sender.Name
+}
+
+// resolve 解析消息发送者的类型、ID 和名称，名称未知时为空
+//
+// 以频道身份发言（包括匿名管理员）的发送者，标题优先取响应中的频道，
+// 其次是 channels 表中保存的频道。
+func (c *senderCache) resolve(peer tg.PeerClass) (string, int64, string) {
+	switch p := peer.(type) {
+	case *tg.PeerUser:
+		return models.SenderUser, p.UserID, c.lookup(models.SenderUser, p.UserID)
+	case *tg.PeerChannel:
+		c.mu.RLock()
+		title, ok := c.titles[p.ChannelID]
+		c.mu.RUnlock()
+		if !ok {
+			if channel, err := c.db.GetChannelByTelegramID(p.ChannelID); err == nil {
+				title = channel.Title
+			}
+		}
+		if title == "" {
+			return models.SenderChannel, p.ChannelID, c.lookup(models.SenderChannel, p.ChannelID)
+		}
+		c.save(models.Sender{PeerType: models.SenderChannel, TelegramID: p.ChannelID, Name: title})
+		return models.SenderChannel, p.ChannelID, title
+	case *tg.PeerChat:
+		return models.SenderChat, p.ChatID, c.lookup(models.SenderChat, p.ChatID)
+	}
+	return "", 0, ""
+}
@@ -0,0 +1,60 @@
+package scraper
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+const (
+	// snapshotPostDays 计算平均每天帖子数的天数
+	snapshotPostDays = 7
+	// snapshotRecentPosts 计算平均浏览数的最近消息数量
+	snapshotRecentPosts = 50
+)
+
+// snapshotInterval 频道统计快照的间隔
+func (s *Scraper) snapshotInterval() time.Duration {
+	if s.config.SnapshotInterval <= 0 {
+		return time.Hour // 默认值
+	}
+	return time.Duration(s.config.SnapshotInterval) * time.Second
+}
+
+// snapshotDue 距离上一次快照是否已超过快照间隔
+func (s *Scraper) snapshotDue(channel *models.Channel) bool {
+	snapshots, err := s.db.GetChannelSnapshots(channel.ID, time.Now().Add(-s.snapshotInterval()))
+	return err == nil && len(snapshots) == 0
+}
+
+// takeSnapshot 记录频道的成员数、在线人数、发帖频率和平均浏览数
+//
+// 成员数和在线人数来自 channels.getFullChannel，同时会刷新频道的完整信息；
+// 发帖频率和平均浏览数根据数据库中已保存的消息计算。
+func (s *Scraper) takeSnapshot(ctx context.Context, channel *models.Channel) error {
+	profile, online, err := s.fetchFullChannel(ctx, channel)
+	if err != nil {
+		return err
+	}
+
+	postsPerDay, avgViews, err := s.db.GetChannelPostStats(channel.ID, snapshotPostDays, snapshotRecentPosts)
+	if err != nil {
+		return err
+	}
+
+	snapshot := &models.ChannelSnapshot{
+		ChannelID:   channel.ID,
+		MemberCount: profile.MemberCount,
+		OnlineCount: online,
+		PostsPerDay: postsPerDay,
+		AvgViews:    avgViews,
+	}
+	if err := s.db.CreateChannelSnapshot(snapshot); err != nil {
+		return err
+	}
+	log.Printf("频道 %s 的统计快照: 成员 %d，在线 %d，每天 %.1f 条帖子，平均浏览 %.0f",
+		channel.Title, snapshot.MemberCount, snapshot.OnlineCount, snapshot.PostsPerDay, snapshot.AvgViews)
+	return nil
+}
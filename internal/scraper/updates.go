@@ -0,0 +1,324 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// liveChannel 实时监听中的频道状态
+type liveChannel struct {
+	channel *models.Channel
+
+	// applyMu 保证推送更新和补齐差异按顺序写入
+	//
+	// gotd 在各自的协程中处理收到的更新，同一频道的更新需要持有该锁完成校验、写入和保存 pts，
+	// 否则后到达的更新可能先推进 lastMessageID 和 pts，导致前一条更新被跳过或在重启后丢失。
+	applyMu sync.Mutex
+
+	mu            sync.Mutex
+	lastMessageID int64
+	pts           int
+	lastUpdate    time.Time // 最近一次收到推送更新的时间
+
+	// catchUp 检测到 pts 缺口时通知监控协程补齐差异
+	catchUp chan struct{}
+}
+
+// advance 推进已处理的最新消息 ID
+func (l *liveChannel) advance(messageID int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if messageID > l.lastMessageID {
+		l.lastMessageID = messageID
+	}
+}
+
+// touch 记录收到推送更新
+func (l *liveChannel) touch() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastUpdate = time.Now()
+}
+
+// snapshot 返回最新消息 ID 和最近一次推送时间
+func (l *liveChannel) snapshot() (int64, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastMessageID, l.lastUpdate
+}
+
+// currentPts 返回已处理到的 pts
+func (l *liveChannel) currentPts() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pts
+}
+
+// requestCatchUp 请求监控协程补齐差异，已有未处理的请求时忽略
+func (l *liveChannel) requestCatchUp() {
+	select {
+	case l.catchUp <- struct{}{}:
+	default:
+	}
+}
+
+// ptsCheck pts 校验结果
+type ptsCheck int
+
+const (
+	ptsApply     ptsCheck = iota // 顺序正确，直接应用
+	ptsDuplicate                 // 已经处理过
+	ptsGap                       // 中间有缺失的更新
+)
+
+// checkPts 按照 Telegram 的 pts 规则校验一条更新
+func (l *liveChannel) checkPts(pts, ptsCount int) ptsCheck {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// 还没有保存过状态，无法判断缺口，直接应用
+	if l.pts == 0 {
+		return ptsApply
+	}
+	switch expected := l.pts + ptsCount; {
+	case pts == expected:
+		return ptsApply
+	case pts <= l.pts:
+		return ptsDuplicate
+	default:
+		return ptsGap
+	}
+}
+
+// watch 将频道加入实时监听列表
+func (s *Scraper) watch(channel *models.Channel, lastMessageID int64, pts int) *liveChannel {
+	live := &liveChannel{
+		channel:       channel,
+		lastMessageID: lastMessageID,
+		pts:           pts,
+		catchUp:       make(chan struct{}, 1),
+	}
+
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+	s.live[channel.TelegramID] = live
+	return live
+}
+
+// unwatch 将频道移出实时监听列表
+//
+// 只有登记的仍是同一个监听实例时才移除，避免误删重新订阅后启动的新监控。
+func (s *Scraper) unwatch(live *liveChannel) {
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+	if s.live[live.channel.TelegramID] == live {
+		delete(s.live, live.channel.TelegramID)
+	}
+}
+
+// watching 获取实时监听中的频道
+func (s *Scraper) watching(telegramID int64) (*liveChannel, bool) {
+	s.liveMu.RLock()
+	defer s.liveMu.RUnlock()
+	live, ok := s.live[telegramID]
+	return live, ok
+}
+
+// RegisterUpdateHandlers 在 dispatcher 上注册频道消息的推送处理
+//
+// dispatcher 需要在创建 telegram.Client 时作为 UpdateHandler 传入。
+func (s *Scraper) RegisterUpdateHandlers(d tg.UpdateDispatcher) {
+	d.OnNewChannelMessage(func(ctx context.Context, e tg.Entities, u *tg.UpdateNewChannelMessage) error {
+		s.peers.remember(entityChats(e))
+		s.senders.remember(entityUsers(e), entityChats(e))
+		s.handleChannelUpdate(ctx, messageChannelID(u.Message), u, u.Pts, u.PtsCount)
+		return nil
+	})
+	d.OnEditChannelMessage(func(ctx context.Context, e tg.Entities, u *tg.UpdateEditChannelMessage) error {
+		s.peers.remember(entityChats(e))
+		s.senders.remember(entityUsers(e), entityChats(e))
+		s.handleChannelUpdate(ctx, messageChannelID(u.Message), u, u.Pts, u.PtsCount)
+		return nil
+	})
+	d.OnDeleteChannelMessages(func(ctx context.Context, e tg.Entities, u *tg.UpdateDeleteChannelMessages) error {
+		s.handleChannelUpdate(ctx, u.ChannelID, u, u.Pts, u.PtsCount)
+		return nil
+	})
+	d.OnMessageReactions(func(ctx context.Context, e tg.Entities, u *tg.UpdateMessageReactions) error {
+		s.handleReactions(u)
+		return nil
+	})
+	d.OnMessagePoll(func(ctx context.Context, e tg.Entities, u *tg.UpdateMessagePoll) error {
+		s.handlePollUpdate(u)
+		return nil
+	})
+	d.OnChannelTooLong(func(ctx context.Context, e tg.Entities, u *tg.UpdateChannelTooLong) error {
+		if live, ok := s.watching(u.ChannelID); ok {
+			live.requestCatchUp()
+		}
+		return nil
+	})
+}
+
+// handleChannelUpdate 校验推送更新的 pts 并应用到数据库
+//
+// 只有成功写入的更新才会推进 pts，写入失败时请求补齐，由 updates.getChannelDifference 重新获取。
+func (s *Scraper) handleChannelUpdate(ctx context.Context, telegramID int64, update tg.UpdateClass, pts, ptsCount int) {
+	// 只处理正在监听的频道
+	live, ok := s.watching(telegramID)
+	if !ok {
+		return
+	}
+	live.touch()
+
+	live.applyMu.Lock()
+	defer live.applyMu.Unlock()
+
+	switch live.checkPts(pts, ptsCount) {
+	case ptsDuplicate:
+		return
+	case ptsGap:
+		log.Printf("频道 %s 的更新存在缺口 (pts: %d)，开始补齐", live.channel.Title, pts)
+		live.requestCatchUp()
+		return
+	}
+
+	if err := s.applyUpdate(ctx, live, update); err != nil {
+		log.Printf("频道 %s 的更新写入失败 (pts: %d)，稍后补齐: %v", live.channel.Title, pts, err)
+		live.requestCatchUp()
+		return
+	}
+	s.savePts(live, pts)
+}
+
+// applyUpdate 将一条频道更新写入数据库
+func (s *Scraper) applyUpdate(ctx context.Context, live *liveChannel, update tg.UpdateClass) error {
+	switch u := update.(type) {
+	case *tg.UpdateNewChannelMessage:
+		return s.applyNewMessage(ctx, live, u.Message)
+	case *tg.UpdateEditChannelMessage:
+		message, ok := u.Message.(*tg.Message)
+		if !ok {
+			return nil
+		}
+		if err := s.refreshMessage(ctx, message, live.channel.ID); err != nil {
+			return fmt.Errorf("处理编辑消息失败: %w", err)
+		}
+		log.Printf("频道 %s 的消息 %d 被编辑", live.channel.Title, message.ID)
+	case *tg.UpdateDeleteChannelMessages:
+		ids := make([]int64, 0, len(u.Messages))
+		for _, id := range u.Messages {
+			ids = append(ids, int64(id))
+		}
+		marked, err := s.db.MarkMessagesDeleted(live.channel.ID, ids)
+		if err != nil {
+			return fmt.Errorf("标记删除消息失败: %w", err)
+		}
+		log.Printf("频道 %s 删除了 %d 条消息，本地已标记 %d 条", live.channel.Title, len(ids), marked)
+	}
+	return nil
+}
+
+// handleReactions 记录推送的回应变化
+//
+// 回应更新不携带 pts，不参与缺口检测，只处理已保存的消息。
+func (s *Scraper) handleReactions(u *tg.UpdateMessageReactions) {
+	peer, ok := u.Peer.(*tg.PeerChannel)
+	if !ok {
+		return
+	}
+	live, ok := s.watching(peer.ChannelID)
+	if !ok {
+		return
+	}
+
+	message, err := s.db.GetMessageByTelegramID(live.channel.ID, int64(u.MsgID))
+	if err != nil {
+		return
+	}
+	if _, err := s.db.SaveReactionSnapshot(message.ID, convertReactions(u.Reactions)); err != nil {
+		log.Printf("记录消息 %d 的回应失败: %v", u.MsgID, err)
+	}
+}
+
+// applyNewMessage 保存一条新消息，已处理过的消息会被跳过
+func (s *Scraper) applyNewMessage(ctx context.Context, live *liveChannel, msg tg.MessageClass) error {
+	if service, ok := msg.(*tg.MessageService); ok {
+		// 群组的成员变动
+		if err := s.saveServiceMessage(service, live.channel.ID); err != nil {
+			return fmt.Errorf("处理服务消息失败: %w", err)
+		}
+		return nil
+	}
+	message, ok := msg.(*tg.Message)
+	if !ok {
+		return nil
+	}
+	if lastMessageID, _ := live.snapshot(); int64(message.ID) <= lastMessageID {
+		return nil
+	}
+
+	if err := s.processMessage(ctx, message, live.channel.ID); err != nil {
+		return fmt.Errorf("处理新消息失败: %w", err)
+	}
+	live.advance(int64(message.ID))
+	log.Printf("收到新消息: %s", logPreview(message.Message))
+	return nil
+}
+
+// savePts 更新内存和数据库中的 pts
+func (s *Scraper) savePts(live *liveChannel, pts int) {
+	live.mu.Lock()
+	if pts <= live.pts {
+		live.mu.Unlock()
+		return
+	}
+	live.pts = pts
+	live.mu.Unlock()
+
+	state := &models.ChannelState{ChannelID: live.channel.ID, Pts: pts}
+	if err := s.db.SaveChannelState(state); err != nil {
+		log.Printf("保存频道 %s 的更新状态失败: %v", live.channel.Title, err)
+	}
+}
+
+// messageChannelID 返回消息所属频道的 Telegram ID
+func messageChannelID(msg tg.MessageClass) int64 {
+	var peer tg.PeerClass
+	switch m := msg.(type) {
+	case *tg.Message:
+		peer = m.PeerID
+	case *tg.MessageService:
+		peer = m.PeerID
+	default:
+		return 0
+	}
+	if channel, ok := peer.(*tg.PeerChannel); ok {
+		return channel.ChannelID
+	}
+	return 0
+}
+
+// entityUsers 将更新附带的用户实体转换为 UserClass 列表
+func entityUsers(e tg.Entities) []tg.UserClass {
+	users := make([]tg.UserClass, 0, len(e.Users))
+	for _, user := range e.Users {
+		users = append(users, user)
+	}
+	return users
+}
+
+// entityChats 将更新附带的频道实体转换为 ChatClass 列表
+func entityChats(e tg.Entities) []tg.ChatClass {
+	chats := make([]tg.ChatClass, 0, len(e.Channels))
+	for _, channel := range e.Channels {
+		chats = append(chats, channel)
+	}
+	return chats
+}
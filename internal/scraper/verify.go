@@ -0,0 +1,123 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/momaek/tgchannel/internal/models"
+)
+
+// verifyBatchSize channels.getMessages 每次查询的消息数量
+const verifyBatchSize = 100
+
+// verifyInterval 删除校验的间隔
+func (s *Scraper) verifyInterval() time.Duration {
+	if s.config.VerifyInterval <= 0 {
+		return 6 * time.Hour // 默认值
+	}
+	return time.Duration(s.config.VerifyInterval) * time.Second
+}
+
+// verifyRecentMessages 每次删除校验检查的最新消息数量
+func (s *Scraper) verifyRecentMessages() int {
+	if s.config.VerifyRecentMessages <= 0 {
+		return 1000 // 默认值
+	}
+	return s.config.VerifyRecentMessages
+}
+
+// verifyDeletedMessages 通过 channels.getMessages 重新检查已保存的最新消息，
+// 将频道中已不存在的消息标记为已删除，同时更新评论数、回应快照并抓取新评论
+//
+// 推送更新可能在停机或断线期间丢失，补齐差异也无法覆盖过早的删除，
+// 定期校验可以发现这些被悄悄删除的消息。
+func (s *Scraper) verifyDeletedMessages(ctx context.Context, channel *models.Channel) error {
+	resolved, err := s.peers.resolveID(ctx, channel.TelegramID)
+	if err != nil {
+		return fmt.Errorf("解析频道失败: %w", err)
+	}
+
+	ids, err := s.db.GetRecentMessageIDs(channel.ID, s.verifyRecentMessages())
+	if err != nil {
+		return err
+	}
+
+	var marked int64
+	for start := 0; start < len(ids); start += verifyBatchSize {
+		if start > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.delay):
+			}
+		}
+
+		batch := ids[start:min(start+verifyBatchSize, len(ids))]
+		inputs := make([]tg.InputMessageClass, 0, len(batch))
+		for _, id := range batch {
+			inputs = append(inputs, &tg.InputMessageID{ID: int(id)})
+		}
+
+		result, err := s.client.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
+			Channel: inputChannel(resolved),
+			ID:      inputs,
+		})
+		if err != nil {
+			return fmt.Errorf("获取消息失败: %w", err)
+		}
+		modified, ok := result.AsModified()
+		if !ok {
+			return fmt.Errorf("无效的消息响应类型: %T", result)
+		}
+		s.senders.remember(modified.GetUsers(), modified.GetChats())
+
+		// 已删除的消息以 messageEmpty 返回
+		var deleted []int64
+		for _, msg := range modified.GetMessages() {
+			switch m := msg.(type) {
+			case *tg.MessageEmpty:
+				deleted = append(deleted, int64(m.ID))
+			case *tg.Message:
+				s.refreshEngagement(ctx, resolved, m)
+			}
+		}
+
+		n, err := s.db.MarkMessagesDeleted(channel.ID, deleted)
+		if err != nil {
+			return err
+		}
+		marked += n
+	}
+
+	if marked > 0 {
+		log.Printf("频道 %s 的删除校验完成，检查 %d 条消息，新发现 %d 条已删除", channel.Title, len(ids), marked)
+	}
+	return nil
+}
+
+// refreshEngagement 更新帖子的评论数、回应快照和投票结果，开启评论抓取时抓取新评论
+func (s *Scraper) refreshEngagement(ctx context.Context, channel *models.Channel, message *tg.Message) {
+	post, err := s.db.GetMessageByTelegramID(channel.ID, int64(message.ID))
+	if err != nil {
+		return
+	}
+	s.saveReactions(message, post)
+	s.savePoll(message, post)
+
+	replies, ok := message.GetReplies()
+	if !ok {
+		return
+	}
+	if err := s.db.UpdateMessageReplies(post.ID, int32(replies.Replies)); err != nil {
+		log.Printf("更新消息 %d 的评论数失败: %v", message.ID, err)
+	}
+
+	if s.config.Comments {
+		if err := s.fetchComments(ctx, channel, message); err != nil {
+			log.Printf("抓取消息 %d 的评论失败: %v", message.ID, err)
+		}
+	}
+}
@@ -0,0 +1,706 @@
+// Package tgfake 提供用于测试的 Telegram 后端
+//
+// Backend 实现 tg.Invoker，在内存中保存频道和消息，按 Telegram 的分页规则
+// 返回历史消息，并可以为指定方法预设 FLOOD_WAIT 或其他错误。
+// 只实现了爬虫用到的方法，其他方法返回 METHOD_NOT_SUPPORTED。
+package tgfake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// Channel 后端中的频道
+type Channel struct {
+	ID         int64
+	AccessHash int64
+	Username   string
+	Title      string
+	About      string
+	Members    int
+	Date       int  // 创建时间
+	Left       bool // 账号未加入频道，只能通过邀请链接加入后访问
+	Peek       bool // 未加入时邀请链接返回可以临时预览的 chatInvitePeek
+	Megagroup  bool // 超级群组，否则为广播频道
+	Pts        int  // channels.getFullChannel 返回的当前 pts
+
+	// Participants channels.getParticipants 返回的成员，按顺序分页
+	Participants []tg.ChannelParticipantClass
+
+	messages map[int]tg.MessageClass
+	comments map[int][]*tg.Message // 帖子 ID -> 讨论组中的评论
+
+	// differences updates.getChannelDifference 依次返回的差异，用完后返回没有差异
+	differences []tg.UpdatesChannelDifferenceClass
+}
+
+// Backend 内存中的 Telegram 后端
+type Backend struct {
+	mu       sync.Mutex
+	channels map[int64]*Channel
+	users    map[int64]*tg.User
+	invites  map[string]int64         // 邀请链接 hash -> 频道 ID
+	failures map[string][]error       // 方法名 -> 依次返回的错误
+	requests map[string][]any         // 方法名 -> 收到的请求
+	holds    map[string]chan struct{} // 方法名 -> 放行前阻塞调用
+}
+
+// New 创建空的后端
+func New() *Backend {
+	return &Backend{
+		channels: make(map[int64]*Channel),
+		users:    make(map[int64]*tg.User),
+		invites:  make(map[string]int64),
+		failures: make(map[string][]error),
+		requests: make(map[string][]any),
+		holds:    make(map[string]chan struct{}),
+	}
+}
+
+// AddChannel 添加频道
+func (b *Backend) AddChannel(id, accessHash int64, username, title string) *Channel {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	channel := &Channel{
+		ID:         id,
+		AccessHash: accessHash,
+		Username:   username,
+		Title:      title,
+		messages:   make(map[int]tg.MessageClass),
+		comments:   make(map[int][]*tg.Message),
+	}
+	b.channels[id] = channel
+	return channel
+}
+
+// Channel 返回已添加的频道，修改其字段前不应有并发请求
+func (b *Backend) Channel(id int64) *Channel {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.channels[id]
+}
+
+// AddInvite 为频道添加邀请链接
+func (b *Backend) AddInvite(hash string, channelID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.invites[hash] = channelID
+}
+
+// SetUser 添加或替换用户，历史消息响应中会附带所有用户
+func (b *Backend) SetUser(id int64, firstName, lastName, username string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.users[id] = &tg.User{
+		ID:        id,
+		FirstName: firstName,
+		LastName:  lastName,
+		Username:  username,
+	}
+	b.users[id].SetFlags()
+}
+
+// AddMessage 向频道添加消息，PeerID 会被设置为该频道
+func (b *Backend) AddMessage(channelID int64, message *tg.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	message.PeerID = &tg.PeerChannel{ChannelID: channelID}
+	b.channels[channelID].messages[message.ID] = message
+}
+
+// AddServiceMessage 向频道添加服务消息，PeerID 会被设置为该频道
+func (b *Backend) AddServiceMessage(channelID int64, message *tg.MessageService) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	message.PeerID = &tg.PeerChannel{ChannelID: channelID}
+	b.channels[channelID].messages[message.ID] = message
+}
+
+// AddComment 为频道中的帖子添加评论，messages.getReplies 按评论 ID 从新到旧返回
+func (b *Backend) AddComment(channelID int64, postID int, comment *tg.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	channel := b.channels[channelID]
+	channel.comments[postID] = append(channel.comments[postID], comment)
+}
+
+// AddChannelDifference 预设频道的 updates.getChannelDifference 响应，按添加顺序依次返回
+//
+// 预设的响应用完后返回 updates.channelDifferenceEmpty，pts 为频道的 Pts。
+func (b *Backend) AddChannelDifference(channelID int64, diffs ...tg.UpdatesChannelDifferenceClass) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	channel := b.channels[channelID]
+	channel.differences = append(channel.differences, diffs...)
+}
+
+// DeleteMessage 从频道中删除消息
+func (b *Backend) DeleteMessage(channelID int64, id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.channels[channelID].messages, id)
+}
+
+// Fail 为方法预设错误，之后对该方法的调用依次返回这些错误，用完后恢复正常
+//
+// method 为 TL 方法名，例如 "messages.getHistory"。
+func (b *Backend) Fail(method string, errs ...error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures[method] = append(b.failures[method], errs...)
+}
+
+// Hold 阻塞之后对方法的调用，直到调用返回的 release 放行
+//
+// 请求在阻塞之前就会被记录，可以通过 Requests 判断调用是否已经到达。
+func (b *Backend) Hold(method string) (release func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	hold := make(chan struct{})
+	b.holds[method] = hold
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.holds[method] == hold {
+			delete(b.holds, method)
+			close(hold)
+		}
+	}
+}
+
+// FloodWait 构造 FLOOD_WAIT_X 错误
+func FloodWait(seconds int) error {
+	return tgerr.New(420, fmt.Sprintf("FLOOD_WAIT_%d", seconds))
+}
+
+// Requests 返回方法收到的所有请求，包括返回了预设错误的请求
+func (b *Backend) Requests(method string) []any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]any(nil), b.requests[method]...)
+}
+
+// HistoryRequests 返回收到的所有 messages.getHistory 请求
+func (b *Backend) HistoryRequests() []*tg.MessagesGetHistoryRequest {
+	var result []*tg.MessagesGetHistoryRequest
+	for _, r := range b.Requests("messages.getHistory") {
+		result = append(result, r.(*tg.MessagesGetHistoryRequest))
+	}
+	return result
+}
+
+// Invoke 实现 tg.Invoker
+func (b *Backend) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	method := methodName(input)
+
+	b.mu.Lock()
+	b.requests[method] = append(b.requests[method], input)
+	if hold, ok := b.holds[method]; ok {
+		b.mu.Unlock()
+		select {
+		case <-hold:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		b.mu.Lock()
+	}
+	if errs := b.failures[method]; len(errs) > 0 {
+		b.failures[method] = errs[1:]
+		b.mu.Unlock()
+		return errs[0]
+	}
+	result, err := b.handle(input)
+	b.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// 与真实连接一样经过序列化，保证响应能被正确解码
+	var buf bin.Buffer
+	if err := result.Encode(&buf); err != nil {
+		return fmt.Errorf("encode %s response: %w", method, err)
+	}
+	return output.Decode(&buf)
+}
+
+// handle 处理请求，调用时需持有锁
+func (b *Backend) handle(input bin.Encoder) (bin.Encoder, error) {
+	switch r := input.(type) {
+	case *tg.MessagesGetHistoryRequest:
+		return b.getHistory(r)
+	case *tg.ChannelsGetMessagesRequest:
+		return b.getMessages(r)
+	case *tg.ContactsResolveUsernameRequest:
+		return b.resolveUsername(r.Username)
+	case *tg.ChannelsGetFullChannelRequest:
+		return b.getFullChannel(r.Channel)
+	case *tg.MessagesGetDialogsRequest:
+		return b.getDialogs(), nil
+	case *tg.MessagesCheckChatInviteRequest:
+		return b.checkChatInvite(r.Hash)
+	case *tg.MessagesImportChatInviteRequest:
+		return b.importChatInvite(r.Hash)
+	case *tg.ChannelsGetParticipantsRequest:
+		return b.getParticipants(r)
+	case *tg.MessagesSearchRequest:
+		return b.search(r)
+	case *tg.MessagesSearchGlobalRequest:
+		return b.searchGlobal(r)
+	case *tg.MessagesGetRepliesRequest:
+		return b.getReplies(r)
+	case *tg.UpdatesGetChannelDifferenceRequest:
+		return b.getChannelDifference(r)
+	}
+	return nil, tgerr.New(400, "METHOD_NOT_SUPPORTED")
+}
+
+// channelByPeer 查找频道并校验 access hash，未加入的频道返回 CHANNEL_PRIVATE
+func (b *Backend) channelByPeer(id, accessHash int64) (*Channel, error) {
+	channel, ok := b.channels[id]
+	if !ok || channel.AccessHash != accessHash {
+		return nil, tgerr.New(400, "CHANNEL_INVALID")
+	}
+	if channel.Left {
+		return nil, tgerr.New(400, "CHANNEL_PRIVATE")
+	}
+	return channel, nil
+}
+
+// getHistory 按 offset_id、offset_date、add_offset、limit、max_id 和 min_id 返回一页消息，从新到旧排列
+func (b *Backend) getHistory(r *tg.MessagesGetHistoryRequest) (bin.Encoder, error) {
+	peer, ok := r.Peer.(*tg.InputPeerChannel)
+	if !ok {
+		return nil, tgerr.New(400, "PEER_ID_INVALID")
+	}
+	channel, err := b.channelByPeer(peer.ChannelID, peer.AccessHash)
+	if err != nil {
+		return nil, err
+	}
+
+	all := channel.sorted()
+	// 定位第一条早于 offset 的消息
+	start := 0
+	for start < len(all) {
+		m := all[start]
+		if (r.OffsetID == 0 || m.GetID() < r.OffsetID) && (r.OffsetDate == 0 || messageDate(m) < r.OffsetDate) {
+			break
+		}
+		start++
+	}
+	start += r.AddOffset
+	if start < 0 {
+		start = 0
+	}
+
+	var page []tg.MessageClass
+	for i := start; i < len(all) && len(page) < r.Limit; i++ {
+		m := all[i]
+		if r.MaxID != 0 && m.GetID() >= r.MaxID {
+			continue
+		}
+		if r.MinID != 0 && m.GetID() <= r.MinID {
+			break
+		}
+		page = append(page, m)
+	}
+
+	return &tg.MessagesChannelMessages{
+		Count:    len(all),
+		Messages: page,
+		Chats:    []tg.ChatClass{channel.chat()},
+		Users:    b.userList(),
+		Topics:   []tg.ForumTopicClass{},
+	}, nil
+}
+
+// getReplies 按 offset_id、limit 和 min_id 返回帖子的一页评论，从新到旧排列
+func (b *Backend) getReplies(r *tg.MessagesGetRepliesRequest) (bin.Encoder, error) {
+	peer, ok := r.Peer.(*tg.InputPeerChannel)
+	if !ok {
+		return nil, tgerr.New(400, "PEER_ID_INVALID")
+	}
+	channel, err := b.channelByPeer(peer.ChannelID, peer.AccessHash)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := channel.messages[r.MsgID]; !ok {
+		return nil, tgerr.New(400, "MSG_ID_INVALID")
+	}
+
+	all := append([]*tg.Message(nil), channel.comments[r.MsgID]...)
+	sort.Slice(all, func(i, j int) bool { return all[i].ID > all[j].ID })
+	var page []tg.MessageClass
+	for _, m := range all {
+		if len(page) >= r.Limit || (r.MinID != 0 && m.ID <= r.MinID) {
+			break
+		}
+		if r.OffsetID != 0 && m.ID >= r.OffsetID {
+			continue
+		}
+		page = append(page, m)
+	}
+
+	return &tg.MessagesChannelMessages{
+		Count:    len(all),
+		Messages: page,
+		Chats:    []tg.ChatClass{channel.chat()},
+		Users:    b.userList(),
+		Topics:   []tg.ForumTopicClass{},
+	}, nil
+}
+
+// search 返回频道中文本包含关键词（不区分大小写）的消息，从新到旧排列
+//
+// 支持 offset_id、limit、min_date、max_date（两端都包含），过滤器只支持不过滤、图片和文件。
+func (b *Backend) search(r *tg.MessagesSearchRequest) (bin.Encoder, error) {
+	peer, ok := r.Peer.(*tg.InputPeerChannel)
+	if !ok {
+		return nil, tgerr.New(400, "PEER_ID_INVALID")
+	}
+	channel, err := b.channelByPeer(peer.ChannelID, peer.AccessHash)
+	if err != nil {
+		return nil, err
+	}
+
+	match := func(m *tg.Message) bool {
+		switch r.Filter.(type) {
+		case *tg.InputMessagesFilterEmpty:
+		case *tg.InputMessagesFilterPhotos:
+			if _, ok := m.Media.(*tg.MessageMediaPhoto); !ok {
+				return false
+			}
+		case *tg.InputMessagesFilterDocument:
+			if _, ok := m.Media.(*tg.MessageMediaDocument); !ok {
+				return false
+			}
+		default:
+			return false
+		}
+		if (r.MinDate != 0 && m.Date < r.MinDate) || (r.MaxDate != 0 && m.Date > r.MaxDate) {
+			return false
+		}
+		return strings.Contains(strings.ToLower(m.Message), strings.ToLower(r.Q))
+	}
+
+	var hits []tg.MessageClass
+	for _, m := range channel.sorted() {
+		if message, ok := m.(*tg.Message); ok && match(message) {
+			hits = append(hits, m)
+		}
+	}
+	var page []tg.MessageClass
+	for _, m := range hits {
+		if len(page) >= r.Limit {
+			break
+		}
+		if r.OffsetID == 0 || m.GetID() < r.OffsetID {
+			page = append(page, m)
+		}
+	}
+
+	return &tg.MessagesChannelMessages{
+		Count:    len(hits),
+		Messages: page,
+		Chats:    []tg.ChatClass{channel.chat()},
+		Users:    b.userList(),
+		Topics:   []tg.ForumTopicClass{},
+	}, nil
+}
+
+// searchGlobal 在所有频道（包括未加入的频道）中搜索文本包含关键词的消息
+//
+// 结果按发送时间、频道 ID、消息 ID 倒序排列，以 messagesSlice 返回，
+// 按 offset_rate（上一页最后一条消息的时间）、offset_peer 和 offset_id 翻页。
+// 支持 min_date、max_date（两端都包含），过滤器只支持不过滤。
+func (b *Backend) searchGlobal(r *tg.MessagesSearchGlobalRequest) (bin.Encoder, error) {
+	if _, ok := r.Filter.(*tg.InputMessagesFilterEmpty); !ok {
+		return nil, tgerr.New(400, "FILTER_NOT_SUPPORTED")
+	}
+
+	type hit struct {
+		channel *Channel
+		message *tg.Message
+	}
+	var hits []hit
+	for _, channel := range b.channels {
+		for _, m := range channel.messages {
+			message, ok := m.(*tg.Message)
+			if !ok || !strings.Contains(strings.ToLower(message.Message), strings.ToLower(r.Q)) {
+				continue
+			}
+			if (r.MinDate != 0 && message.Date < r.MinDate) || (r.MaxDate != 0 && message.Date > r.MaxDate) {
+				continue
+			}
+			hits = append(hits, hit{channel, message})
+		}
+	}
+	// before 判断 a 是否排在 b 前面
+	before := func(aDate int, aChannel int64, aID int, bDate int, bChannel int64, bID int) bool {
+		if aDate != bDate {
+			return aDate > bDate
+		}
+		if aChannel != bChannel {
+			return aChannel > bChannel
+		}
+		return aID > bID
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		return before(hits[i].message.Date, hits[i].channel.ID, hits[i].message.ID,
+			hits[j].message.Date, hits[j].channel.ID, hits[j].message.ID)
+	})
+
+	var offsetChannel int64
+	if peer, ok := r.OffsetPeer.(*tg.InputPeerChannel); ok {
+		offsetChannel = peer.ChannelID
+	}
+	result := &tg.MessagesMessagesSlice{Count: len(hits)}
+	seen := make(map[int64]bool)
+	for _, h := range hits {
+		if len(result.Messages) >= r.Limit {
+			break
+		}
+		if r.OffsetRate != 0 && !before(r.OffsetRate, offsetChannel, r.OffsetID, h.message.Date, h.channel.ID, h.message.ID) {
+			continue
+		}
+		result.Messages = append(result.Messages, h.message)
+		result.SetNextRate(h.message.Date)
+		if !seen[h.channel.ID] {
+			seen[h.channel.ID] = true
+			result.Chats = append(result.Chats, h.channel.chat())
+		}
+	}
+	result.Users = b.userList()
+	return result, nil
+}
+
+// getMessages 按 ID 返回消息，不存在的消息返回 messageEmpty
+func (b *Backend) getMessages(r *tg.ChannelsGetMessagesRequest) (bin.Encoder, error) {
+	input, ok := r.Channel.(*tg.InputChannel)
+	if !ok {
+		return nil, tgerr.New(400, "CHANNEL_INVALID")
+	}
+	channel, err := b.channelByPeer(input.ChannelID, input.AccessHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []tg.MessageClass
+	for _, id := range r.ID {
+		inputID, ok := id.(*tg.InputMessageID)
+		if !ok {
+			continue
+		}
+		if m, ok := channel.messages[inputID.ID]; ok {
+			messages = append(messages, m)
+		} else {
+			messages = append(messages, &tg.MessageEmpty{ID: inputID.ID})
+		}
+	}
+	return &tg.MessagesChannelMessages{
+		Count:    len(messages),
+		Messages: messages,
+		Chats:    []tg.ChatClass{channel.chat()},
+		Users:    b.userList(),
+		Topics:   []tg.ForumTopicClass{},
+	}, nil
+}
+
+// resolveUsername 按用户名查找频道，不区分大小写
+func (b *Backend) resolveUsername(username string) (bin.Encoder, error) {
+	for _, channel := range b.channels {
+		if channel.Username != "" && strings.EqualFold(channel.Username, username) {
+			return &tg.ContactsResolvedPeer{
+				Peer:  &tg.PeerChannel{ChannelID: channel.ID},
+				Chats: []tg.ChatClass{channel.chat()},
+				Users: []tg.UserClass{},
+			}, nil
+		}
+	}
+	return nil, tgerr.New(400, "USERNAME_NOT_OCCUPIED")
+}
+
+// getFullChannel 返回频道的完整信息
+func (b *Backend) getFullChannel(input tg.InputChannelClass) (bin.Encoder, error) {
+	in, ok := input.(*tg.InputChannel)
+	if !ok {
+		return nil, tgerr.New(400, "CHANNEL_INVALID")
+	}
+	channel, err := b.channelByPeer(in.ChannelID, in.AccessHash)
+	if err != nil {
+		return nil, err
+	}
+
+	full := &tg.ChannelFull{
+		ID:        channel.ID,
+		About:     channel.About,
+		ChatPhoto: &tg.PhotoEmpty{},
+		Pts:       channel.Pts,
+	}
+	full.SetParticipantsCount(channel.Members)
+	return &tg.MessagesChatFull{
+		FullChat: full,
+		Chats:    []tg.ChatClass{channel.chat()},
+		Users:    []tg.UserClass{},
+	}, nil
+}
+
+// getChannelDifference 返回下一个预设的频道差异
+func (b *Backend) getChannelDifference(r *tg.UpdatesGetChannelDifferenceRequest) (bin.Encoder, error) {
+	in, ok := r.Channel.(*tg.InputChannel)
+	if !ok {
+		return nil, tgerr.New(400, "CHANNEL_INVALID")
+	}
+	channel, err := b.channelByPeer(in.ChannelID, in.AccessHash)
+	if err != nil {
+		return nil, err
+	}
+	if r.Pts <= 0 {
+		return nil, tgerr.New(400, "PERSISTENT_TIMESTAMP_INVALID")
+	}
+
+	if len(channel.differences) == 0 {
+		return &tg.UpdatesChannelDifferenceEmpty{Final: true, Pts: channel.Pts}, nil
+	}
+	diff := channel.differences[0]
+	channel.differences = channel.differences[1:]
+	return diff, nil
+}
+
+// getParticipants 按 offset 和 limit 返回群组成员
+func (b *Backend) getParticipants(r *tg.ChannelsGetParticipantsRequest) (bin.Encoder, error) {
+	in, ok := r.Channel.(*tg.InputChannel)
+	if !ok {
+		return nil, tgerr.New(400, "CHANNEL_INVALID")
+	}
+	channel, err := b.channelByPeer(in.ChannelID, in.AccessHash)
+	if err != nil {
+		return nil, err
+	}
+	if !channel.Megagroup {
+		return nil, tgerr.New(400, "CHAT_ADMIN_REQUIRED")
+	}
+
+	start := min(r.Offset, len(channel.Participants))
+	end := min(start+r.Limit, len(channel.Participants))
+	return &tg.ChannelsChannelParticipants{
+		Count:        len(channel.Participants),
+		Participants: channel.Participants[start:end],
+		Chats:        []tg.ChatClass{},
+		Users:        b.userList(),
+	}, nil
+}
+
+// checkChatInvite 检查邀请链接，已加入时返回频道，否则只返回频道的基本信息
+func (b *Backend) checkChatInvite(hash string) (bin.Encoder, error) {
+	channel, ok := b.channels[b.invites[hash]]
+	if !ok {
+		return nil, tgerr.New(400, "INVITE_HASH_INVALID")
+	}
+	if !channel.Left {
+		return &tg.ChatInviteAlready{Chat: channel.chat()}, nil
+	}
+	if channel.Peek {
+		return &tg.ChatInvitePeek{Chat: channel.chat(), Expires: 1 << 30}, nil
+	}
+	invite := &tg.ChatInvite{
+		Channel:           true,
+		Broadcast:         true,
+		Title:             channel.Title,
+		Photo:             &tg.PhotoEmpty{},
+		ParticipantsCount: channel.Members,
+	}
+	invite.SetFlags()
+	return invite, nil
+}
+
+// importChatInvite 通过邀请链接加入频道
+func (b *Backend) importChatInvite(hash string) (bin.Encoder, error) {
+	channel, ok := b.channels[b.invites[hash]]
+	if !ok {
+		return nil, tgerr.New(400, "INVITE_HASH_INVALID")
+	}
+	if !channel.Left {
+		return nil, tgerr.New(400, "USER_ALREADY_PARTICIPANT")
+	}
+	channel.Left = false
+	return &tg.Updates{
+		Updates: []tg.UpdateClass{},
+		Users:   []tg.UserClass{},
+		Chats:   []tg.ChatClass{channel.chat()},
+	}, nil
+}
+
+// getDialogs 以对话列表的形式返回所有频道
+func (b *Backend) getDialogs() bin.Encoder {
+	chats := make([]tg.ChatClass, 0, len(b.channels))
+	for _, channel := range b.channels {
+		if !channel.Left {
+			chats = append(chats, channel.chat())
+		}
+	}
+	return &tg.MessagesDialogs{
+		Dialogs:  []tg.DialogClass{},
+		Messages: []tg.MessageClass{},
+		Chats:    chats,
+		Users:    []tg.UserClass{},
+	}
+}
+
+// userList 返回所有用户
+func (b *Backend) userList() []tg.UserClass {
+	users := make([]tg.UserClass, 0, len(b.users))
+	for _, user := range b.users {
+		users = append(users, user)
+	}
+	return users
+}
+
+// sorted 按 ID 从新到旧返回频道的所有消息
+func (c *Channel) sorted() []tg.MessageClass {
+	messages := make([]tg.MessageClass, 0, len(c.messages))
+	for _, m := range c.messages {
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].GetID() > messages[j].GetID() })
+	return messages
+}
+
+// chat 频道在响应中的 Chat 表示
+func (c *Channel) chat() *tg.Channel {
+	channel := &tg.Channel{
+		ID:        c.ID,
+		Broadcast: !c.Megagroup,
+		Megagroup: c.Megagroup,
+		Title:     c.Title,
+		Username:  c.Username,
+		Photo:     &tg.ChatPhotoEmpty{},
+		Date:      c.Date,
+	}
+	channel.Left = c.Left
+	channel.SetAccessHash(c.AccessHash)
+	channel.SetParticipantsCount(c.Members)
+	return channel
+}
+
+// messageDate 返回消息的发送时间
+func messageDate(m tg.MessageClass) int {
+	if message, ok := m.AsNotEmpty(); ok {
+		return message.GetDate()
+	}
+	return 0
+}
+
+// methodName 返回请求的 TL 方法名
+func methodName(input bin.Encoder) string {
+	if named, ok := input.(interface{ TypeName() string }); ok {
+		return named.TypeName()
+	}
+	return fmt.Sprintf("%T", input)
+}